@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// adminUsage lists the admin subcommands
+const adminUsage = `usage: groupplan admin <command>
+
+  users [-offset n] [-limit n]       list users
+  find <text>                        find users by email or display name
+  user <id|email>                    show a user and their authentication points
+  plans <id|email>                   list the plans owned by a user
+  delete-plan <identifier>           delete a plan, regardless of who owns it
+  reassign-plan <identifier> <user>  make another user (id or email) the owner of a plan
+  merge-users <keep> <duplicate>     move everything of the duplicate user to the kept one, then disable the duplicate
+  grant-admin <id|email>             give a user the admin capability
+  revoke-admin <id|email>            take the admin capability away from a user
+  disable <id|email>                 disable a user, so they can no longer log in, admins cannot be disabled
+  enable <id|email>                  re-enable a disabled user`
+
+// runAdmin is the `groupplan admin` command set, for fixing up users and plans directly in the database
+func runAdmin(cfg config.AppSettings, args []string) error {
+	if len(args) == 0 {
+		return errors.New(adminUsage)
+	}
+	db, err := groupdata.New(cfg.Database())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "users":
+		flags := flag.NewFlagSet("users", flag.ContinueOnError)
+		offset := flags.Int("offset", 0, "how many users to skip")
+		limit := flags.Int("limit", 50, "how many users to list")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		found, total, err := db.Users().ListUsers(*offset, *limit)
+		if err != nil {
+			return err
+		}
+		printUsers(out, found)
+		fmt.Fprintf(out, "\n%d-%d of %d users\n", *offset+1, *offset+len(found), total)
+		return nil
+	case "find":
+		if len(args) != 1 {
+			return errors.New("usage: groupplan admin find <text>")
+		}
+		found, err := db.Users().FindUsers(args[0])
+		if err != nil {
+			return err
+		}
+		printUsers(out, found)
+		return nil
+	case "user":
+		if len(args) != 1 {
+			return errors.New("usage: groupplan admin user <id|email>")
+		}
+		user, err := resolveUser(db, args[0])
+		if err != nil {
+			return err
+		}
+		printUsers(out, []users.User{user})
+		fmt.Fprintln(out, "\nPROVIDER\tIDENTIFIER")
+		for _, point := range user.AuthPoints {
+			fmt.Fprintf(out, "%s\t%s\n", point.Provider.Name, point.Identifier)
+		}
+		return nil
+	case "plans":
+		if len(args) != 1 {
+			return errors.New("usage: groupplan admin plans <id|email>")
+		}
+		user, err := resolveUser(db, args[0])
+		if err != nil {
+			return err
+		}
+		owned, err := db.Plans().GetPlansByUser(user)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "IDENTIFIER\tTITLE\tFROM\tDAYS\tENTRIES")
+		for _, plan := range owned {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%d\n", plan.Identifier, plan.Title, plan.FromDate.Format("2006-01-02"), plan.DurationDays, len(plan.Entries))
+		}
+		return nil
+	case "delete-plan":
+		if len(args) != 1 {
+			return errors.New("usage: groupplan admin delete-plan <identifier>")
+		}
+		plan, err := db.Plans().GetPlan(args[0])
+		if err != nil {
+			return err
+		}
+		// The same way the admin API does it, which cancels the plan's jobs along with it. The
+		// running server has its own hub, so the deleted event goes no further than this command.
+		if err := planman.New(db.Plans(), events.NewHub()).ForceDeletePlan(plan.Identifier); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Deleted plan [%s] (%s) owned by [%s]\n", plan.Identifier, plan.Title, plan.Owner.Email)
+		return nil
+	case "reassign-plan":
+		if len(args) != 2 {
+			return errors.New("usage: groupplan admin reassign-plan <identifier> <id|email>")
+		}
+		plan, err := db.Plans().GetPlan(args[0])
+		if err != nil {
+			return err
+		}
+		owner, err := resolveUser(db, args[1])
+		if err != nil {
+			return err
+		}
+		previous := plan.Owner.Email
+		if err := db.Plans().ReassignPlan(&plan, owner); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Plan [%s] reassigned from [%s] to [%s]\n", plan.Identifier, previous, owner.Email)
+		return nil
+	case "merge-users":
+		if len(args) != 2 {
+			return errors.New("usage: groupplan admin merge-users <keep id|email> <duplicate id|email>")
+		}
+		keep, err := resolveUser(db, args[0])
+		if err != nil {
+			return err
+		}
+		duplicate, err := resolveUser(db, args[1])
+		if err != nil {
+			return err
+		}
+		if err := db.MergeUsers(keep, duplicate); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Merged [%s] into [%s]\n", duplicate.Email, keep.Email)
+		return nil
+	case "grant-admin", "revoke-admin":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: groupplan admin %s <id|email>", command)
+		}
+		user, err := resolveUser(db, args[0])
+		if err != nil {
+			return err
+		}
+		admin := command == "grant-admin"
+		if err := db.Users().SetAdmin(&user, admin); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Admin for [%s] set to %t\n", user.Email, admin)
+		return nil
+	case "disable", "enable":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: groupplan admin %s <id|email>", command)
+		}
+		user, err := resolveUser(db, args[0])
+		if err != nil {
+			return err
+		}
+		disabled := command == "disable"
+		// The same rules as the admin API apply, so admins can't be disabled here either
+		if _, err := userman.New(db.Users(), cfg.AdminEmails).SetDisabled(user.ID, disabled); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Disabled for [%s] set to %t\n", user.Email, disabled)
+		return nil
+	}
+	return fmt.Errorf("unknown admin command [%s]\n\n%s", command, adminUsage)
+}
+
+// resolveUser finds a user by either their numeric ID or their email address
+func resolveUser(db groupdata.Data, idOrEmail string) (users.User, error) {
+	if id, err := strconv.ParseUint(idOrEmail, 10, 32); err == nil {
+		return db.Users().GetUser(uint(id))
+	}
+	return db.Users().GetUserByEmail(idOrEmail)
+}
+
+// printUsers writes a table of users
+func printUsers(out *tabwriter.Writer, list []users.User) {
+	fmt.Fprintln(out, "ID\tEMAIL\tNAME\tADMIN\tDISABLED\tCREATED")
+	for _, user := range list {
+		fmt.Fprintf(out, "%d\t%s\t%s\t%t\t%t\t%s\n", user.ID, user.Email, user.DisplayName, user.IsAdmin, user.Disabled, user.CreatedAt.Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+	"github.com/wallnutkraken/groupplan/planman"
+)
+
+func TestRunAdmin_Disable_RefusesAdmins(t *testing.T) {
+	that := assert.New(t)
+	cfg := config.AppSettings{
+		DatabaseDriver: groupdata.DriverSQLite,
+		DatabaseDSN:    filepath.Join(t.TempDir(), "groupplan.sqlite3"),
+		AdminEmails:    []string{"config-admin@example.com"},
+	}
+	db, err := groupdata.New(cfg.Database())
+	require.NoError(t, err)
+	_, err = db.Users().GetOrCreateUser("config-admin@example.com", "", "Config admin")
+	require.NoError(t, err)
+	user, err := db.Users().GetOrCreateUser("user@example.com", "", "User")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	that.Error(runAdmin(cfg, []string{"disable", "config-admin@example.com"}), "admins from the config can't be disabled")
+	require.NoError(t, runAdmin(cfg, []string{"grant-admin", user.Email}))
+	that.Error(runAdmin(cfg, []string{"disable", user.Email}), "admins can't be disabled")
+	require.NoError(t, runAdmin(cfg, []string{"revoke-admin", user.Email}))
+	that.NoError(runAdmin(cfg, []string{"disable", user.Email}))
+
+	db, err = groupdata.New(cfg.Database())
+	require.NoError(t, err)
+	defer db.Close()
+	disabled, err := db.Users().GetUser(user.ID)
+	require.NoError(t, err)
+	that.True(disabled.Disabled)
+}
+
+func TestRunAdmin_DeletePlan_CancelsItsJobs(t *testing.T) {
+	that := assert.New(t)
+	cfg := config.AppSettings{
+		DatabaseDriver: groupdata.DriverSQLite,
+		DatabaseDSN:    filepath.Join(t.TempDir(), "groupplan.sqlite3"),
+	}
+	db, err := groupdata.New(cfg.Database())
+	require.NoError(t, err)
+	owner, err := db.Users().GetOrCreateUser("owner@example.com", "", "Owner")
+	require.NoError(t, err)
+	deadline := time.Now().Add(48 * time.Hour)
+	created, err := planman.New(db.Plans(), events.NewHub()).NewPlan("Plan", time.Now(), 7, 60, owner, planman.PlanOptions{ResponseDeadline: &deadline})
+	require.NoError(t, err)
+	plan, err := db.Plans().GetPlan(created.Identifier)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	require.NoError(t, runAdmin(cfg, []string{"delete-plan", plan.Identifier}))
+
+	db, err = groupdata.New(cfg.Database())
+	require.NoError(t, err)
+	defer db.Close()
+	scheduled, err := db.Jobs().ListJobs(plan.ID)
+	require.NoError(t, err)
+	that.NotEmpty(scheduled)
+	for _, job := range scheduled {
+		that.Equal(jobs.StatusCancelled, job.Status)
+	}
+}
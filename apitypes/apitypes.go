@@ -0,0 +1,159 @@
+// Package apitypes contains the JSON request and response types of the versioned API. Both the
+// server and the Go client use them, so this package must not import any other groupplan package.
+package apitypes
+
+import "time"
+
+// User represents a single user
+type User struct {
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// GroupPlan represents a single plan
+type GroupPlan struct {
+	Owner               User        `json:"owner"`
+	Identifier          string      `json:"identifier"`
+	Title               string      `json:"title"`
+	FromDate            time.Time   `json:"from_date"`
+	DurationDays        uint        `json:"duration_days"`
+	MinAvailabilitySecs uint        `json:"min_availability_seconds"`
+	Entries             []PlanEntry `json:"entries"`
+	// Members are everyone who joined the plan or added their availability, its owner included
+	Members []Member `json:"members"`
+	// Participants is how many different users have added their availability
+	Participants int  `json:"participants"`
+	Quorum       uint `json:"quorum,omitempty"`
+	// QuorumReached is whether Quorum people have been available at once, it stays set once they have
+	QuorumReached bool `json:"quorum_reached"`
+	// QualifyingSlot is whether there's a time yet when every required member, and at least
+	// Quorum people, are available at once for long enough
+	QualifyingSlot bool `json:"qualifying_slot"`
+	// Final is the time the plan was settled on, nil until it's finalized
+	Final *FinalTime `json:"final,omitempty"`
+	// DiscordAnnouncements is whether announcements are posted to a Discord webhook, the URL
+	// itself is only known to the owner
+	DiscordAnnouncements bool `json:"discord_announcements"`
+	// ResponseDeadline is when participants should have added their availability by, if there's a deadline
+	ResponseDeadline *time.Time `json:"response_deadline,omitempty"`
+	// Closed is whether the response deadline has passed, after which availability can't be changed
+	Closed       bool `json:"closed"`
+	AutoFinalize bool `json:"auto_finalize"`
+}
+
+// FinalTime is the time a plan was settled on, it's also the payload of the plan_finalized event
+type FinalTime struct {
+	StartAtUnix     int64     `json:"start_at_unix"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	FinalizedAt     time.Time `json:"finalized_at"`
+}
+
+// PlanEntry contains the specifics of a single plan entry
+type PlanEntry struct {
+	EntryID         uint  `json:"entry_id"`
+	User            User  `json:"user"`
+	StartAtUnix     int64 `json:"start_at_unix"`
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// Member is someone who joined a plan
+type Member struct {
+	MemberID uint `json:"member_id"`
+	User     User `json:"user"`
+	// Required is whether the plan can only happen at times this member is available
+	Required bool `json:"required"`
+	// Responded is whether they've added their availability
+	Responded bool `json:"responded"`
+}
+
+// Slot is a stretch of time during which the same set of users are all available, others may come
+// and go during it
+type Slot struct {
+	StartAtUnix     int64  `json:"start_at_unix"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	Users           []User `json:"users"`
+}
+
+// CreatePlanRequest is the JSON request object for creating a new plan
+type CreatePlanRequest struct {
+	Title                  string `json:"title"`
+	StartDate              string `json:"start_date"`
+	DurationDays           uint   `json:"duration_days"`
+	MinAvailabilitySeconds uint   `json:"min_availability_seconds"`
+	// Quorum is how many people need to be available at once, announced once they are
+	Quorum uint `json:"quorum,omitempty"`
+	// DiscordWebhookURL, if set, is where announcements about the plan are posted
+	DiscordWebhookURL string `json:"discord_webhook_url,omitempty"`
+	// ResponseDeadline, if set, is when participants should have added their availability by
+	ResponseDeadline int64 `json:"response_deadline_unix,omitempty"`
+	// AutoFinalize finalizes the plan on its best time once the response deadline passes
+	AutoFinalize bool `json:"auto_finalize,omitempty"`
+}
+
+// AddEntryRequest is the JSON request object for creating a new entry
+type AddEntryRequest struct {
+	StartTime       int64 `json:"start_time_unix"`
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// FinalizePlanRequest is the JSON request object for settling a plan on a time
+type FinalizePlanRequest struct {
+	StartTime       int64 `json:"start_time_unix"`
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// DiscordWebhookRequest is the JSON request object for setting a plan's Discord webhook
+type DiscordWebhookRequest struct {
+	WebhookURL string `json:"webhook_url"`
+}
+
+// ResponseDeadlineRequest is the JSON request object for setting a plan's response deadline
+type ResponseDeadlineRequest struct {
+	DeadlineUnix int64 `json:"deadline_unix"`
+	// AutoFinalize finalizes the plan on its best time once the deadline passes
+	AutoFinalize bool `json:"auto_finalize"`
+}
+
+// RequirementsRequest is the JSON request object for setting who and how many people a plan needs
+type RequirementsRequest struct {
+	// Quorum is how many people need to be available at once, 0 if it doesn't matter
+	Quorum uint `json:"quorum"`
+	// RequiredMemberIDs are the members who have to be available, the plan's other members stop being required
+	RequiredMemberIDs []uint `json:"required_member_ids"`
+}
+
+// APITokenPrefix starts every API token, telling them apart from session tokens
+const APITokenPrefix = "gp_"
+
+// APIToken describes an API token, without the token itself
+type APIToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateTokenRequest is the JSON request object for creating a new API token
+type CreateTokenRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateTokenResponse is the newly created API token. The token itself is never shown again.
+type CreateTokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// ErrorResponse is the body of every error response on the versioned API
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes what went wrong. Code is one of the dataerror codes, or "internal" for server
+// errors, which come with a reference to find them in the logs instead of a detailed message.
+type ErrorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	Reference string `json:"reference,omitempty"`
+}
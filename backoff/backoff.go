@@ -0,0 +1,23 @@
+// Package backoff works out how long to wait before trying something that failed again
+package backoff
+
+import "time"
+
+// Exponential is a wait that starts at First after the first failed attempt, and doubles with every
+// attempt after, up to Max
+type Exponential struct {
+	First time.Duration
+	Max   time.Duration
+}
+
+// Delay returns how long to wait after the given number of failed attempts
+func (e Exponential) Delay(attempts uint) time.Duration {
+	delay := e.First
+	for i := uint(1); i < attempts && delay < e.Max; i++ {
+		delay *= 2
+	}
+	if delay > e.Max {
+		delay = e.Max
+	}
+	return delay
+}
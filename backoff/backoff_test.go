@@ -0,0 +1,19 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/backoff"
+)
+
+func TestExponential_DoublesUpToMax(t *testing.T) {
+	that := assert.New(t)
+	wait := backoff.Exponential{First: 10 * time.Second, Max: time.Minute}
+	that.Equal(10*time.Second, wait.Delay(1))
+	that.Equal(20*time.Second, wait.Delay(2))
+	that.Equal(40*time.Second, wait.Delay(3))
+	that.Equal(time.Minute, wait.Delay(4))
+	that.Equal(time.Minute, wait.Delay(1000))
+}
@@ -0,0 +1,163 @@
+// Package backup creates timestamped database backups in a directory, both on demand and on a
+// schedule, and prunes old ones
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/groupdata"
+)
+
+const (
+	// filePrefix is the prefix of the file name of backups made on demand
+	filePrefix = "groupplan-"
+	// scheduledPrefix is the prefix of the file name of scheduled backups, only files with it
+	// are ever pruned
+	scheduledPrefix = "groupplan-scheduled-"
+)
+
+// Source is the data that can be backed up, implemented by groupdata.Data
+type Source interface {
+	Snapshot(path string) error
+	Dump(w io.Writer) error
+}
+
+// Create writes a new backup into the given directory and returns its path. SQLite databases
+// are backed up as a database snapshot, any other database as a JSON dump. It's never pruned.
+func Create(source Source, dir string) (string, error) {
+	return create(source, dir, filePrefix)
+}
+
+// create writes a new backup into the given directory, its file name starting with prefix
+func create(source Source, dir, prefix string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed creating backup directory [%s]: %w", dir, err)
+	}
+	name := prefix + time.Now().UTC().Format("20060102T150405Z")
+
+	path := filepath.Join(dir, name+".sqlite3")
+	err := source.Snapshot(path)
+	if err == nil {
+		return path, nil
+	}
+	if !errors.Is(err, groupdata.ErrNotSQLite) {
+		return "", err
+	}
+
+	// Not a SQLite database, fall back to a JSON dump
+	path = filepath.Join(dir, name+".json")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed creating backup file [%s]: %w", path, err)
+	}
+	if err := source.Dump(file); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed writing dump: %w", err)
+	}
+	return path, file.Close()
+}
+
+// Prune deletes all but the newest keep scheduled backups in the given directory, returning the
+// deleted paths. Backups made on demand are left alone.
+func Prune(dir string, keep int) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing backup directory [%s]: %w", dir, err)
+	}
+	backups := []string{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, scheduledPrefix) || strings.HasSuffix(name, ".partial") {
+			continue
+		}
+		backups = append(backups, name)
+	}
+	// The timestamp in the name sorts chronologically
+	sort.Strings(backups)
+
+	deleted := []string{}
+	for index := 0; index < len(backups)-keep; index++ {
+		path := filepath.Join(dir, backups[index])
+		if err := os.Remove(path); err != nil {
+			return deleted, fmt.Errorf("failed deleting old backup [%s]: %w", path, err)
+		}
+		deleted = append(deleted, path)
+	}
+	return deleted, nil
+}
+
+// Scheduler periodically creates backups and prunes old ones in the background
+type Scheduler struct {
+	source   Source
+	dir      string
+	interval time.Duration
+	keep     int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewScheduler creates a Scheduler that backs up the source into dir every interval, keeping
+// the newest keep backups
+func NewScheduler(source Source, dir string, interval time.Duration, keep int) *Scheduler {
+	return &Scheduler{
+		source:   source,
+		dir:      dir,
+		interval: interval,
+		keep:     keep,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts taking backups in the background
+func (s *Scheduler) Start() {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.run()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// run takes a single backup and prunes, logging any failure
+func (s *Scheduler) run() {
+	path, err := create(s.source, s.dir, scheduledPrefix)
+	if err != nil {
+		logrus.WithError(err).Error("Scheduled backup failed")
+		return
+	}
+	logrus.Infof("Created backup [%s]", path)
+	if _, err := Prune(s.dir, s.keep); err != nil {
+		logrus.WithError(err).Error("Failed pruning old backups")
+	}
+}
+
+// Stop stops taking backups, waiting for a backup in progress to finish or the context to be done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
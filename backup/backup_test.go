@@ -0,0 +1,34 @@
+package backup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrune_KeepsBackupsMadeOnDemand(t *testing.T) {
+	that := assert.New(t)
+	dir := t.TempDir()
+	names := []string{
+		"groupplan-20260101T000000Z.sqlite3",
+		"groupplan-scheduled-20260102T000000Z.sqlite3",
+		"groupplan-scheduled-20260103T000000Z.sqlite3",
+		"groupplan-scheduled-20260104T000000Z.json",
+	}
+	for _, name := range names {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("backup"), 0600))
+	}
+
+	deleted, err := Prune(dir, 1)
+	require.NoError(t, err)
+	that.Equal([]string{filepath.Join(dir, names[1]), filepath.Join(dir, names[2])}, deleted)
+	left, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	if that.Len(left, 2) {
+		that.Equal(names[0], left[0].Name(), "the backup made on demand should be kept")
+		that.Equal(names[3], left[1].Name())
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/backup"
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/groupdata"
+)
+
+// runBackup is the `groupplan backup [-json file] [dir]` command. By default it writes a timestamped
+// backup to the given (or configured) backup directory, with -json it writes a portable JSON dump
+// to the given file instead ("-" for standard output).
+func runBackup(cfg config.AppSettings, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	jsonPath := flags.String("json", "", "write a portable JSON dump to this file instead of a backup to the backup directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	db, err := groupdata.New(cfg.Database())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *jsonPath != "" {
+		var out io.Writer = os.Stdout
+		if *jsonPath != "-" {
+			file, err := os.OpenFile(*jsonPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return fmt.Errorf("failed creating dump file: %w", err)
+			}
+			defer file.Close()
+			out = file
+		}
+		return db.Dump(out)
+	}
+
+	dir, _, _ := cfg.Backups()
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	path, err := backup.Create(db, dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to [%s]\n", path)
+	return nil
+}
+
+// runRestore is the `groupplan restore <file>` command. JSON dumps are restored into the configured
+// (empty) database, any other file is treated as a SQLite snapshot and replaces the configured
+// SQLite database file, which is kept next to it. The server must not be running.
+func runRestore(cfg config.AppSettings, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: groupplan restore <backup file>")
+	}
+	source := args[0]
+	if strings.HasSuffix(source, ".json") {
+		file, err := os.Open(source)
+		if err != nil {
+			return fmt.Errorf("failed opening dump: %w", err)
+		}
+		defer file.Close()
+		db, err := groupdata.New(cfg.Database())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err := db.Restore(file); err != nil {
+			return err
+		}
+		fmt.Printf("Restored [%s]\n", source)
+		return nil
+	}
+
+	driver, target := cfg.Database()
+	if driver != groupdata.DriverSQLite {
+		return fmt.Errorf("snapshots can only be restored into sqlite databases, restore a JSON dump into %s instead", driver)
+	}
+	// Make sure the snapshot is a healthy database this version can work with, before touching anything
+	snapshot, err := groupdata.Open(groupdata.DriverSQLite, source)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Verify(); err != nil {
+		snapshot.Close()
+		return fmt.Errorf("snapshot [%s] failed verification: %w", source, err)
+	}
+	snapshot.Close()
+
+	// Keep the current database around, in case the wrong snapshot was picked
+	if _, err := os.Stat(target); err == nil {
+		aside := fmt.Sprintf("%s.before-restore-%s", target, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(target, aside); err != nil {
+			return fmt.Errorf("failed moving the current database aside: %w", err)
+		}
+		fmt.Printf("Previous database moved to [%s]\n", aside)
+	}
+	if err := copyFile(source, target); err != nil {
+		return err
+	}
+	fmt.Printf("Restored [%s] to [%s]\n", source, target)
+	return nil
+}
+
+// copyFile copies the file at source to a new file at target
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed opening [%s]: %w", source, err)
+	}
+	defer in.Close()
+	if dir := filepath.Dir(target); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed creating directory [%s]: %w", dir, err)
+		}
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed creating [%s]: %w", target, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed copying [%s] to [%s]: %w", source, target, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,184 @@
+// Package client is a Go client for the groupplan HTTP API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+)
+
+const (
+	// sessionCookie is the cookie the server keeps the session token in
+	sessionCookie = "groupplan_jwt"
+	// apiPrefix is the version of the API this client speaks, all paths are under it
+	apiPrefix = "/api/v1"
+)
+
+// Client talks to a groupplan server
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	authorize  func(req *http.Request)
+}
+
+// Option configures a Client
+type Option func(c *Client)
+
+// WithBearerToken authenticates every request with the given API token, or session token, in the
+// Authorization header
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.authorize = func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
+
+// WithSessionCookie authenticates every request with the given session token as a cookie,
+// the same way a logged in browser does
+func WithSessionCookie(token string) Option {
+	return func(c *Client) {
+		c.authorize = func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+		}
+	}
+}
+
+// WithHTTPClient makes the Client send its requests with the given http.Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New creates a Client for the server at the given base URL, such as https://groupplan.example.com
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL [%s]: %w", baseURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("base URL [%s] must be http or https", baseURL)
+	}
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		authorize:  func(req *http.Request) {},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// CreatePlan creates a new plan owned by the authenticated user
+func (c *Client) CreatePlan(ctx context.Context, req apitypes.CreatePlanRequest) (apitypes.GroupPlan, error) {
+	created := apitypes.GroupPlan{}
+	err := c.do(ctx, http.MethodPut, "/plans", req, &created)
+	return created, err
+}
+
+// GetPlan returns the plan with the given identifier, with every user's entries
+func (c *Client) GetPlan(ctx context.Context, identifier string) (apitypes.GroupPlan, error) {
+	found := apitypes.GroupPlan{}
+	err := c.do(ctx, http.MethodGet, "/plans/"+url.PathEscape(identifier), nil, &found)
+	return found, err
+}
+
+// ListPlans returns the plans owned by the authenticated user
+func (c *Client) ListPlans(ctx context.Context) ([]apitypes.GroupPlan, error) {
+	found := []apitypes.GroupPlan{}
+	err := c.do(ctx, http.MethodGet, "/plans", nil, &found)
+	return found, err
+}
+
+// DeletePlan deletes a plan owned by the authenticated user
+func (c *Client) DeletePlan(ctx context.Context, identifier string) error {
+	return c.do(ctx, http.MethodDelete, "/plans/"+url.PathEscape(identifier), nil, nil)
+}
+
+// AddEntry adds an availability entry for the authenticated user to a plan
+func (c *Client) AddEntry(ctx context.Context, identifier string, req apitypes.AddEntryRequest) (apitypes.PlanEntry, error) {
+	created := apitypes.PlanEntry{}
+	err := c.do(ctx, http.MethodPut, "/plans/"+url.PathEscape(identifier), req, &created)
+	return created, err
+}
+
+// DeleteEntry deletes one of the authenticated user's entries on a plan
+func (c *Client) DeleteEntry(ctx context.Context, identifier string, entryID uint) error {
+	path := fmt.Sprintf("/plans/%s/entries/%d", url.PathEscape(identifier), entryID)
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// ListEntries returns the authenticated user's entries on a plan
+func (c *Client) ListEntries(ctx context.Context, identifier string) ([]apitypes.PlanEntry, error) {
+	found := []apitypes.PlanEntry{}
+	err := c.do(ctx, http.MethodGet, "/plans/"+url.PathEscape(identifier)+"/entries", nil, &found)
+	return found, err
+}
+
+// BestSlots returns up to limit times on a plan where the most users are available, best first.
+// A limit of 0 uses the server's default.
+func (c *Client) BestSlots(ctx context.Context, identifier string, limit int) ([]apitypes.Slot, error) {
+	path := "/plans/" + url.PathEscape(identifier) + "/slots"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	found := []apitypes.Slot{}
+	err := c.do(ctx, http.MethodGet, path, nil, &found)
+	return found, err
+}
+
+// FinalizePlan settles a plan owned by the authenticated user on a time
+func (c *Client) FinalizePlan(ctx context.Context, identifier string, req apitypes.FinalizePlanRequest) (apitypes.FinalTime, error) {
+	final := apitypes.FinalTime{}
+	err := c.do(ctx, http.MethodPut, "/plans/"+url.PathEscape(identifier)+"/final", req, &final)
+	return final, err
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out, if given.
+// Error responses are returned as *UserError or *ServerError.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed encoding request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+apiPrefix+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed decoding response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
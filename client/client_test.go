@@ -0,0 +1,65 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/client"
+)
+
+func TestCreatePlan_SendsTokenAndBody(t *testing.T) {
+	that := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		that.Equal(http.MethodPut, r.Method)
+		that.Equal("/api/v1/plans", r.URL.Path)
+		that.Equal("Bearer secret", r.Header.Get("Authorization"))
+		req := apitypes.CreatePlanRequest{}
+		that.NoError(json.NewDecoder(r.Body).Decode(&req))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(apitypes.GroupPlan{Identifier: "abc", Title: req.Title})
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.WithBearerToken("secret"))
+	require.NoError(t, err)
+	created, err := c.CreatePlan(context.Background(), apitypes.CreatePlanRequest{Title: "Game night"})
+	require.NoError(t, err)
+	that.Equal("abc", created.Identifier)
+	that.Equal("Game night", created.Title)
+}
+
+func TestErrors_AreTyped(t *testing.T) {
+	that := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/plans/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apitypes.ErrorResponse{Error: apitypes.ErrorDetail{Code: "not_found", Message: "no such plan exists"}})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(apitypes.ErrorResponse{Error: apitypes.ErrorDetail{Code: "internal", Message: "Internal server error", Reference: "ref-1"}})
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.WithSessionCookie("session"))
+	require.NoError(t, err)
+
+	userErr := &client.UserError{}
+	if that.True(errors.As(c.DeletePlan(context.Background(), "missing"), &userErr)) {
+		that.Equal(http.StatusNotFound, userErr.StatusCode)
+		that.Equal("not_found", userErr.Code)
+		that.Equal("no such plan exists", userErr.Message)
+	}
+	serverErr := &client.ServerError{}
+	_, err = c.ListPlans(context.Background())
+	if that.True(errors.As(err, &serverErr)) {
+		that.Equal("ref-1", serverErr.Reference)
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+)
+
+// UserError is returned when the server rejected a request because of something the caller did,
+// such as invalid input, a missing login or an unknown plan
+type UserError struct {
+	StatusCode int
+	// Code is the machine-readable error code, such as not_found or validation_failed
+	Code    string
+	Message string
+	// Field is the request field the error is about, if the server knows it
+	Field string
+}
+
+// Error returns the server's message along with the status code
+func (e *UserError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+// ServerError is returned when the server failed handling a request. The reference can be used
+// to find the failure in the server's logs.
+type ServerError struct {
+	StatusCode int
+	Reference  string
+}
+
+// Error returns the error reference along with the status code
+func (e *ServerError) Error() string {
+	if e.Reference == "" {
+		return fmt.Sprintf("server error (%d)", e.StatusCode)
+	}
+	return fmt.Sprintf("server error (%d), reference [%s]", e.StatusCode, e.Reference)
+}
+
+// decodeError turns an error response into a *UserError or *ServerError
+func decodeError(resp *http.Response) error {
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return fmt.Errorf("failed reading error response (%d): %w", resp.StatusCode, err)
+	}
+	// A body that isn't JSON still leaves us with the status code
+	envelope := apitypes.ErrorResponse{}
+	_ = json.Unmarshal(raw, &envelope)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &ServerError{StatusCode: resp.StatusCode, Reference: envelope.Error.Reference}
+	}
+	if envelope.Error.Message == "" {
+		envelope.Error.Message = http.StatusText(resp.StatusCode)
+	}
+	return &UserError{
+		StatusCode: resp.StatusCode,
+		Code:       envelope.Error.Code,
+		Message:    envelope.Error.Message,
+		Field:      envelope.Error.Field,
+	}
+}
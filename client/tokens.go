@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+)
+
+// CreateToken creates a new API token for the authenticated user. The returned token is the only
+// time it can be seen.
+func (c *Client) CreateToken(ctx context.Context, name string) (apitypes.CreateTokenResponse, error) {
+	created := apitypes.CreateTokenResponse{}
+	err := c.do(ctx, http.MethodPut, "/tokens", apitypes.CreateTokenRequest{Name: name}, &created)
+	return created, err
+}
+
+// ListTokens returns the authenticated user's API tokens, without the tokens themselves
+func (c *Client) ListTokens(ctx context.Context) ([]apitypes.APIToken, error) {
+	found := []apitypes.APIToken{}
+	err := c.do(ctx, http.MethodGet, "/tokens", nil, &found)
+	return found, err
+}
+
+// RevokeToken deletes one of the authenticated user's API tokens
+func (c *Client) RevokeToken(ctx context.Context, tokenID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/tokens/%d", tokenID), nil, nil)
+}
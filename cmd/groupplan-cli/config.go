@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// serverEnv and tokenEnv override the saved login, for scripts
+	serverEnv = "GROUPPLAN_SERVER"
+	tokenEnv  = "GROUPPLAN_TOKEN"
+)
+
+// login is what `groupplan-cli login` saves
+type login struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// loginPath returns where the login is saved
+func loginPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed finding the config directory: %w", err)
+	}
+	return filepath.Join(dir, "groupplan", "cli.json"), nil
+}
+
+// loadLogin returns the saved login, with the environment variables taking precedence
+func loadLogin() (login, error) {
+	saved := login{}
+	path, err := loginPath()
+	if err != nil {
+		return saved, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return saved, fmt.Errorf("failed reading [%s]: %w", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &saved); err != nil {
+			return saved, fmt.Errorf("failed parsing [%s]: %w", path, err)
+		}
+	}
+	if server := os.Getenv(serverEnv); server != "" {
+		saved.Server = server
+	}
+	if token := os.Getenv(tokenEnv); token != "" {
+		saved.Token = token
+	}
+	if saved.Server == "" || saved.Token == "" {
+		return saved, errors.New("not logged in, run `groupplan-cli login <server> <token>` first")
+	}
+	return saved, nil
+}
+
+// save writes the login, readable only by the current user as it contains the token
+func (l login) save() error {
+	path, err := loginPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed creating [%s]: %w", filepath.Dir(path), err)
+	}
+	raw, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		return fmt.Errorf("failed writing [%s]: %w", path, err)
+	}
+	return nil
+}
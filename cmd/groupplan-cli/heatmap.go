@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+)
+
+// printHeatmap prints one row per day of the plan and one column per hour, each cell showing how
+// many people are available for at least part of that hour
+func printHeatmap(out io.Writer, plan apitypes.GroupPlan, loc *time.Location) {
+	fmt.Fprintf(out, "%s (%s)\n\n", plan.Title, plan.Identifier)
+	fmt.Fprintf(out, "%-16s", "")
+	for hour := 0; hour < 24; hour += 3 {
+		fmt.Fprintf(out, "%-6s", fmt.Sprintf("%02d", hour))
+	}
+	fmt.Fprintln(out)
+
+	// The plan's date has no time zone of its own, the days are shown in the local one
+	first := time.Date(plan.FromDate.Year(), plan.FromDate.Month(), plan.FromDate.Day(), 0, 0, 0, 0, loc)
+	for day := 0; day < int(plan.DurationDays); day++ {
+		date := first.AddDate(0, 0, day)
+		row := strings.Builder{}
+		for hour := 0; hour < 24; hour++ {
+			from := time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, loc)
+			row.WriteString(cell(availableDuring(plan.Entries, from.Unix(), from.Add(time.Hour).Unix())))
+			row.WriteString(" ")
+		}
+		fmt.Fprintf(out, "%-16s%s\n", date.Format("Mon 2006-01-02"), row.String())
+	}
+	fmt.Fprintln(out, "\nEach cell is an hour, showing how many people are available during it")
+}
+
+// availableDuring counts the people with an entry overlapping [from, to)
+func availableDuring(entries []apitypes.PlanEntry, from, to int64) int {
+	// Entries only carry the user's public profile, which is as close to an identity as we get
+	people := map[apitypes.User]bool{}
+	for _, entry := range entries {
+		if entry.StartAtUnix < to && entry.StartAtUnix+entry.DurationSeconds > from {
+			people[entry.User] = true
+		}
+	}
+	return len(people)
+}
+
+// cell renders a count in a single character
+func cell(count int) string {
+	switch {
+	case count == 0:
+		return "."
+	case count > 9:
+		return "+"
+	}
+	return fmt.Sprint(count)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the accepted ways of writing a time of day
+var timeLayouts = []string{"15:04", "15", "3pm", "3:04pm", "3PM", "3:04PM"}
+
+// parseDate parses a date written as yyyy-mm-dd, "today", "tomorrow" or a weekday name, which means
+// the next such day (today included). The result is midnight in the location of now.
+func parseDate(input string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	lower := strings.ToLower(input)
+	switch lower {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if lower == name || lower == name[:3] {
+			return today.AddDate(0, 0, (int(day)-int(today.Weekday())+7)%7), nil
+		}
+	}
+	date, err := time.ParseInLocation("2006-01-02", input, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date [%s], use yyyy-mm-dd, today, tomorrow or a weekday", input)
+	}
+	return date, nil
+}
+
+// parseClock parses a time of day, returning it as an offset from midnight
+func parseClock(input string) (time.Duration, error) {
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, input); err == nil {
+			return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time [%s], use something like 18:00 or 6pm", input)
+}
+
+// parseAvailability parses availability written as "<date> <time> <duration>", such as
+// "2026-10-20 18:00 2h", or as "<date> <start>-<end>", such as "friday 18:00-21:30". An end before
+// the start is on the next day.
+func parseAvailability(input string, now time.Time) (time.Time, time.Duration, error) {
+	fields := strings.Fields(input)
+	if len(fields) < 2 || len(fields) > 3 {
+		return time.Time{}, 0, fmt.Errorf("invalid availability [%s], use \"<date> <time> <duration>\" or \"<date> <start>-<end>\"", input)
+	}
+	date, err := parseDate(fields[0], now)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	if len(fields) == 2 {
+		parts := strings.SplitN(fields[1], "-", 2)
+		if len(parts) != 2 {
+			return time.Time{}, 0, fmt.Errorf("invalid time range [%s], use something like 18:00-21:30", fields[1])
+		}
+		from, err := parseClock(parts[0])
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		to, err := parseClock(parts[1])
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		if to <= from {
+			to += 24 * time.Hour
+		}
+		return at(date, from), to - from, nil
+	}
+
+	from, err := parseClock(fields[1])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	duration, err := time.ParseDuration(fields[2])
+	if err != nil || duration <= 0 {
+		return time.Time{}, 0, fmt.Errorf("invalid duration [%s], use something like 2h or 90m", fields[2])
+	}
+	return at(date, from), duration, nil
+}
+
+// at returns the given time of day on a date, following the wall clock across daylight saving changes
+func at(date time.Time, clock time.Duration) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, date.Location())
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAvailability_Formats(t *testing.T) {
+	// A Sunday
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		input    string
+		start    time.Time
+		duration time.Duration
+	}{
+		{"2026-10-20 18:00 2h", time.Date(2026, 10, 20, 18, 0, 0, 0, time.UTC), 2 * time.Hour},
+		{"tomorrow 6pm 90m", time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC), 90 * time.Minute},
+		{"fri 18:00-21:30", time.Date(2026, 10, 23, 18, 0, 0, 0, time.UTC), 3*time.Hour + 30*time.Minute},
+		{"sunday 23:00-01:00", time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), 2 * time.Hour},
+	}
+	for _, tc := range cases {
+		start, duration, err := parseAvailability(tc.input, now)
+		if assert.NoError(t, err, tc.input) {
+			assert.Equal(t, tc.start, start, tc.input)
+			assert.Equal(t, tc.duration, duration, tc.input)
+		}
+	}
+
+	for _, invalid := range []string{"", "2026-10-20", "2026-10-20 25:00 2h", "2026-10-20 18:00 -2h", "someday 18:00 2h"} {
+		_, _, err := parseAvailability(invalid, now)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,231 @@
+// Command groupplan-cli is a terminal client for groupplan: create plans, add availability and
+// find the best times, without opening the dashboard
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/client"
+)
+
+// usage lists the commands
+const usage = `usage: groupplan-cli <command>
+
+  login <server> <token>                      save the server URL and an API token (or a session token, which is swapped for an API token)
+  plans                                       list your plans
+  create [-min 5m] <title> <date> <days>      create a plan starting on the date, lasting the given number of days
+  add <plan> <date> <time> <duration>         add availability, such as: add abc123 2026-10-20 18:00 2h
+  add <plan> <date> <start>-<end>             add availability, such as: add abc123 friday 18:00-21:30
+  entries <plan>                              list your availability on a plan
+  remove <plan> <entry id>                    remove some of your availability
+  show <plan>                                 show a heatmap of everyone's availability
+  slots [-n 5] <plan>                         print the best times, where the most people are available
+
+Dates are yyyy-mm-dd, today, tomorrow or a weekday. Times are in your local time zone.
+The GROUPPLAN_SERVER and GROUPPLAN_TOKEN environment variables override the saved login.`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Ctrl+C cancels the request in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// run runs a single command
+func run(ctx context.Context, command string, args []string) error {
+	if command == "login" {
+		return runLogin(ctx, args)
+	}
+	saved, err := loadLogin()
+	if err != nil {
+		return err
+	}
+	api, err := client.New(saved.Server, client.WithBearerToken(saved.Token))
+	if err != nil {
+		return err
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+
+	switch command {
+	case "plans":
+		found, err := api.ListPlans(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "IDENTIFIER\tTITLE\tFROM\tDAYS\tENTRIES")
+		for _, current := range found {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%d\n", current.Identifier, current.Title, current.FromDate.Format("2006-01-02"), current.DurationDays, len(current.Entries))
+		}
+		return nil
+	case "create":
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		minimum := flags.Duration("min", 5*time.Minute, "the shortest availability worth entering")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 3 {
+			return errors.New("usage: groupplan-cli create [-min 5m] <title> <date> <days>")
+		}
+		date, err := parseDate(flags.Arg(1), time.Now())
+		if err != nil {
+			return err
+		}
+		days, err := strconv.ParseUint(flags.Arg(2), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid number of days [%s]", flags.Arg(2))
+		}
+		created, err := api.CreatePlan(ctx, apitypes.CreatePlanRequest{
+			Title:                  flags.Arg(0),
+			StartDate:              date.Format("2006-01-02"),
+			DurationDays:           uint(days),
+			MinAvailabilitySeconds: uint(minimum.Seconds()),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created plan %s\n", created.Identifier)
+		return nil
+	case "add":
+		if len(args) < 2 {
+			return errors.New("usage: groupplan-cli add <plan> <date> <time> <duration>")
+		}
+		start, duration, err := parseAvailability(strings.Join(args[1:], " "), time.Now())
+		if err != nil {
+			return err
+		}
+		entry, err := api.AddEntry(ctx, args[0], apitypes.AddEntryRequest{
+			StartTime:       start.Unix(),
+			DurationSeconds: int64(duration.Seconds()),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Added entry %d: %s for %s\n", entry.EntryID, start.Format("Mon 2006-01-02 15:04"), duration)
+		return nil
+	case "entries":
+		if len(args) != 1 {
+			return errors.New("usage: groupplan-cli entries <plan>")
+		}
+		entries, err := api.ListEntries(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "ID\tFROM\tTO")
+		for _, entry := range entries {
+			from, to := span(entry.StartAtUnix, entry.DurationSeconds)
+			fmt.Fprintf(out, "%d\t%s\t%s\n", entry.EntryID, from, to)
+		}
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errors.New("usage: groupplan-cli remove <plan> <entry id>")
+		}
+		entryID, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid entry ID [%s]", args[1])
+		}
+		if err := api.DeleteEntry(ctx, args[0], uint(entryID)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Removed entry %d\n", entryID)
+		return nil
+	case "show":
+		if len(args) != 1 {
+			return errors.New("usage: groupplan-cli show <plan>")
+		}
+		found, err := api.GetPlan(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		printHeatmap(out, found, time.Local)
+		return nil
+	case "slots":
+		flags := flag.NewFlagSet("slots", flag.ContinueOnError)
+		limit := flags.Int("n", 5, "how many slots to print")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("usage: groupplan-cli slots [-n 5] <plan>")
+		}
+		slots, err := api.BestSlots(ctx, flags.Arg(0), *limit)
+		if err != nil {
+			return err
+		}
+		if len(slots) == 0 {
+			fmt.Fprintln(out, "Nobody has entered any availability yet")
+			return nil
+		}
+		fmt.Fprintln(out, "PEOPLE\tFROM\tTO\tWHO")
+		for _, slot := range slots {
+			names := make([]string, len(slot.Users))
+			for index, user := range slot.Users {
+				names[index] = user.DisplayName
+			}
+			from, to := span(slot.StartAtUnix, slot.DurationSeconds)
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", len(slot.Users), from, to, strings.Join(names, ", "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command [%s]\n\n%s", command, usage)
+}
+
+// span formats the start and end of a stretch of time in local time
+func span(startUnix, durationSeconds int64) (string, string) {
+	start := time.Unix(startUnix, 0)
+	end := start.Add(time.Duration(durationSeconds) * time.Second)
+	return start.Format("Mon 2006-01-02 15:04"), end.Format("Mon 2006-01-02 15:04")
+}
+
+// runLogin saves the server and token, after checking they work. A session token is swapped for a
+// new API token, as session tokens expire.
+func runLogin(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: groupplan-cli login <server> <token>")
+	}
+	saved := login{Server: strings.TrimSuffix(args[0], "/"), Token: args[1]}
+	api, err := client.New(saved.Server, client.WithBearerToken(saved.Token))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(saved.Token, apitypes.APITokenPrefix) {
+		hostname, _ := os.Hostname()
+		created, err := api.CreateToken(ctx, strings.TrimSpace("groupplan-cli "+hostname))
+		if err != nil {
+			return fmt.Errorf("failed creating an API token: %w", err)
+		}
+		saved.Token = created.Token
+		fmt.Printf("Created API token %d [%s]\n", created.ID, created.Name)
+	} else if _, err := api.ListPlans(ctx); err != nil {
+		return fmt.Errorf("the token doesn't work: %w", err)
+	}
+	if err := saved.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s\n", saved.Server)
+	return nil
+}
@@ -0,0 +1,180 @@
+package discordbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/planman"
+)
+
+const (
+	// maxAttempts is how many times an announcement is posted before giving up on it
+	maxAttempts = 3
+	// retryDelay is the wait before posting again after a failure Discord didn't give a wait for
+	retryDelay = 2 * time.Second
+	// maxRetryAfter caps how long a rate limited announcement waits, longer waits give up instead
+	maxRetryAfter = 30 * time.Second
+	// postTimeout is how long Discord gets to respond
+	postTimeout = 10 * time.Second
+)
+
+// Plans is the part of the Planner the Announcer needs
+type Plans interface {
+	GetPlan(identifier string) (planman.GroupPlan, error)
+	BestSlots(identifier string, limit int) ([]planman.Slot, error)
+	DiscordWebhook(identifier string) (string, error)
+}
+
+// Announcer posts announcements about plans to their Discord webhooks, as plan events happen
+type Announcer struct {
+	plans  Plans
+	client *http.Client
+	link   string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAnnouncer creates a new Announcer, linking announcements to the given URL of the application
+func NewAnnouncer(plans Plans, client *http.Client, link string) *Announcer {
+	return &Announcer{
+		plans:  plans,
+		client: client,
+		link:   link,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// NewHTTPClient returns the HTTP client announcements should be posted with
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: postTimeout}
+}
+
+// Start starts announcing the events published on the hub in the background
+func (a *Announcer) Start(hub *events.Hub) {
+	followed := hub.Follow(a.stop, func(lastID uint64) {
+		logrus.WithField("last_event_id", lastID).Warn("Some plan events were missed, their Discord announcements are lost")
+	})
+	go func() {
+		defer close(a.done)
+		for event := range followed {
+			a.announce(event)
+		}
+	}()
+}
+
+// Stop stops announcing, waiting for the announcement in progress to finish or the context to be done
+func (a *Announcer) Stop(ctx context.Context) error {
+	close(a.stop)
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Discord announcements did not stop in time: %w", ctx.Err())
+	}
+}
+
+// announce posts the announcement for an event to the Discord webhook of its plan, if the event
+// is one worth announcing and the plan has a webhook
+func (a *Announcer) announce(event events.Event) {
+	if event.Type != events.PlanCreated && event.Type != events.QuorumReached && event.Type != events.PlanFinalized {
+		return
+	}
+	log := logrus.WithFields(logrus.Fields{"plan": event.Plan, "event": event.Type})
+	webhookURL, err := a.plans.DiscordWebhook(event.Plan)
+	if err != nil {
+		log.WithError(err).Warn("Failed getting the Discord webhook of a plan")
+		return
+	}
+	if webhookURL == "" {
+		return
+	}
+	message, err := a.Message(event)
+	if err != nil {
+		log.WithError(err).Warn("Failed building a Discord announcement")
+		return
+	}
+	if err := a.Post(webhookURL, message); err != nil {
+		log.WithError(err).Warn("Failed posting a Discord announcement")
+	}
+}
+
+// Message builds the announcement for a plan event, from the plan as it is now
+func (a *Announcer) Message(event events.Event) (Message, error) {
+	plan, err := a.plans.GetPlan(event.Plan)
+	if err != nil {
+		return Message{}, err
+	}
+	if event.Type == events.PlanCreated {
+		return PlanCreatedMessage(plan, a.link), nil
+	}
+	slots, err := a.plans.BestSlots(event.Plan, summarySlots)
+	if err != nil {
+		return Message{}, err
+	}
+	if event.Type == events.QuorumReached {
+		return QuorumReachedMessage(plan, slots, a.link), nil
+	}
+	return PlanFinalizedMessage(plan, slots, a.link), nil
+}
+
+// Post posts a message to a Discord webhook, retrying when rate limited or when Discord is having
+// trouble
+func (a *Announcer) Post(webhookURL string, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed encoding message: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		wait, err := a.post(webhookURL, body)
+		if err == nil {
+			return nil
+		}
+		if wait == 0 || attempt == maxAttempts {
+			return err
+		}
+		select {
+		case <-a.stop:
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// post makes a single attempt at posting to a Discord webhook. On failure, it returns how long to
+// wait before trying again, or 0 if trying again won't help.
+func (a *Announcer) post(webhookURL string, body []byte) (time.Duration, error) {
+	resp, err := a.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return retryDelay, err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait := retryDelay
+		if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+			wait = time.Duration(seconds * float64(time.Second))
+		}
+		if wait > maxRetryAfter {
+			return 0, fmt.Errorf("rate limited by Discord for %s", wait)
+		}
+		return wait, fmt.Errorf("rate limited by Discord")
+	case resp.StatusCode >= 500:
+		return retryDelay, fmt.Errorf("Discord responded with %d: %s", resp.StatusCode, excerpt)
+	default:
+		return 0, fmt.Errorf("Discord responded with %d: %s", resp.StatusCode, excerpt)
+	}
+}
@@ -0,0 +1,78 @@
+package discordbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiBase is the root of Discord's HTTP API
+const apiBase = "https://discord.com/api/v10"
+
+// RegisterCommands registers the /groupplan command with Discord, for a single server if a guild
+// ID is given, or everywhere the application is installed otherwise. It authenticates as the
+// application itself, with its OAuth2 client ID and secret.
+func RegisterCommands(ctx context.Context, client *http.Client, applicationID, clientSecret, guildID string) error {
+	token, err := applicationToken(ctx, client, applicationID, clientSecret)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/applications/%s/commands", apiBase, url.PathEscape(applicationID))
+	if guildID != "" {
+		endpoint = fmt.Sprintf("%s/applications/%s/guilds/%s/commands", apiBase, url.PathEscape(applicationID), url.PathEscape(guildID))
+	}
+	body, err := json.Marshal([]ApplicationCommand{Command})
+	if err != nil {
+		return fmt.Errorf("failed encoding commands: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed registering commands: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		excerpt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Discord refused the commands with %d: %s", resp.StatusCode, excerpt)
+	}
+	return nil
+}
+
+// applicationToken gets a token for managing the application's commands, through the OAuth2 client
+// credentials grant
+func applicationToken(ctx context.Context, client *http.Client, applicationID, clientSecret string) (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"applications.commands.update"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBase+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(applicationID, clientSecret)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed getting an application token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		excerpt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("Discord refused the application credentials with %d: %s", resp.StatusCode, excerpt)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed decoding the application token: %w", err)
+	}
+	return token.AccessToken, nil
+}
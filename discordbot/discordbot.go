@@ -0,0 +1,194 @@
+// Package discordbot is groupplan's side of Discord, it posts announcements about plans to the
+// Discord webhooks their owners set up
+package discordbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/planman"
+)
+
+// Embed colors, matching Discord's own palette
+const (
+	colorBlurple = 0x5865F2
+	colorGreen   = 0x57F287
+	colorYellow  = 0xFEE75C
+)
+
+const (
+	// summarySlots is how many of the best slots announcements list
+	summarySlots = 3
+	// summaryNames is how many of the users available in a slot are named, the rest are counted
+	summaryNames = 5
+	// maxFieldLength is the longest value Discord accepts in an embed field
+	maxFieldLength = 1024
+)
+
+// Message is the JSON body of a Discord webhook post
+type Message struct {
+	Username        string          `json:"username,omitempty"`
+	Content         string          `json:"content,omitempty"`
+	Embeds          []Embed         `json:"embeds,omitempty"`
+	AllowedMentions AllowedMentions `json:"allowed_mentions"`
+}
+
+// AllowedMentions controls who a message can ping. Announcements quote plan titles and display
+// names, which shouldn't be able to ping anyone, so nothing is allowed.
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// Embed is a rich block of a Discord message
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Footer      *EmbedFooter `json:"footer,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+}
+
+// EmbedField is a titled piece of an Embed
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// EmbedFooter is the small print at the bottom of an Embed
+type EmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// PlanCreatedMessage announces a new plan, inviting people to add their availability
+func PlanCreatedMessage(plan planman.GroupPlan, link string) Message {
+	embed := planEmbed(plan, link)
+	embed.Title = "New plan: " + plan.Title
+	embed.Description = fmt.Sprintf("%s is planning **%s**. Add the times you're available!", plan.Owner.DisplayName, plan.Title)
+	embed.Color = colorBlurple
+	embed.Fields = []EmbedField{
+		{Name: "Dates", Value: dateRange(plan), Inline: true},
+		{Name: "Shortest time", Value: formatDuration(int64(plan.MinAvailabilitySecs)), Inline: true},
+	}
+	if plan.Quorum > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "Needs", Value: fmt.Sprintf("%d people", plan.Quorum), Inline: true})
+	}
+	return newMessage(embed)
+}
+
+// QuorumReachedMessage announces that there's a time when enough people can make it to a plan
+func QuorumReachedMessage(plan planman.GroupPlan, slots []planman.Slot, link string) Message {
+	embed := planEmbed(plan, link)
+	embed.Title = plan.Title + " has enough people"
+	embed.Description = fmt.Sprintf("There's a time when at least %d people can make it, **%s** can go ahead.", plan.Quorum, plan.Title)
+	embed.Color = colorGreen
+	embed.Fields = []EmbedField{{Name: "Best times so far", Value: SlotSummary(plan, slots)}}
+	return newMessage(embed)
+}
+
+// PlanFinalizedMessage announces the time a plan was settled on, along with the best times
+// that were on the table
+func PlanFinalizedMessage(plan planman.GroupPlan, slots []planman.Slot, link string) Message {
+	embed := planEmbed(plan, link)
+	embed.Title = plan.Title + " is happening"
+	embed.Color = colorYellow
+	if plan.Final != nil {
+		embed.Description = fmt.Sprintf("**%s** is set for %s.", plan.Title, timeRange(plan.Final.StartAtUnix, plan.Final.DurationSeconds))
+	}
+	embed.Fields = []EmbedField{{Name: "Best times", Value: SlotSummary(plan, slots)}}
+	return newMessage(embed)
+}
+
+// SlotSummary lists the slots, best first, as text. Times are written with Discord's timestamp
+// markup, so everyone sees them in their own time zone.
+func SlotSummary(plan planman.GroupPlan, slots []planman.Slot) string {
+	if len(slots) == 0 && plan.Participants == 0 {
+		return "Nobody has added their availability yet."
+	}
+	if len(slots) == 0 {
+		// There's availability, but not enough people or not the required ones at once
+		return "No time works for this plan yet."
+	}
+	lines := make([]string, 0, len(slots))
+	for index, slot := range slots {
+		lines = append(lines, fmt.Sprintf("%d. %s, %d available: %s", index+1,
+			timeRange(slot.StartAtUnix, slot.DurationSeconds), len(slot.Users), userNames(slot)))
+	}
+	return truncateField(strings.Join(lines, "\n"))
+}
+
+// newMessage wraps an embed into a message that can't ping anyone
+func newMessage(embed Embed) Message {
+	return Message{
+		Username:        "groupplan",
+		Embeds:          []Embed{embed},
+		AllowedMentions: AllowedMentions{Parse: []string{}},
+	}
+}
+
+// planEmbed returns an embed with what every announcement about a plan has in common
+func planEmbed(plan planman.GroupPlan, link string) Embed {
+	return Embed{
+		URL:       link,
+		Footer:    &EmbedFooter{Text: "Plan " + plan.Identifier},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// dateRange returns the days a plan covers, as Discord date markup. Noon is used, so that the day
+// comes out the same in every time zone.
+func dateRange(plan planman.GroupPlan) string {
+	first := plans.TimeToZeroHour(plan.FromDate).Add(12 * time.Hour)
+	if plan.DurationDays <= 1 {
+		return fmt.Sprintf("<t:%d:D>", first.Unix())
+	}
+	last := first.Add(time.Duration(plan.DurationDays-1) * 24 * time.Hour)
+	return fmt.Sprintf("<t:%d:D> to <t:%d:D>", first.Unix(), last.Unix())
+}
+
+// timeRange returns when something starts and ends, as Discord timestamp markup, and how long it is
+func timeRange(startUnix, durationSecs int64) string {
+	return fmt.Sprintf("<t:%d:f> to <t:%d:t> (%s)", startUnix, startUnix+durationSecs, formatDuration(durationSecs))
+}
+
+// formatDuration returns a short, human-readable duration such as 1h 30m
+func formatDuration(seconds int64) string {
+	hours, minutes := seconds/3600, (seconds%3600)/60
+	switch {
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// userNames returns the names of the users available in a slot, counting the ones past summaryNames
+func userNames(slot planman.Slot) string {
+	names := []string{}
+	for index, user := range slot.Users {
+		if index == summaryNames {
+			names = append(names, fmt.Sprintf("and %d more", len(slot.Users)-summaryNames))
+			break
+		}
+		names = append(names, user.DisplayName)
+	}
+	return strings.Join(names, ", ")
+}
+
+// truncateField shortens text to fit in an embed field, dropping whole lines from the end
+func truncateField(text string) string {
+	for len(text) > maxFieldLength {
+		cut := strings.LastIndex(text, "\n")
+		if cut < 0 {
+			return strings.ToValidUTF8(text[:maxFieldLength-3], "") + "..."
+		}
+		text = text[:cut]
+	}
+	return text
+}
@@ -0,0 +1,139 @@
+package discordbot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// fakeDiscord is a local stand-in for a Discord webhook, collecting the messages posted to it
+func fakeDiscord(t *testing.T) (*httptest.Server, chan discordbot.Message) {
+	received := make(chan discordbot.Message, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := discordbot.Message{}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- message
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// next waits for the next message posted to the fake webhook
+func next(t *testing.T, received chan discordbot.Message) discordbot.Message {
+	select {
+	case message := <-received:
+		require.Len(t, message.Embeds, 1)
+		return message
+	case <-time.After(3 * time.Second):
+		t.Fatal("no message was posted")
+		return discordbot.Message{}
+	}
+}
+
+func TestAnnouncer_PostsQuorumAndFinalTime(t *testing.T) {
+	that := assert.New(t)
+	server, received := fakeDiscord(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	accounts := userman.New(db.Users(), nil)
+	alice, err := accounts.Authenticate("alice@example.com", "", "discord", "1", "Alice")
+	require.NoError(t, err)
+	bob, err := accounts.Authenticate("bob@example.com", "", "discord", "2", "Bob")
+	require.NoError(t, err)
+
+	hub := events.NewHub()
+	planner := planman.New(db.Plans(), hub)
+	plan, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, planman.PlanOptions{Quorum: 2})
+	require.NoError(t, err)
+	// Set directly, as only real Discord URLs get past the planner
+	stored, err := db.Plans().GetPlan(plan.Identifier)
+	require.NoError(t, err)
+	require.NoError(t, db.Plans().SetDiscordWebhook(&stored, server.URL))
+	announcer := discordbot.NewAnnouncer(planner, server.Client(), "https://groupplan.example.com/")
+	announcer.Start(hub)
+	defer announcer.Stop(context.Background())
+
+	start := stored.FromDateZeroHour().Add(20 * time.Hour).Unix()
+	_, err = planner.AddEntry(plan.Identifier, alice, start, 7200)
+	require.NoError(t, err)
+	_, err = planner.AddEntry(plan.Identifier, bob, start+3600, 7200)
+	require.NoError(t, err)
+	quorum := next(t, received).Embeds[0]
+	that.Equal("Game night has enough people", quorum.Title)
+	that.Equal("https://groupplan.example.com/", quorum.URL)
+	if that.Len(quorum.Fields, 1) {
+		summary := strings.Split(quorum.Fields[0].Value, "\n")
+		that.Equal("1. <t:"+strconv.FormatInt(start+3600, 10)+":f> to <t:"+strconv.FormatInt(start+7200, 10)+":t> (1h), 2 available: Alice, Bob", summary[0])
+	}
+
+	_, err = planner.FinalizePlan(plan.Identifier, alice, start+3600, 3600)
+	require.NoError(t, err)
+	final := next(t, received).Embeds[0]
+	that.Equal("Game night is happening", final.Title)
+	that.Contains(final.Description, "<t:"+strconv.FormatInt(start+3600, 10)+":f>")
+	that.Len(received, 0)
+}
+
+func TestPlanCreatedMessage_CannotPing(t *testing.T) {
+	that := assert.New(t)
+	plan := planman.GroupPlan{
+		Identifier:          "abc",
+		Title:               "@everyone party",
+		FromDate:            time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		DurationDays:        3,
+		MinAvailabilitySecs: 5400,
+		Quorum:              4,
+	}
+	plan.Owner.DisplayName = "Alice"
+
+	message := discordbot.PlanCreatedMessage(plan, "https://groupplan.example.com/")
+	encoded, err := json.Marshal(message)
+	require.NoError(t, err)
+	that.Contains(string(encoded), `"allowed_mentions":{"parse":[]}`)
+	if that.Len(message.Embeds, 1) {
+		that.Equal("New plan: @everyone party", message.Embeds[0].Title)
+		that.Equal([]discordbot.EmbedField{
+			{Name: "Dates", Value: "<t:1893499200:D> to <t:1893672000:D>", Inline: true},
+			{Name: "Shortest time", Value: "1h 30m", Inline: true},
+			{Name: "Needs", Value: "4 people", Inline: true},
+		}, message.Embeds[0].Fields)
+	}
+}
+
+func TestPost_RetriesWhenRateLimited(t *testing.T) {
+	that := assert.New(t)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	announcer := discordbot.NewAnnouncer(nil, server.Client(), "")
+	that.NoError(announcer.Post(server.URL, discordbot.Message{Content: "hello"}))
+	that.Equal(2, attempts)
+}
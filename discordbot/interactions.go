@@ -0,0 +1,361 @@
+package discordbot
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// Interaction and interaction response types, as Discord numbers them
+const (
+	InteractionPing    = 1
+	InteractionCommand = 2
+	ResponsePong       = 1
+	ResponseMessage    = 4
+)
+
+// Command option types, as Discord numbers them
+const (
+	optionSubcommand = 1
+	optionString     = 3
+	optionInteger    = 4
+)
+
+const (
+	// flagEphemeral makes a response only visible to the user who sent the command
+	flagEphemeral = 1 << 6
+	// maxTimestampSkew is how old, or how far in the future, a signed interaction can be
+	maxTimestampSkew = 5 * time.Minute
+	// discordProvider is the name of the authentication provider Discord users log in with
+	discordProvider = "discord"
+	// defaultMinMinutes is the shortest availability of plans created without one
+	defaultMinMinutes = 5
+	// maxBestSlots is the most slots /groupplan best lists
+	maxBestSlots = 10
+)
+
+// Interaction is a request Discord sends when someone uses one of our commands
+type Interaction struct {
+	ID    string       `json:"id"`
+	Type  int          `json:"type"`
+	Data  *CommandData `json:"data,omitempty"`
+	Token string       `json:"token"`
+	// Member is who sent the command in a server, User who sent it in a direct message
+	Member *Member      `json:"member,omitempty"`
+	User   *DiscordUser `json:"user,omitempty"`
+}
+
+// CommandData is the command an Interaction is about, along with the options it was given
+type CommandData struct {
+	Name    string          `json:"name"`
+	Options []CommandOption `json:"options,omitempty"`
+}
+
+// CommandOption is an option given to a command, or a subcommand with options of its own
+type CommandOption struct {
+	Name    string          `json:"name"`
+	Type    int             `json:"type"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Options []CommandOption `json:"options,omitempty"`
+}
+
+// Member is a user in a Discord server
+type Member struct {
+	User *DiscordUser `json:"user"`
+}
+
+// DiscordUser is a Discord account
+type DiscordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// InteractionResponse is what we answer an Interaction with
+type InteractionResponse struct {
+	Type int           `json:"type"`
+	Data *ResponseData `json:"data,omitempty"`
+}
+
+// ResponseData is the message an InteractionResponse posts
+type ResponseData struct {
+	Content         string          `json:"content,omitempty"`
+	Embeds          []Embed         `json:"embeds,omitempty"`
+	Flags           int             `json:"flags,omitempty"`
+	AllowedMentions AllowedMentions `json:"allowed_mentions"`
+}
+
+// ApplicationCommand describes a slash command, for registering it with Discord
+type ApplicationCommand struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// ApplicationCommandOption describes an option of a slash command
+type ApplicationCommandOption struct {
+	Type        int                        `json:"type"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Required    bool                       `json:"required,omitempty"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// Command is the /groupplan slash command
+var Command = ApplicationCommand{
+	Name:        "groupplan",
+	Description: "Find a time that works for everyone",
+	Options: []ApplicationCommandOption{
+		{Type: optionSubcommand, Name: "create", Description: "Create a plan", Options: []ApplicationCommandOption{
+			{Type: optionString, Name: "title", Description: "What the plan is for", Required: true},
+			{Type: optionString, Name: "start_date", Description: "The first day of the plan, as yyyy-mm-dd", Required: true},
+			{Type: optionInteger, Name: "days", Description: "How many days the plan covers", Required: true},
+			{Type: optionInteger, Name: "min_minutes", Description: "The shortest time worth getting together for, 5 minutes by default"},
+			{Type: optionInteger, Name: "quorum", Description: "How many people the plan needs"},
+		}},
+		{Type: optionSubcommand, Name: "status", Description: "Show how a plan is going", Options: []ApplicationCommandOption{
+			{Type: optionString, Name: "plan", Description: "The plan's identifier", Required: true},
+		}},
+		{Type: optionSubcommand, Name: "best", Description: "Show the best times for a plan", Options: []ApplicationCommandOption{
+			{Type: optionString, Name: "plan", Description: "The plan's identifier", Required: true},
+			{Type: optionInteger, Name: "count", Description: "How many times to show, 3 by default"},
+		}},
+	},
+}
+
+// ParsePublicKey parses an application's public key, as shown hex-encoded in Discord's developer portal
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("the Discord public key is not hex: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("the Discord public key should be %d bytes, not %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyRequest checks the signature Discord puts on every interaction, from the X-Signature-Ed25519
+// and X-Signature-Timestamp headers and the raw body. Requests signed too long ago are refused too,
+// so a captured request can't be replayed later.
+func VerifyRequest(publicKey ed25519.PublicKey, signature, timestamp string, body []byte, now time.Time) bool {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return false
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(signedAt, 0)); skew > maxTimestampSkew || skew < -maxTimestampSkew {
+		return false
+	}
+	return ed25519.Verify(publicKey, append([]byte(timestamp), body...), decoded)
+}
+
+// Bot answers the /groupplan command, acting as the groupplan user who logged in with the same
+// Discord account as the one using the command
+type Bot struct {
+	planner planman.Planner
+	users   *userman.Manager
+	link    string
+}
+
+// NewBot creates a new Bot, linking its messages to the given URL of the application
+func NewBot(planner planman.Planner, users *userman.Manager, link string) *Bot {
+	return &Bot{
+		planner: planner,
+		users:   users,
+		link:    link,
+	}
+}
+
+// Handle answers an interaction
+func (b *Bot) Handle(interaction Interaction) InteractionResponse {
+	if interaction.Type == InteractionPing {
+		return InteractionResponse{Type: ResponsePong}
+	}
+	if interaction.Type != InteractionCommand || interaction.Data == nil || interaction.Data.Name != Command.Name ||
+		len(interaction.Data.Options) != 1 {
+		return ephemeral("I don't know that command.")
+	}
+
+	discordUser := interaction.User
+	if interaction.Member != nil {
+		discordUser = interaction.Member.User
+	}
+	if discordUser == nil {
+		return ephemeral("I couldn't tell who you are.")
+	}
+	user, err := b.users.GetUserByProviderIdentity(discordProvider, discordUser.ID)
+	if err != nil {
+		if userError, ok := dataerror.As(err); ok && userError.Code == dataerror.CodeNotFound {
+			return ephemeral(fmt.Sprintf("Log in to groupplan with Discord first, at %s", b.link))
+		}
+		return b.failed(err)
+	}
+
+	subcommand := interaction.Data.Options[0]
+	var response InteractionResponse
+	switch subcommand.Name {
+	case "create":
+		response, err = b.create(subcommand.Options, user)
+	case "status":
+		response, err = b.status(subcommand.Options)
+	case "best":
+		response, err = b.best(subcommand.Options)
+	default:
+		return ephemeral("I don't know that command.")
+	}
+	if err != nil {
+		return b.failed(err)
+	}
+	return response
+}
+
+// create is /groupplan create, it creates a plan owned by the user
+func (b *Bot) create(options []CommandOption, user users.User) (InteractionResponse, error) {
+	rawDate := optionText(options, "start_date")
+	startDate, err := time.Parse("2006-1-2", rawDate)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("%s isn't a date I understand, please use yyyy-mm-dd.", rawDate)), nil
+	}
+	minMinutes, ok := optionNumber(options, "min_minutes")
+	if !ok {
+		minMinutes = defaultMinMinutes
+	}
+	days, _ := optionNumber(options, "days")
+	quorum, _ := optionNumber(options, "quorum")
+	if days < 0 || minMinutes < 0 || quorum < 0 {
+		return ephemeral("Numbers can't be negative."), nil
+	}
+
+	plan, err := b.planner.NewPlan(optionText(options, "title"), startDate, uint(days), uint(minMinutes*60), user,
+		planman.PlanOptions{Quorum: uint(quorum)})
+	if err != nil {
+		return InteractionResponse{}, err
+	}
+	message := PlanCreatedMessage(plan, b.link)
+	return public(fmt.Sprintf("Created plan `%s`.", plan.Identifier), message.Embeds...), nil
+}
+
+// status is /groupplan status, it shows how far along a plan is
+func (b *Bot) status(options []CommandOption) (InteractionResponse, error) {
+	identifier := optionText(options, "plan")
+	plan, err := b.planner.GetPlan(identifier)
+	if err != nil {
+		return InteractionResponse{}, err
+	}
+	slots, err := b.planner.BestSlots(identifier, 1)
+	if err != nil {
+		return InteractionResponse{}, err
+	}
+	return public("", StatusEmbed(plan, slots, b.link)), nil
+}
+
+// best is /groupplan best, it lists the best times on a plan
+func (b *Bot) best(options []CommandOption) (InteractionResponse, error) {
+	count, ok := optionNumber(options, "count")
+	if !ok {
+		count = summarySlots
+	}
+	if count < 1 || count > maxBestSlots {
+		return ephemeral(fmt.Sprintf("I can show between 1 and %d times.", maxBestSlots)), nil
+	}
+	identifier := optionText(options, "plan")
+	plan, err := b.planner.GetPlan(identifier)
+	if err != nil {
+		return InteractionResponse{}, err
+	}
+	slots, err := b.planner.BestSlots(identifier, int(count))
+	if err != nil {
+		return InteractionResponse{}, err
+	}
+	embed := planEmbed(plan, b.link)
+	embed.Title = "Best times for " + plan.Title
+	embed.Color = colorBlurple
+	embed.Description = SlotSummary(plan, slots)
+	return public("", embed), nil
+}
+
+// StatusEmbed describes how far along a plan is: who's taking part, whether it has enough people,
+// and the time it was settled on or the best one so far
+func StatusEmbed(plan planman.GroupPlan, slots []planman.Slot, link string) Embed {
+	embed := planEmbed(plan, link)
+	embed.Title = plan.Title
+	embed.Color = colorBlurple
+	people := fmt.Sprintf("%d", plan.Participants)
+	if plan.Quorum > 0 {
+		people = fmt.Sprintf("%d, %d needed at once", plan.Participants, plan.Quorum)
+	}
+	embed.Fields = []EmbedField{
+		{Name: "Dates", Value: dateRange(plan), Inline: true},
+		{Name: "People", Value: people, Inline: true},
+	}
+	if plan.Final != nil {
+		embed.Color = colorYellow
+		embed.Fields = append(embed.Fields, EmbedField{Name: "Happening", Value: timeRange(plan.Final.StartAtUnix, plan.Final.DurationSeconds)})
+	} else {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "Best time so far", Value: SlotSummary(plan, slots)})
+	}
+	return embed
+}
+
+// failed answers with what went wrong, if it's something the user can do anything about
+func (b *Bot) failed(err error) InteractionResponse {
+	if userError, ok := dataerror.As(err); ok {
+		return ephemeral(userError.Message)
+	}
+	if errors.Is(err, userman.ErrDisabled) {
+		return ephemeral(userman.ErrDisabled.Error())
+	}
+	logrus.WithError(err).Error("Failed answering a Discord interaction")
+	return ephemeral("Something went wrong on our end, please try again later.")
+}
+
+// public returns a response everyone in the channel sees
+func public(content string, embeds ...Embed) InteractionResponse {
+	return InteractionResponse{
+		Type: ResponseMessage,
+		Data: &ResponseData{Content: content, Embeds: embeds, AllowedMentions: AllowedMentions{Parse: []string{}}},
+	}
+}
+
+// ephemeral returns a response only the user who sent the command sees
+func ephemeral(content string) InteractionResponse {
+	response := public(content)
+	response.Data.Flags = flagEphemeral
+	return response
+}
+
+// optionText returns the value of a string option, empty if it wasn't given
+func optionText(options []CommandOption, name string) (value string) {
+	for _, option := range options {
+		if option.Name == name {
+			json.Unmarshal(option.Value, &value)
+		}
+	}
+	return value
+}
+
+// optionNumber returns the value of an integer option, and whether it was given
+func optionNumber(options []CommandOption, name string) (int64, bool) {
+	for _, option := range options {
+		if option.Name == name {
+			var value int64
+			if err := json.Unmarshal(option.Value, &value); err == nil {
+				return value, true
+			}
+		}
+	}
+	return 0, false
+}
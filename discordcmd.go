@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/discordbot"
+)
+
+// discordUsage lists the discord subcommands
+const discordUsage = `usage: groupplan discord <command>
+
+  register [guild ID]  register the /groupplan slash command, in one server or everywhere the app is installed`
+
+// runDiscord is the `groupplan discord` command set, for setting up the Discord application
+func runDiscord(cfg config.AppSettings, args []string) error {
+	if len(args) == 0 || args[0] != "register" || len(args) > 2 {
+		return errors.New(discordUsage)
+	}
+	if cfg.DiscordKey == "" || cfg.DiscordSecret == "" {
+		return errors.New("DiscordKey and DiscordSecret must be set in the config")
+	}
+	guildID := ""
+	if len(args) == 2 {
+		guildID = args[1]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := discordbot.RegisterCommands(ctx, discordbot.NewHTTPClient(), cfg.DiscordKey, cfg.DiscordSecret, guildID); err != nil {
+		return err
+	}
+	fmt.Println("Registered the /groupplan command")
+	if cfg.DiscordPublicKey == "" {
+		fmt.Println("Set DiscordPublicKey in the config, or the commands will be refused")
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package events is an in-process publish/subscribe hub, passing changes made to plans on to
+// whoever is watching those plans, such as the live update streams of the HTTP endpoint
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is the kind of change an event describes
+type Type string
+
+// The event types published about plans
+const (
+	PlanCreated   Type = "plan_created"
+	EntryAdded    Type = "entry_added"
+	EntryRemoved  Type = "entry_removed"
+	QuorumReached Type = "quorum_reached"
+	PlanUpdated   Type = "plan_updated"
+	PlanFinalized Type = "plan_finalized"
+	PlanClosed    Type = "plan_closed"
+	PlanDeleted   Type = "plan_deleted"
+	// PresenceChanged is published by the hub itself, when someone starts or stops watching a plan
+	PresenceChanged Type = "presence_changed"
+)
+
+// AllPlans subscribes to the events of every plan
+const AllPlans = ""
+
+const (
+	// historySize is how many of the most recent events are kept, across all plans, for
+	// subscribers catching up on what they missed while reconnecting
+	historySize = 1024
+	// bufferSize is how many events a subscriber can fall behind before it is dropped
+	bufferSize = 64
+)
+
+// Event is a single change made to a plan
+type Event struct {
+	// ID increases with every event published on the hub, it starts over when the process restarts.
+	// Clients outside the process are given StreamID instead, which tells the two apart.
+	ID   uint64
+	Type Type
+	// Plan is the identifier of the plan the event is about
+	Plan string
+	At   time.Time
+	// Data is the event's payload, encoded as JSON when sent to clients
+	Data interface{}
+}
+
+// Hub passes published events on to the subscribers of the plan they're about
+type Hub struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	subscribers map[string]map[*Subscription]struct{}
+	presence    map[string]*presence
+	closed      bool
+	// epoch tells this hub's event IDs apart from those handed out before a restart
+	epoch string
+}
+
+// NewHub creates a new, empty event hub
+func NewHub() *Hub {
+	return &Hub{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: map[string]map[*Subscription]struct{}{},
+		presence:    map[string]*presence{},
+	}
+}
+
+// Publish sends an event about the given plan to everyone subscribed to it. It never blocks,
+// subscribers that have fallen too far behind are dropped instead.
+func (h *Hub) Publish(plan string, eventType Type, data interface{}) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.publish(plan, eventType, data)
+}
+
+// publish is Publish, with the lock held
+func (h *Hub) publish(plan string, eventType Type, data interface{}) Event {
+	h.lastID++
+	event := Event{
+		ID:   h.lastID,
+		Type: eventType,
+		Plan: plan,
+		At:   time.Now(),
+		Data: data,
+	}
+	if len(h.history) == historySize {
+		copy(h.history, h.history[1:])
+		h.history = h.history[:historySize-1]
+	}
+	h.history = append(h.history, event)
+
+	for _, topic := range []string{plan, AllPlans} {
+		for sub := range h.subscribers[topic] {
+			select {
+			case sub.events <- event:
+			default:
+				// The subscriber can catch up from the history once it reconnects
+				h.remove(sub)
+			}
+		}
+	}
+	return event
+}
+
+// Subscribe starts receiving the events published about a plan, or every plan with AllPlans. When
+// lastEventID is not zero, the events about the plan published after it are returned as missed.
+// complete is false when some of those are no longer kept, or lastEventID was never handed out,
+// and the subscriber should reload the plan instead.
+func (h *Hub) Subscribe(plan string, lastEventID uint64) (sub *Subscription, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub = &Subscription{
+		hub:     h,
+		plan:    plan,
+		startID: h.lastID,
+		events:  make(chan Event, bufferSize),
+	}
+	if h.closed {
+		close(sub.events)
+		return sub, nil, true
+	}
+	if h.subscribers[plan] == nil {
+		h.subscribers[plan] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[plan][sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+	// Unless the oldest kept event directly follows the last one seen, some could be gone
+	complete = lastEventID <= h.lastID && (len(h.history) == 0 || h.history[0].ID <= lastEventID+1)
+	for _, event := range h.history {
+		if event.ID > lastEventID && (plan == AllPlans || event.Plan == plan) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Resume is Subscribe for clients outside the process, which identify the last event they've seen
+// by its StreamID. An ID from before a restart, or one that can't be read, is never complete.
+func (h *Hub) Resume(plan, lastStreamID string) (sub *Subscription, missed []Event, complete bool) {
+	if lastStreamID == "" {
+		return h.Subscribe(plan, 0)
+	}
+	epoch, rawID := "", ""
+	if split := strings.LastIndexByte(lastStreamID, '-'); split != -1 {
+		epoch, rawID = lastStreamID[:split], lastStreamID[split+1:]
+	}
+	lastEventID, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil || epoch != h.epoch || lastEventID == 0 {
+		sub, _, _ = h.Subscribe(plan, 0)
+		return sub, nil, false
+	}
+	return h.Subscribe(plan, lastEventID)
+}
+
+// StreamID returns the ID given to clients outside the process for the event with the given ID.
+// Unlike the ID itself, it's never reused after a restart.
+func (h *Hub) StreamID(id uint64) string {
+	return fmt.Sprintf("%s-%d", h.epoch, id)
+}
+
+// Close drops every subscriber, and any subscribing from then on. Used when shutting down, so that
+// long-lived streams end.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// remove drops a subscriber, closing its channel. The lock must be held.
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.subscribers[sub.plan]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.plan)
+	}
+	close(sub.events)
+}
+
+// Subscription receives the events of a single plan
+type Subscription struct {
+	hub     *Hub
+	plan    string
+	startID uint64
+	events  chan Event
+}
+
+// Events returns the channel the events arrive on. It's closed when the subscriber is dropped,
+// either because it fell behind or the hub was closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// StartID returns the ID of the latest event published before subscribing
+func (s *Subscription) StartID() uint64 {
+	return s.startID
+}
+
+// Close stops receiving events. Calling it more than once is fine.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
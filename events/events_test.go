@@ -0,0 +1,153 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/events"
+)
+
+func TestHub_DeliversToPlanSubscribers(t *testing.T) {
+	that := assert.New(t)
+	hub := events.NewHub()
+	sub, missed, complete := hub.Subscribe("abc", 0)
+	defer sub.Close()
+	that.Empty(missed)
+	that.True(complete)
+
+	hub.Publish("other", events.EntryAdded, nil)
+	published := hub.Publish("abc", events.EntryRemoved, nil)
+
+	received := <-sub.Events()
+	that.Equal(published.ID, received.ID)
+	that.Equal(events.EntryRemoved, received.Type)
+	that.Len(sub.Events(), 0)
+}
+
+func TestHub_ReplaysMissedEvents(t *testing.T) {
+	that := assert.New(t)
+	hub := events.NewHub()
+	first := hub.Publish("abc", events.EntryAdded, nil)
+	hub.Publish("other", events.EntryAdded, nil)
+	third := hub.Publish("abc", events.EntryRemoved, nil)
+
+	sub, missed, complete := hub.Subscribe("abc", first.ID)
+	defer sub.Close()
+	that.True(complete)
+	if that.Len(missed, 1) {
+		that.Equal(third.ID, missed[0].ID)
+	}
+
+	// An ID the hub never handed out, such as one from before a restart
+	_, _, complete = hub.Subscribe("abc", third.ID+10)
+	that.False(complete)
+}
+
+func TestHub_DropsSlowSubscribers(t *testing.T) {
+	that := assert.New(t)
+	hub := events.NewHub()
+	sub, _, _ := hub.Subscribe("abc", 0)
+	for i := 0; i < 100; i++ {
+		hub.Publish("abc", events.EntryAdded, nil)
+	}
+
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+	that.Less(received, 100)
+
+	// Reconnecting catches up on the rest
+	_, missed, complete := hub.Subscribe("abc", uint64(received))
+	that.True(complete)
+	that.Len(missed, 100-received)
+}
+
+func TestHub_CloseEndsSubscriptions(t *testing.T) {
+	that := assert.New(t)
+	hub := events.NewHub()
+	sub, _, _ := hub.Subscribe("abc", 0)
+	hub.Close()
+	_, open := <-sub.Events()
+	that.False(open)
+	sub.Close()
+
+	late, _, _ := hub.Subscribe("abc", 0)
+	_, open = <-late.Events()
+	that.False(open)
+}
+
+func TestHub_PresenceCountsConnections(t *testing.T) {
+	that := assert.New(t)
+	hub := events.NewHub()
+	sub, _, _ := hub.Subscribe("abc", 0)
+	defer sub.Close()
+
+	hub.Join("abc", 1, "alice")
+	hub.Join("abc", 1, "alice")
+	hub.Join("abc", 2, "bob")
+	that.Equal([]interface{}{"alice", "bob"}, hub.Present("abc"))
+
+	// Only the last connection of a user leaving counts
+	hub.Leave("abc", 1)
+	that.Equal([]interface{}{"alice", "bob"}, hub.Present("abc"))
+	hub.Leave("abc", 1)
+	that.Equal([]interface{}{"bob"}, hub.Present("abc"))
+
+	changes := 0
+	for len(sub.Events()) > 0 {
+		that.Equal(events.PresenceChanged, (<-sub.Events()).Type)
+		changes++
+	}
+	that.Equal(3, changes)
+}
+
+func TestHub_Resume_AfterRestart_IsIncomplete(t *testing.T) {
+	that := assert.New(t)
+	before := events.NewHub()
+	seen := before.Publish("abc", events.EntryAdded, nil)
+	lastStreamID := before.StreamID(seen.ID)
+
+	// The same hub resumes where the client left off
+	sub, missed, complete := before.Resume("abc", lastStreamID)
+	sub.Close()
+	that.True(complete)
+	that.Empty(missed)
+
+	// After a restart, the new hub has handed out IDs of its own, the same numbers included
+	after := events.NewHub()
+	after.Publish("abc", events.EntryAdded, nil)
+	after.Publish("abc", events.EntryRemoved, nil)
+	sub, missed, complete = after.Resume("abc", lastStreamID)
+	sub.Close()
+	that.False(complete)
+	that.Empty(missed)
+
+	for _, unreadable := range []string{"42", "abc", "-", before.StreamID(0)} {
+		sub, _, complete = after.Resume("abc", unreadable)
+		sub.Close()
+		that.False(complete, unreadable)
+	}
+}
+
+func TestHub_Follow_CatchesUpAfterBeingDropped(t *testing.T) {
+	that := assert.New(t)
+	hub := events.NewHub()
+	stop := make(chan struct{})
+	lost := false
+	followed := hub.Follow(stop, func(uint64) { lost = true })
+
+	// Nothing is read while these are published, so the follower falls behind and is dropped
+	for i := 0; i < 100; i++ {
+		hub.Publish("abc", events.EntryAdded, nil)
+	}
+	for id := uint64(1); id <= 100; id++ {
+		event := <-followed
+		that.Equal(id, event.ID)
+	}
+	that.False(lost)
+
+	close(stop)
+	_, open := <-followed
+	that.False(open)
+}
@@ -0,0 +1,62 @@
+package events
+
+import "time"
+
+// resubscribeDelay is how long Follow waits before subscribing again after being dropped
+const resubscribeDelay = time.Second
+
+// Follow passes on the events of every plan published from now on, in order, until stop is
+// closed, after which the returned channel is closed. It subscribes before returning, so no event
+// published after Follow returns is missed. When dropped by the hub, for falling behind or because
+// the hub was closed, it subscribes again a second later and passes on what it missed in between.
+// If some of that is no longer kept, lost is called with the ID of the last event passed on.
+func (h *Hub) Follow(stop <-chan struct{}, lost func(lastID uint64)) <-chan Event {
+	sub, _, _ := h.Subscribe(AllPlans, 0)
+	followed := make(chan Event)
+	go func() {
+		defer close(followed)
+		defer func() { sub.Close() }()
+		lastID := sub.StartID()
+		pass := func(event Event) bool {
+			select {
+			case <-stop:
+				return false
+			case followed <- event:
+				lastID = event.ID
+				return true
+			}
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case event, open := <-sub.Events():
+				if open {
+					if !pass(event) {
+						return
+					}
+					continue
+				}
+			}
+			// Dropped by the hub
+			select {
+			case <-stop:
+				return
+			case <-time.After(resubscribeDelay):
+			}
+			sub.Close()
+			var missed []Event
+			var complete bool
+			sub, missed, complete = h.Subscribe(AllPlans, lastID)
+			if !complete {
+				lost(lastID)
+			}
+			for _, event := range missed {
+				if !pass(event) {
+					return
+				}
+			}
+		}
+	}()
+	return followed
+}
@@ -0,0 +1,74 @@
+package events
+
+// presence is who's watching a single plan, in the order they started
+type presence struct {
+	order []uint
+	// connections counts the connections of each user, as one user can watch from several places
+	connections map[uint]int
+	info        map[uint]interface{}
+}
+
+// Join marks a user as watching the plan until Leave is called. info describes the user to the
+// others watching. The first join of a user publishes a PresenceChanged event, with the info of
+// everyone watching as its data.
+func (h *Hub) Join(plan string, userID uint, info interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	watching := h.presence[plan]
+	if watching == nil {
+		watching = &presence{connections: map[uint]int{}, info: map[uint]interface{}{}}
+		h.presence[plan] = watching
+	}
+	watching.connections[userID]++
+	watching.info[userID] = info
+	if watching.connections[userID] == 1 {
+		watching.order = append(watching.order, userID)
+		h.publish(plan, PresenceChanged, watching.list())
+	}
+}
+
+// Leave undoes a Join. Once the user has no connections left, a PresenceChanged event is published.
+func (h *Hub) Leave(plan string, userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	watching := h.presence[plan]
+	if watching == nil || watching.connections[userID] == 0 {
+		return
+	}
+	watching.connections[userID]--
+	if watching.connections[userID] > 0 {
+		return
+	}
+	delete(watching.connections, userID)
+	delete(watching.info, userID)
+	for index, id := range watching.order {
+		if id == userID {
+			watching.order = append(watching.order[:index], watching.order[index+1:]...)
+			break
+		}
+	}
+	if len(watching.order) == 0 {
+		delete(h.presence, plan)
+	}
+	h.publish(plan, PresenceChanged, watching.list())
+}
+
+// Present returns the info of everyone watching a plan
+func (h *Hub) Present(plan string) []interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	watching := h.presence[plan]
+	if watching == nil {
+		return []interface{}{}
+	}
+	return watching.list()
+}
+
+// list returns the info of everyone watching, in the order they started
+func (p *presence) list() []interface{} {
+	infos := make([]interface{}, len(p.order))
+	for index, id := range p.order {
+		infos[index] = p.info[id]
+	}
+	return infos
+}
@@ -0,0 +1,24 @@
+// Package frontend bundles the groupplan HTML pages and whatever is in static into the binary. The
+// Vue application in vue is built into static/js, so it's only included if it was built first.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embedded contains the frontend files as they were when the binary was built
+//
+//go:embed login.html dashboard.html static
+var embedded embed.FS
+
+// FS returns the frontend files, rooted at the frontend directory. If dir is not empty, the files
+// are instead read from that directory on disk on every access, which allows live editing during
+// development without rebuilding the binary.
+func FS(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return embedded
+}
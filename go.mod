@@ -1,18 +1,20 @@
 module github.com/wallnutkraken/groupplan
 
-go 1.15
+go 1.16
 
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
-	github.com/gin-gonic/autotls v0.0.3
 	github.com/gin-gonic/gin v1.6.3
 	github.com/google/uuid v1.1.2
 	github.com/lytics/base62 v0.0.0-20180808010106-0ee4de5a5d6d
 	github.com/markbates/goth v1.65.0
-	github.com/pkg/errors v0.9.1
+	github.com/mattn/go-sqlite3 v1.14.8 // indirect
+	github.com/prometheus/client_golang v1.9.0
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	golang.org/x/net v0.0.0-20200930145003-4acb6c075d10
+	gorm.io/driver/postgres v1.0.4
 	gorm.io/driver/sqlite v1.1.3
 	gorm.io/gorm v1.20.2
 )
@@ -0,0 +1,560 @@
+package groupdata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/groupdata/webhooks"
+	"gorm.io/gorm"
+)
+
+// DumpFormatVersion is the version of the JSON dump format written by Dump
+const DumpFormatVersion = 1
+
+// ErrNotSQLite is returned by operations that only make sense on a SQLite database
+var ErrNotSQLite = errors.New("operation is only supported on sqlite databases")
+
+// Dump is the portable, database-independent JSON representation of all groupplan data
+type Dump struct {
+	FormatVersion int             `json:"format_version"`
+	SchemaVersion uint            `json:"schema_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Providers     []DumpProvider  `json:"providers"`
+	Users         []DumpUser      `json:"users"`
+	AuthPoints    []DumpAuthPoint `json:"auth_points"`
+	Plans         []DumpPlan      `json:"plans"`
+	Entries       []DumpPlanEntry `json:"entries"`
+	APITokens     []DumpAPIToken  `json:"api_tokens"`
+	Webhooks      []DumpWebhook   `json:"webhooks"`
+	// NotificationPreferences are missing from dumps made before they existed
+	NotificationPreferences []DumpNotificationPreference `json:"notification_preferences,omitempty"`
+	// PlanMembers and Jobs are missing from dumps made before they existed
+	PlanMembers []DumpPlanMember `json:"plan_members,omitempty"`
+	Jobs        []DumpJob        `json:"jobs,omitempty"`
+}
+
+// DumpProvider is an authentication provider in a Dump
+type DumpProvider struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// DumpUser is a user in a Dump
+type DumpUser struct {
+	ID                uint      `json:"id"`
+	CreatedAt         time.Time `json:"created_at"`
+	Email             string    `json:"email"`
+	DisplayName       string    `json:"display_name"`
+	ProfilePictureURL string    `json:"profile_picture_url"`
+	IsAdmin           bool      `json:"is_admin"`
+	Disabled          bool      `json:"disabled"`
+	// NotificationWebhookURL and NotificationKey are missing from dumps made before they existed
+	NotificationWebhookURL string `json:"notification_webhook_url,omitempty"`
+	NotificationKey        string `json:"notification_key,omitempty"`
+}
+
+// DumpAuthPoint is a user's authentication point in a Dump
+type DumpAuthPoint struct {
+	ID         uint   `json:"id"`
+	UserID     uint   `json:"user_id"`
+	ProviderID uint   `json:"provider_id"`
+	Identifier string `json:"identifier"`
+}
+
+// DumpNotificationPreference is a user's notification preference in a Dump. Notifications waiting
+// for a digest aren't dumped.
+type DumpNotificationPreference struct {
+	ID      uint   `json:"id"`
+	UserID  uint   `json:"user_id"`
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Digest  bool   `json:"digest"`
+}
+
+// DumpAPIToken is a user's API token in a Dump, only the hash of the token is known
+type DumpAPIToken struct {
+	ID         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"token_hash"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// DumpPlan is a plan in a Dump
+type DumpPlan struct {
+	ID                         uint       `json:"id"`
+	CreatedAt                  time.Time  `json:"created_at"`
+	OwnerID                    uint       `json:"owner_id"`
+	Identifier                 string     `json:"identifier"`
+	Title                      string     `json:"title"`
+	FromDate                   time.Time  `json:"from_date"`
+	DurationDays               uint       `json:"duration_days"`
+	MinimumAvailabilitySeconds uint       `json:"minimum_availability_seconds"`
+	DiscordWebhookURL          string     `json:"discord_webhook_url,omitempty"`
+	Quorum                     uint       `json:"quorum,omitempty"`
+	QuorumReachedAt            *time.Time `json:"quorum_reached_at,omitempty"`
+	FinalStartUnix             int64      `json:"final_start_unix,omitempty"`
+	FinalDurationSeconds       int64      `json:"final_duration_seconds,omitempty"`
+	FinalizedAt                *time.Time `json:"finalized_at,omitempty"`
+	ResponseDeadline           *time.Time `json:"response_deadline,omitempty"`
+	ClosedAt                   *time.Time `json:"closed_at,omitempty"`
+	AutoFinalize               bool       `json:"auto_finalize,omitempty"`
+}
+
+// DumpPlanMember is a user who joined a plan in a Dump
+type DumpPlanMember struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	PlanID    uint      `json:"plan_id"`
+	UserID    uint      `json:"user_id"`
+	Required  bool      `json:"required,omitempty"`
+}
+
+// DumpJob is a job scheduled on a plan in a Dump. Only pending jobs are dumped.
+type DumpJob struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	PlanID     uint      `json:"plan_id"`
+	Kind       string    `json:"kind"`
+	TargetTime time.Time `json:"target_time"`
+	Attempts   uint      `json:"attempts"`
+}
+
+// DumpPlanEntry is a plan availability entry in a Dump
+type DumpPlanEntry struct {
+	ID              uint      `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	PlanID          uint      `json:"plan_id"`
+	UserID          uint      `json:"user_id"`
+	StartTimeUnix   int64     `json:"start_time_unix"`
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+// DumpWebhook is a webhook registered on a plan in a Dump. The log of deliveries isn't dumped.
+type DumpWebhook struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	PlanID    uint      `json:"plan_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    string    `json:"events"`
+}
+
+// Snapshot writes a consistent copy of a SQLite database to the given path using VACUUM INTO,
+// which is safe to do while the server is running and writing. The path must not exist yet.
+func (d Data) Snapshot(path string) error {
+	if d.db.Dialector.Name() != DriverSQLite {
+		return ErrNotSQLite
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("snapshot target [%s] already exists", path)
+	}
+	// Write to a temporary file first, so a half-written snapshot never has the final name
+	tempPath := path + ".partial"
+	os.Remove(tempPath)
+	if err := d.db.Exec("VACUUM INTO ?", tempPath).Error; err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed creating snapshot: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed moving snapshot into place: %w", err)
+	}
+	return nil
+}
+
+// Verify checks that the database is intact and that its schema is not newer than this version
+// of groupplan supports
+func (d Data) Verify() error {
+	migrator, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := migrator.Check(); err != nil {
+		return err
+	}
+	if d.db.Dialector.Name() == DriverSQLite {
+		result := ""
+		if err := d.db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+			return fmt.Errorf("failed checking database integrity: %w", err)
+		}
+		if result != "ok" {
+			return fmt.Errorf("database integrity check failed: %s", result)
+		}
+	}
+	return nil
+}
+
+// Dump writes every provider, user, notification preference, API token, plan, entry, member,
+// webhook and pending job as a portable JSON document. All of it is read in a single transaction, so the dump is consistent.
+func (d Data) Dump(w io.Writer) error {
+	migrator, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+	schemaVersion, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+	dump := Dump{
+		FormatVersion: DumpFormatVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		providers := []users.AuthenticationProvider{}
+		if err := tx.Order("id").Find(&providers).Error; err != nil {
+			return fmt.Errorf("failed reading providers: %w", err)
+		}
+		for _, provider := range providers {
+			dump.Providers = append(dump.Providers, DumpProvider{ID: provider.ID, Name: provider.Name})
+		}
+
+		allUsers := []users.User{}
+		if err := tx.Order("id").Find(&allUsers).Error; err != nil {
+			return fmt.Errorf("failed reading users: %w", err)
+		}
+		for _, user := range allUsers {
+			dump.Users = append(dump.Users, DumpUser{
+				ID:                     user.ID,
+				CreatedAt:              user.CreatedAt,
+				Email:                  user.Email,
+				DisplayName:            user.DisplayName,
+				ProfilePictureURL:      user.ProfilePictureURL,
+				IsAdmin:                user.IsAdmin,
+				Disabled:               user.Disabled,
+				NotificationWebhookURL: user.NotificationWebhookURL,
+				NotificationKey:        user.NotificationKey,
+			})
+		}
+
+		authPoints := []users.UserAuthPoint{}
+		if err := tx.Order("id").Find(&authPoints).Error; err != nil {
+			return fmt.Errorf("failed reading auth points: %w", err)
+		}
+		for _, point := range authPoints {
+			dump.AuthPoints = append(dump.AuthPoints, DumpAuthPoint{
+				ID:         point.ID,
+				UserID:     point.UserID,
+				ProviderID: point.ProviderID,
+				Identifier: point.Identifier,
+			})
+		}
+
+		preferences := []users.NotificationPreference{}
+		if err := tx.Order("id").Find(&preferences).Error; err != nil {
+			return fmt.Errorf("failed reading notification preferences: %w", err)
+		}
+		for _, preference := range preferences {
+			dump.NotificationPreferences = append(dump.NotificationPreferences, DumpNotificationPreference{
+				ID:      preference.ID,
+				UserID:  preference.UserID,
+				Event:   preference.Event,
+				Channel: preference.Channel,
+				Digest:  preference.Digest,
+			})
+		}
+
+		tokens := []users.APIToken{}
+		if err := tx.Order("id").Find(&tokens).Error; err != nil {
+			return fmt.Errorf("failed reading API tokens: %w", err)
+		}
+		for _, token := range tokens {
+			dump.APITokens = append(dump.APITokens, DumpAPIToken{
+				ID:         token.ID,
+				CreatedAt:  token.CreatedAt,
+				UserID:     token.UserID,
+				Name:       token.Name,
+				TokenHash:  token.TokenHash,
+				LastUsedAt: token.LastUsedAt,
+			})
+		}
+
+		allPlans := []plans.Plan{}
+		if err := tx.Order("id").Find(&allPlans).Error; err != nil {
+			return fmt.Errorf("failed reading plans: %w", err)
+		}
+		for _, plan := range allPlans {
+			dump.Plans = append(dump.Plans, DumpPlan{
+				ID:                         plan.ID,
+				CreatedAt:                  plan.CreatedAt,
+				OwnerID:                    plan.OwnerID,
+				Identifier:                 plan.Identifier,
+				Title:                      plan.Title,
+				FromDate:                   plan.FromDate,
+				DurationDays:               plan.DurationDays,
+				MinimumAvailabilitySeconds: plan.MinimumAvailabilitySeconds,
+				DiscordWebhookURL:          plan.DiscordWebhookURL,
+				Quorum:                     plan.Quorum,
+				QuorumReachedAt:            plan.QuorumReachedAt,
+				FinalStartUnix:             plan.FinalStartUnix,
+				FinalDurationSeconds:       plan.FinalDurationSeconds,
+				FinalizedAt:                plan.FinalizedAt,
+				ResponseDeadline:           plan.ResponseDeadline,
+				ClosedAt:                   plan.ClosedAt,
+				AutoFinalize:               plan.AutoFinalize,
+			})
+		}
+
+		// Entries of deleted plans are left behind by soft deletion, skip those
+		entries := []plans.PlanEntry{}
+		if err := tx.Joins("JOIN plans ON plans.id = plan_entries.plan_id AND plans.deleted_at IS NULL").
+			Order("plan_entries.id").Find(&entries).Error; err != nil {
+			return fmt.Errorf("failed reading entries: %w", err)
+		}
+		for _, entry := range entries {
+			dump.Entries = append(dump.Entries, DumpPlanEntry{
+				ID:              entry.ID,
+				CreatedAt:       entry.CreatedAt,
+				PlanID:          entry.PlanID,
+				UserID:          entry.UserID,
+				StartTimeUnix:   entry.StartTimeUnix,
+				DurationSeconds: entry.DurationSeconds,
+			})
+		}
+
+		members := []plans.PlanMember{}
+		if err := tx.Joins("JOIN plans ON plans.id = plan_members.plan_id AND plans.deleted_at IS NULL").
+			Order("plan_members.id").Find(&members).Error; err != nil {
+			return fmt.Errorf("failed reading plan members: %w", err)
+		}
+		for _, member := range members {
+			dump.PlanMembers = append(dump.PlanMembers, DumpPlanMember{
+				ID:        member.ID,
+				CreatedAt: member.CreatedAt,
+				PlanID:    member.PlanID,
+				UserID:    member.UserID,
+				Required:  member.Required,
+			})
+		}
+
+		pending := []jobs.Job{}
+		if err := tx.Where(jobs.Job{Status: jobs.StatusPending}).Order("id").Find(&pending).Error; err != nil {
+			return fmt.Errorf("failed reading jobs: %w", err)
+		}
+		for _, job := range pending {
+			dump.Jobs = append(dump.Jobs, DumpJob{
+				ID:         job.ID,
+				CreatedAt:  job.CreatedAt,
+				PlanID:     job.PlanID,
+				Kind:       job.Kind,
+				TargetTime: job.TargetTime,
+				Attempts:   job.Attempts,
+			})
+		}
+
+		hooks := []webhooks.Webhook{}
+		if err := tx.Joins("JOIN plans ON plans.id = webhooks.plan_id AND plans.deleted_at IS NULL").
+			Order("webhooks.id").Find(&hooks).Error; err != nil {
+			return fmt.Errorf("failed reading webhooks: %w", err)
+		}
+		for _, hook := range hooks {
+			dump.Webhooks = append(dump.Webhooks, DumpWebhook{
+				ID:        hook.ID,
+				CreatedAt: hook.CreatedAt,
+				PlanID:    hook.PlanID,
+				URL:       hook.URL,
+				Secret:    hook.Secret,
+				Events:    hook.Events,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(dump)
+}
+
+// Restore reads a JSON document written by Dump and inserts its contents, keeping all IDs. The
+// database must be fully migrated and contain no users or plans yet. Everything is restored in a
+// single transaction, so a failed restore leaves the database untouched.
+func (d Data) Restore(r io.Reader) error {
+	dump := Dump{}
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return fmt.Errorf("failed reading dump: %w", err)
+	}
+	if dump.FormatVersion != DumpFormatVersion {
+		return fmt.Errorf("unsupported dump format version %d, expected %d", dump.FormatVersion, DumpFormatVersion)
+	}
+	migrator, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+	if dump.SchemaVersion > migrator.Latest() {
+		return fmt.Errorf("dump was made with schema version %d, this groupplan only knows up to %d", dump.SchemaVersion, migrator.Latest())
+	}
+	if pending, err := migrator.Pending(); err != nil || len(pending) != 0 {
+		return errors.New("the database must be fully migrated before restoring into it")
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&users.User{}).Unscoped().Count(&existing).Error; err != nil {
+			return fmt.Errorf("failed checking for existing users: %w", err)
+		}
+		if existing != 0 {
+			return errors.New("the database already contains users, restore into an empty database")
+		}
+
+		// Providers are seeded by migrations, so match them up by name rather than by ID
+		providerIDs := map[uint]uint{}
+		for _, provider := range dump.Providers {
+			local := users.AuthenticationProvider{}
+			if err := tx.Where(users.AuthenticationProvider{Name: provider.Name}).FirstOrCreate(&local).Error; err != nil {
+				return fmt.Errorf("failed restoring provider [%s]: %w", provider.Name, err)
+			}
+			providerIDs[provider.ID] = local.ID
+		}
+
+		for _, user := range dump.Users {
+			record := users.User{
+				Model:                  gorm.Model{ID: user.ID, CreatedAt: user.CreatedAt},
+				Email:                  user.Email,
+				DisplayName:            user.DisplayName,
+				ProfilePictureURL:      user.ProfilePictureURL,
+				IsAdmin:                user.IsAdmin,
+				Disabled:               user.Disabled,
+				NotificationWebhookURL: user.NotificationWebhookURL,
+				NotificationKey:        user.NotificationKey,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring user [%d]: %w", user.ID, err)
+			}
+		}
+		for _, preference := range dump.NotificationPreferences {
+			record := users.NotificationPreference{
+				ID:      preference.ID,
+				UserID:  preference.UserID,
+				Event:   preference.Event,
+				Channel: preference.Channel,
+				Digest:  preference.Digest,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring notification preference [%d]: %w", preference.ID, err)
+			}
+		}
+		for _, point := range dump.AuthPoints {
+			providerID, known := providerIDs[point.ProviderID]
+			if !known {
+				return fmt.Errorf("auth point [%d] references unknown provider [%d]", point.ID, point.ProviderID)
+			}
+			record := users.UserAuthPoint{
+				ID:         point.ID,
+				UserID:     point.UserID,
+				ProviderID: providerID,
+				Identifier: point.Identifier,
+			}
+			if err := tx.Omit("Provider").Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring auth point [%d]: %w", point.ID, err)
+			}
+		}
+		for _, token := range dump.APITokens {
+			record := users.APIToken{
+				ID:         token.ID,
+				CreatedAt:  token.CreatedAt,
+				UserID:     token.UserID,
+				Name:       token.Name,
+				TokenHash:  token.TokenHash,
+				LastUsedAt: token.LastUsedAt,
+			}
+			if err := tx.Omit("User").Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring API token [%d]: %w", token.ID, err)
+			}
+		}
+		for _, plan := range dump.Plans {
+			record := plans.Plan{
+				Model:                      gorm.Model{ID: plan.ID, CreatedAt: plan.CreatedAt},
+				OwnerID:                    plan.OwnerID,
+				Identifier:                 plan.Identifier,
+				Title:                      plan.Title,
+				FromDate:                   plan.FromDate,
+				DurationDays:               plan.DurationDays,
+				MinimumAvailabilitySeconds: plan.MinimumAvailabilitySeconds,
+				DiscordWebhookURL:          plan.DiscordWebhookURL,
+				Quorum:                     plan.Quorum,
+				QuorumReachedAt:            plan.QuorumReachedAt,
+				FinalStartUnix:             plan.FinalStartUnix,
+				FinalDurationSeconds:       plan.FinalDurationSeconds,
+				FinalizedAt:                plan.FinalizedAt,
+				ResponseDeadline:           plan.ResponseDeadline,
+				ClosedAt:                   plan.ClosedAt,
+				AutoFinalize:               plan.AutoFinalize,
+			}
+			if err := tx.Omit("Owner").Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring plan [%s]: %w", plan.Identifier, err)
+			}
+		}
+		for _, entry := range dump.Entries {
+			record := plans.PlanEntry{
+				Model:           gorm.Model{ID: entry.ID, CreatedAt: entry.CreatedAt},
+				PlanID:          entry.PlanID,
+				UserID:          entry.UserID,
+				StartTimeUnix:   entry.StartTimeUnix,
+				DurationSeconds: entry.DurationSeconds,
+			}
+			if err := tx.Omit("User").Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring entry [%d]: %w", entry.ID, err)
+			}
+		}
+		for _, member := range dump.PlanMembers {
+			record := plans.PlanMember{
+				ID:        member.ID,
+				CreatedAt: member.CreatedAt,
+				PlanID:    member.PlanID,
+				UserID:    member.UserID,
+				Required:  member.Required,
+			}
+			if err := tx.Omit("User").Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring plan member [%d]: %w", member.ID, err)
+			}
+		}
+		for _, job := range dump.Jobs {
+			record := jobs.Job{
+				ID:         job.ID,
+				CreatedAt:  job.CreatedAt,
+				PlanID:     job.PlanID,
+				Kind:       job.Kind,
+				TargetTime: job.TargetTime,
+				Status:     jobs.StatusPending,
+				Attempts:   job.Attempts,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring job [%d]: %w", job.ID, err)
+			}
+		}
+		for _, hook := range dump.Webhooks {
+			record := webhooks.Webhook{
+				Model:  gorm.Model{ID: hook.ID, CreatedAt: hook.CreatedAt},
+				PlanID: hook.PlanID,
+				URL:    hook.URL,
+				Secret: hook.Secret,
+				Events: hook.Events,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed restoring webhook [%d]: %w", hook.ID, err)
+			}
+		}
+
+		// Postgres doesn't move its ID sequences along when IDs are inserted explicitly
+		if tx.Dialector.Name() == DriverPostgres {
+			for _, table := range []string{"users", "user_auth_points", "notification_preferences", "api_tokens", "plans", "plan_entries", "plan_members", "webhooks", "jobs"} {
+				if err := tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s", table, table)).Error; err != nil {
+					return fmt.Errorf("failed resetting the ID sequence of [%s]: %w", table, err)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -1,12 +1,29 @@
 // Package dataerror contains error types for specific data-related errors, the messages of which should be returned to the user
 package dataerror
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+)
+
+// Machine-readable error codes, returned to API consumers along with the message
+const (
+	CodeInvalid         = "invalid"
+	CodeValidation      = "validation_failed"
+	CodeBadRequest      = "bad_request"
+	CodeNotFound        = "not_found"
+	CodeUnauthenticated = "unauthenticated"
+	CodeForbidden       = "forbidden"
+	CodeConflict        = "conflict"
+)
 
 // BaseError is the base error struct for the dataerror package, to be embedded in every other error
 type BaseError struct {
 	Message string
 	Status  int
+	Code    string
+	// Field is the name of the request field the error is about, if any
+	Field string
 }
 
 // ErrBasic returns BaseError with the message provided
@@ -14,6 +31,7 @@ func ErrBasic(message string) error {
 	return BaseError{
 		Message: message,
 		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeInvalid,
 	}
 }
 
@@ -27,12 +45,60 @@ func (b BaseError) StatusCode() int {
 	return b.Status
 }
 
+// base returns the BaseError itself, and through embedding, the BaseError of every other error type
+func (b BaseError) base() BaseError {
+	return b
+}
+
+// As finds the first error of this package in the chain of err, whichever type it is, and returns
+// its BaseError
+func As(err error) (BaseError, bool) {
+	var userError interface{ base() BaseError }
+	if errors.As(err, &userError) {
+		return userError.base(), true
+	}
+	return BaseError{}, false
+}
+
+// Validation is the error for a request field with an invalid value
+type Validation struct {
+	BaseError
+}
+
+// ErrField returns a Validation error about the given request field
+func ErrField(field, message string) error {
+	return Validation{
+		BaseError: BaseError{
+			Message: message,
+			Status:  http.StatusUnprocessableEntity,
+			Code:    CodeValidation,
+			Field:   field,
+		},
+	}
+}
+
+// BadRequest is the error for requests that can't be understood at all, such as malformed JSON
+type BadRequest struct {
+	BaseError
+}
+
+// ErrBadRequest returns a BadRequest error with the given message
+func ErrBadRequest(message string) error {
+	return BadRequest{
+		BaseError: BaseError{
+			Message: message,
+			Status:  http.StatusBadRequest,
+			Code:    CodeBadRequest,
+		},
+	}
+}
+
 // NotFound represents an error where data that was requested could not be found
 type NotFound struct {
 	BaseError
 }
 
-// Unauthorized is the error for unauthorized actions
+// Unauthorized is the error for requests that need a logged in user, but don't have one
 type Unauthorized struct {
 	BaseError
 }
@@ -43,6 +109,39 @@ func ErrUnauthorized(message string) error {
 		BaseError: BaseError{
 			Message: message,
 			Status:  http.StatusUnauthorized,
+			Code:    CodeUnauthenticated,
+		},
+	}
+}
+
+// Forbidden is the error for actions the logged in user is not allowed to take
+type Forbidden struct {
+	BaseError
+}
+
+// ErrForbidden creates a new Forbidden error
+func ErrForbidden(message string) error {
+	return Forbidden{
+		BaseError: BaseError{
+			Message: message,
+			Status:  http.StatusForbidden,
+			Code:    CodeForbidden,
+		},
+	}
+}
+
+// Conflict is the error for changes that clash with the current state of the data
+type Conflict struct {
+	BaseError
+}
+
+// ErrConflict creates a new Conflict error
+func ErrConflict(message string) error {
+	return Conflict{
+		BaseError: BaseError{
+			Message: message,
+			Status:  http.StatusConflict,
+			Code:    CodeConflict,
 		},
 	}
 }
@@ -53,6 +152,7 @@ func ErrNotFound(message string) error {
 		BaseError: BaseError{
 			Message: message,
 			Status:  http.StatusNotFound,
+			Code:    CodeNotFound,
 		},
 	}
 }
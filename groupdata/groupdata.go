@@ -2,20 +2,40 @@
 package groupdata
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+	"github.com/wallnutkraken/groupplan/groupdata/migration"
 	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/webhooks"
 
 	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/metrics"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var dbPath string
+// The driver names are the ones the config uses
+const (
+	DriverSQLite   = config.DriverSQLite
+	DriverPostgres = config.DriverPostgres
+)
 
-func init() {
-	// Get the database path on i
+// dialector returns the gorm dialector for the given driver name and DSN
+func dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverSQLite, "":
+		return sqlite.Open(dsn), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	}
+	return nil, fmt.Errorf("unsupported database driver [%s], use [%s] or [%s]", driver, DriverSQLite, DriverPostgres)
 }
 
 // Data is the wrapper struct for our GORM object, and contains methods to interact with the persistent storage.
@@ -23,27 +43,93 @@ type Data struct {
 	db *gorm.DB
 }
 
-// New creates a new instance of the Data access object
-func New(confPath string) (Data, error) {
-	// Open gorm with the given data path
-	db, err := gorm.Open(sqlite.Open(confPath), &gorm.Config{
+// Open opens the database with the given driver (DriverSQLite or DriverPostgres) and its data
+// source name, without touching the schema. Most callers want New instead.
+func Open(driver, dsn string) (Data, error) {
+	dial, err := dialector(driver, dsn)
+	if err != nil {
+		return Data{}, err
+	}
+	// Open gorm with the given data source
+	db, err := gorm.Open(dial, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
-		return Data{}, fmt.Errorf("Failed opening sqlite file at [%s]: %w", confPath, err)
+		return Data{}, fmt.Errorf("Failed opening %s database: %w", dial.Name(), err)
+	}
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return Data{}, fmt.Errorf("failed registering database metrics: %w", err)
 	}
 	// Wrap the gorm object in our Data object
-	data := Data{
+	return Data{
 		db: db,
-	}
-	// And call migrate to automigrate
-	err = data.migrate()
+	}, nil
+}
+
+// New opens the database like Open does, then applies any pending schema migrations. It refuses
+// to open a database whose schema is newer than this binary knows about.
+func New(driver, dsn string) (Data, error) {
+	data, err := Open(driver, dsn)
 	if err != nil {
+		return data, err
+	}
+	// And call migrate to bring the schema up to date
+	if err := data.migrate(); err != nil {
+		data.Close()
 		return data, fmt.Errorf("Failed migrating database: %w", err)
 	}
 	return data, nil
 }
 
+// Close closes the underlying database connection. The Data object, and any handlers
+// created from it, cannot be used afterwards.
+func (d Data) Close() error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return fmt.Errorf("failed getting the database connection: %w", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		return fmt.Errorf("failed closing the database connection: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the database can be reached
+func (d Data) Ping(ctx context.Context) error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return fmt.Errorf("failed getting the database connection: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CheckSchema returns an error unless every known migration, and nothing newer, has been applied.
+// It only reads, so it's safe to call from health checks.
+func (d Data) CheckSchema() error {
+	migrator, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+	current, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return errors.New("the database has not been migrated")
+	}
+	if err := migrator.Check(); err != nil {
+		return err
+	}
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) != 0 {
+		return fmt.Errorf("%d migrations are pending, the first being %d [%s]", len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
 // Users returns the users handler
 func (d Data) Users() users.UserHandler {
 	return users.New(d.db)
@@ -54,19 +140,49 @@ func (d Data) Plans() *plans.PlanHandler {
 	return plans.New(d.db)
 }
 
-// migrate collects all the database data types and calls gorm's AutoMigrate method
-// to migrate the schema to the database
-func (d Data) migrate() error {
-	allDataTypes := []interface{}{}
-	allDataTypes = append(allDataTypes, users.AllTypes()...)
-	allDataTypes = append(allDataTypes, plans.AllTypes()...)
+// Webhooks returns the webhooks handler
+func (d Data) Webhooks() *webhooks.Handler {
+	return webhooks.New(d.db)
+}
+
+// Jobs returns the scheduled jobs handler
+func (d Data) Jobs() *jobs.Handler {
+	return jobs.New(d.db)
+}
 
-	// Migrate the data types first
-	if err := d.db.AutoMigrate(allDataTypes...); err != nil {
-		return fmt.Errorf("failed migrating data types: %w", err)
+// MergeUsers merges the duplicate user into the kept one: the duplicate's plans, entries,
+// authentication points and API tokens are moved over, and the duplicate is then disabled. All of
+// it happens in a single transaction.
+func (d Data) MergeUsers(keep, duplicate users.User) error {
+	if keep.ID == duplicate.ID {
+		return dataerror.ErrBasic("cannot merge a user into themselves")
 	}
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := plans.New(tx).MoveUserData(duplicate, keep); err != nil {
+			return err
+		}
+		userHandler := users.New(tx)
+		if err := userHandler.MergeAuthPoints(keep, duplicate); err != nil {
+			return err
+		}
+		if err := userHandler.MoveAPITokens(duplicate, keep); err != nil {
+			return err
+		}
+		return userHandler.RetireUser(&duplicate)
+	})
+}
 
-	// Now migrate the necessary data from each package
-	fmt.Println("Migrating!")
-	return users.Migrate(d.db)
+// Migrator returns the schema migrator, knowing about the migrations of every data package
+func (d Data) Migrator() (*migration.Migrator, error) {
+	return migration.New(d.db, users.Migrations(), plans.Migrations(), webhooks.Migrations(), jobs.Migrations())
+}
+
+// migrate applies every pending schema migration
+func (d Data) migrate() error {
+	migrator, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up()
+	return err
 }
@@ -0,0 +1,454 @@
+package groupdata_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/groupdata/webhooks"
+	"github.com/wallnutkraken/groupplan/secid"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// postgresDSNEnv is the environment variable holding the DSN of a local (throwaway) Postgres
+// database. The Postgres variant of every test is skipped when it's not set.
+const postgresDSNEnv = "GROUPPLAN_TEST_POSTGRES_DSN"
+
+// engine is a database engine the integration tests run against, name being its driver
+type engine struct {
+	name string
+	dsn  func(t *testing.T) string
+}
+
+// engines returns every engine the integration tests should be run against
+func engines() []engine {
+	return []engine{
+		{name: groupdata.DriverSQLite, dsn: func(t *testing.T) string {
+			return filepath.Join(t.TempDir(), "groupplan.sqlite3")
+		}},
+		{name: groupdata.DriverPostgres, dsn: func(t *testing.T) string {
+			dsn := os.Getenv(postgresDSNEnv)
+			if dsn == "" {
+				t.Skipf("%s is not set", postgresDSNEnv)
+			}
+			return dsn
+		}},
+	}
+}
+
+// open opens the engine's database at the given DSN, migrating it
+func (e engine) open(t *testing.T, dsn string) groupdata.Data {
+	data, err := groupdata.New(e.name, dsn)
+	require.NoError(t, err, "failed opening %s database", e.name)
+	return data
+}
+
+// forEachEngine runs the given test once per database engine, with a freshly opened database
+func forEachEngine(t *testing.T, test func(t *testing.T, data groupdata.Data)) {
+	for _, eng := range engines() {
+		eng := eng
+		t.Run(eng.name, func(t *testing.T) {
+			data := eng.open(t, eng.dsn(t))
+			defer data.Close()
+			test(t, data)
+		})
+	}
+}
+
+// newUser creates a user with a unique email address, so tests don't collide on a shared database
+func newUser(t *testing.T, data groupdata.Data) users.User {
+	suffix, err := secid.String(8)
+	require.NoError(t, err)
+	user, err := data.Users().GetOrCreateUser(suffix+"@example.com", "", "Tester "+suffix)
+	require.NoError(t, err, "failed creating user")
+	return user
+}
+
+// newPlan creates a plan starting today, owned by the given user
+func newPlan(t *testing.T, data groupdata.Data, owner users.User) plans.Plan {
+	identifier, err := secid.String(16)
+	require.NoError(t, err)
+	plan := plans.Plan{
+		OwnerID:                    owner.ID,
+		Identifier:                 identifier,
+		Title:                      "Integration plan",
+		FromDate:                   time.Now(),
+		DurationDays:               2,
+		MinimumAvailabilitySeconds: 60,
+	}
+	require.NoError(t, data.Plans().CreatePlan(&plan), "failed creating plan")
+	return plan
+}
+
+func TestMigrate_Twice_Succeeds(t *testing.T) {
+	for _, eng := range engines() {
+		eng := eng
+		t.Run(eng.name, func(t *testing.T) {
+			that := assert.New(t)
+			dsn := eng.dsn(t)
+			first := eng.open(t, dsn)
+			providers, err := first.Users().GetProviders()
+			that.NoError(err)
+			that.NotEmpty(providers, "migration should have created the authentication providers")
+			require.NoError(t, first.Close())
+
+			// Opening the same database again migrates it again, which must change nothing
+			second := eng.open(t, dsn)
+			defer second.Close()
+			reopened, err := second.Users().GetProviders()
+			that.NoError(err)
+			that.Len(reopened, len(providers), "migrating again should not duplicate the providers")
+		})
+	}
+}
+
+func TestAddEntry_Overlapping_Rejected(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		user := newUser(t, data)
+		plan := newPlan(t, data, user)
+		start := plan.FromDateZeroHour().Add(time.Hour).Unix()
+
+		_, err := data.Plans().AddEntry(&plan, user, start, 3600)
+		require.NoError(t, err, "first entry should be accepted")
+
+		_, err = data.Plans().AddEntry(&plan, user, start+1800, 3600)
+		that.Error(err, "an entry starting inside an existing one should be rejected")
+		_, err = data.Plans().AddEntry(&plan, user, start-1800, 3600)
+		that.Error(err, "an entry ending inside an existing one should be rejected")
+
+		_, err = data.Plans().AddEntry(&plan, user, start+7200, 3600)
+		that.NoError(err, "a separate entry should be accepted")
+
+		// Another user can have the exact same availability
+		_, err = data.Plans().AddEntry(&plan, newUser(t, data), start, 3600)
+		that.NoError(err, "another user's entry should not conflict")
+	})
+}
+
+func TestPlanLifecycle_AllEngines(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		owner := newUser(t, data)
+		plan := newPlan(t, data, owner)
+		entry, err := data.Plans().AddEntry(&plan, owner, plan.FromDateZeroHour().Add(time.Hour).Unix(), 3600)
+		require.NoError(t, err)
+
+		fetched, err := data.Plans().GetPlan(plan.Identifier)
+		require.NoError(t, err)
+		that.Equal(plan.Title, fetched.Title)
+		that.Len(fetched.Entries, 1)
+
+		owned, err := data.Plans().GetPlansByUser(owner)
+		require.NoError(t, err)
+		that.Len(owned, 1)
+
+		entries, err := data.Plans().GetEntriesOnPlanByUser(plan.Identifier, owner)
+		require.NoError(t, err)
+		that.Len(entries, 1)
+
+		reached, err := data.Plans().MarkQuorumReached(&fetched, time.Now())
+		require.NoError(t, err)
+		that.True(reached)
+		reached, err = data.Plans().MarkQuorumReached(&fetched, time.Now())
+		require.NoError(t, err)
+		that.False(reached, "the quorum should only be reached once")
+
+		require.NoError(t, data.Plans().DeleteEntry(entry.ID))
+		_, err = data.Plans().GetEntry(entry.ID)
+		that.Error(err, "deleted entry should not be found")
+
+		require.NoError(t, data.Plans().DeletePlan(fetched))
+		_, err = data.Plans().GetPlan(plan.Identifier)
+		that.Error(err, "deleted plan should not be found")
+	})
+}
+
+func TestDeletePlan_CancelsJobs(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		plan := newPlan(t, data, newUser(t, data))
+		deadline := plan.FromDateZeroHour().Add(12 * time.Hour)
+		require.NoError(t, data.Plans().SetResponseDeadline(&plan, &deadline, false))
+		later := deadline.Add(time.Hour)
+		require.NoError(t, data.Plans().SetResponseDeadline(&plan, &later, true))
+		require.NoError(t, data.Plans().FinalizePlan(&plan, deadline.Add(24*time.Hour).Unix(), 3600, time.Now()))
+
+		scheduled, err := data.Jobs().ListJobs(plan.ID)
+		require.NoError(t, err)
+		statuses := map[string][]string{}
+		for _, job := range scheduled {
+			statuses[job.Kind] = append(statuses[job.Kind], job.Status)
+		}
+		that.Equal([]string{jobs.StatusCancelled, jobs.StatusPending}, statuses[jobs.KindDeadlineReminder], "moving the deadline replaces its reminder")
+		that.Equal([]string{jobs.StatusPending}, statuses[jobs.KindEventReminder])
+		due, err := data.Jobs().Due(jobs.KindDeadlineReminder, later, 10)
+		require.NoError(t, err)
+		that.Len(due, 1)
+
+		require.NoError(t, data.Plans().DeletePlan(plan))
+		scheduled, err = data.Jobs().ListJobs(plan.ID)
+		require.NoError(t, err)
+		for _, job := range scheduled {
+			that.Equal(jobs.StatusCancelled, job.Status)
+		}
+	})
+}
+
+func TestDumpRestore_RoundTrip(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		owner := newUser(t, data)
+		plan := newPlan(t, data, owner)
+		_, err := data.Plans().AddEntry(&plan, owner, plan.FromDateZeroHour().Add(time.Hour).Unix(), 3600)
+		require.NoError(t, err)
+		require.NoError(t, data.Webhooks().CreateWebhook(&webhooks.Webhook{PlanID: plan.ID, URL: "https://example.com/hook", Secret: "secret"}))
+		finalStart := plan.FromDateZeroHour().Add(time.Hour).Unix()
+		require.NoError(t, data.Plans().FinalizePlan(&plan, finalStart, 3600, time.Now()))
+		require.NoError(t, data.Users().SetNotificationPreferences(&owner, "", []users.NotificationPreference{{Event: "plan_finalized", Channel: "none"}}))
+		require.NoError(t, data.Users().SetNotificationPreferences(&owner, "", []users.NotificationPreference{{Event: "plan_finalized", Channel: "email", Digest: true}}))
+		member := newUser(t, data)
+		require.NoError(t, data.Plans().AddMember(&plan, member))
+		deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+		require.NoError(t, data.Plans().SetResponseDeadline(&plan, &deadline, true))
+		plan, err = data.Plans().GetPlan(plan.Identifier)
+		require.NoError(t, err)
+		require.Len(t, plan.Members, 2, "the owner and the member")
+		require.NoError(t, data.Plans().SetRequirements(&plan, 2, []uint{plan.Members[1].ID}))
+
+		dump := bytes.Buffer{}
+		require.NoError(t, data.Dump(&dump))
+
+		// Restore into a fresh sqlite database, which also covers moving between engines
+		restored, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "restored.sqlite3"))
+		require.NoError(t, err)
+		defer restored.Close()
+		require.NoError(t, restored.Restore(&dump))
+
+		fetched, err := restored.Plans().GetPlan(plan.Identifier)
+		require.NoError(t, err)
+		that.Equal(plan.Title, fetched.Title)
+		that.Equal(owner.Email, fetched.Owner.Email)
+		that.Len(fetched.Entries, 1)
+		that.True(fetched.Finalized())
+		that.Equal(finalStart, fetched.FinalStartUnix)
+		if that.NotNil(fetched.ResponseDeadline) {
+			that.True(deadline.Equal(*fetched.ResponseDeadline))
+			that.True(fetched.AutoFinalize)
+		}
+		if that.Len(fetched.MembersWithoutEntries(), 1) {
+			that.Equal(member.Email, fetched.MembersWithoutEntries()[0].Email)
+		}
+		that.Equal([]uint{member.ID}, fetched.RequiredUserIDs())
+		that.EqualValues(2, fetched.Quorum)
+		scheduled, err := restored.Jobs().ListJobs(fetched.ID)
+		require.NoError(t, err)
+		that.Len(scheduled, 3, "the pending reminders before the deadline and the final time, and the closing")
+		hooks, err := restored.Webhooks().ListWebhooks(fetched.ID)
+		require.NoError(t, err)
+		if that.Len(hooks, 1) {
+			that.Equal("secret", hooks[0].Secret)
+		}
+		preferences, err := restored.Users().GetNotificationPreferences(owner.ID)
+		require.NoError(t, err)
+		if that.Len(preferences, 1, "saving a preference again replaces it") {
+			that.Equal("email", preferences[0].Channel)
+			that.True(preferences[0].Digest)
+		}
+
+		// Restoring twice would duplicate everything, so it's refused
+		second := bytes.Buffer{}
+		require.NoError(t, data.Dump(&second))
+		that.Error(restored.Restore(&second))
+	})
+}
+
+func TestSnapshot_SQLite_IsUsable(t *testing.T) {
+	that := assert.New(t)
+	sqlite := engines()[0]
+	data := sqlite.open(t, sqlite.dsn(t))
+	defer data.Close()
+	owner := newUser(t, data)
+	plan := newPlan(t, data, owner)
+
+	path := filepath.Join(t.TempDir(), "snapshot.sqlite3")
+	require.NoError(t, data.Snapshot(path))
+	that.Error(data.Snapshot(path), "an existing snapshot should not be overwritten")
+
+	snapshot, err := groupdata.New(groupdata.DriverSQLite, path)
+	require.NoError(t, err)
+	defer snapshot.Close()
+	that.NoError(snapshot.Verify())
+	_, err = snapshot.Plans().GetPlan(plan.Identifier)
+	that.NoError(err)
+}
+
+func TestMergeUsers_MovesEverything(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		keep := newUser(t, data)
+		duplicate := newUser(t, data)
+		plan := newPlan(t, data, duplicate)
+		_, err := data.Plans().AddEntry(&plan, duplicate, plan.FromDateZeroHour().Add(time.Hour).Unix(), 3600)
+		require.NoError(t, err)
+		// Both are members of someone else's plan
+		joined := newPlan(t, data, newUser(t, data))
+		require.NoError(t, data.Plans().AddMember(&joined, keep))
+		require.NoError(t, data.Plans().AddMember(&joined, duplicate))
+		require.NoError(t, data.Plans().AddMember(&joined, duplicate), "adding a member twice changes nothing")
+		joined, err = data.Plans().GetPlan(joined.Identifier)
+		require.NoError(t, err)
+		require.Len(t, joined.Members, 3)
+		require.NoError(t, data.Plans().SetRequirements(&joined, 0, []uint{joined.Members[2].ID}))
+		provider, err := data.Users().GetProvider("discord")
+		require.NoError(t, err)
+		_, err = data.Users().UserAuthorizedWith(duplicate, provider, "duplicate-discord-id")
+		require.NoError(t, err)
+
+		require.NoError(t, data.MergeUsers(keep, duplicate))
+
+		retired, err := data.Users().GetUser(duplicate.ID)
+		require.NoError(t, err)
+		that.True(retired.Disabled, "the duplicate user should be disabled")
+		// A session the duplicate still has is refused, rather than creating them again
+		_, err = userman.New(data.Users(), nil).GetAuthenticatedUser(duplicate.Email)
+		that.True(errors.Is(err, userman.ErrDisabled))
+		merged, err := data.Users().GetUser(keep.ID)
+		require.NoError(t, err)
+		that.Len(merged.AuthPoints, 1)
+		fetched, err := data.Plans().GetPlan(plan.Identifier)
+		require.NoError(t, err)
+		that.Equal(keep.ID, fetched.OwnerID)
+		that.Equal(keep.ID, fetched.Entries[0].UserID)
+		fetched, err = data.Plans().GetPlan(joined.Identifier)
+		require.NoError(t, err)
+		if that.Len(fetched.Members, 2, "the owner and the kept user") {
+			that.Equal(keep.ID, fetched.Members[1].UserID)
+		}
+		that.Equal([]uint{keep.ID}, fetched.RequiredUserIDs(), "the duplicate was required, so the kept user is")
+	})
+}
+
+func TestReassignPlan_MakesTheNewOwnerAMember(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		previous := newUser(t, data)
+		owner := newUser(t, data)
+		plan := newPlan(t, data, previous)
+
+		require.NoError(t, data.Plans().ReassignPlan(&plan, owner))
+		fetched, err := data.Plans().GetPlan(plan.Identifier)
+		require.NoError(t, err)
+		that.Equal(owner.ID, fetched.OwnerID)
+		memberIDs := []uint{}
+		for _, member := range fetched.Members {
+			memberIDs = append(memberIDs, member.UserID)
+		}
+		that.Equal([]uint{previous.ID, owner.ID}, memberIDs)
+	})
+}
+
+func TestMigrations_AllDownThenUp_Succeeds(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		migrator, err := data.Migrator()
+		require.NoError(t, err)
+		statuses, err := migrator.Status()
+		require.NoError(t, err)
+
+		rolledBack, err := migrator.Down(len(statuses))
+		require.NoError(t, err)
+		that.Len(rolledBack, len(statuses))
+		current, err := migrator.Current()
+		require.NoError(t, err)
+		that.EqualValues(0, current)
+
+		applied, err := migrator.Up()
+		require.NoError(t, err)
+		that.Len(applied, len(statuses))
+		newUser(t, data)
+	})
+}
+
+func TestMigrations_RequiredMembersDown_KeepsOwnersWhoJoined(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		owner := newUser(t, data)
+		plan := newPlan(t, data, owner)
+		migrator, err := data.Migrator()
+		require.NoError(t, err)
+
+		// The owner was already a member, so rolling back the migration that makes owners
+		// members has to leave them one
+		_, err = migrator.Down(1)
+		require.NoError(t, err)
+		fetched, err := data.Plans().GetPlan(plan.Identifier)
+		require.NoError(t, err)
+		if that.Len(fetched.Members, 1) {
+			that.Equal(owner.ID, fetched.Members[0].UserID)
+		}
+		_, err = migrator.Up()
+		require.NoError(t, err)
+	})
+}
+
+func TestAPITokens_FollowMergedUser(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		keep := newUser(t, data)
+		duplicate := newUser(t, data)
+		hash, err := secid.String(32)
+		require.NoError(t, err)
+		token := users.APIToken{UserID: duplicate.ID, Name: "cli", TokenHash: hash}
+		require.NoError(t, data.Users().CreateAPIToken(&token))
+
+		require.NoError(t, data.MergeUsers(keep, duplicate))
+
+		found, err := data.Users().GetAPITokenByHash(hash)
+		require.NoError(t, err)
+		that.Equal(keep.ID, found.User.ID)
+		require.NoError(t, data.Users().DeleteAPIToken(keep, token.ID))
+		_, err = data.Users().GetAPITokenByHash(hash)
+		that.Error(err, "revoked token should not be found")
+	})
+}
+
+func TestMergeUsers_MergesOverlappingEntries(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, data groupdata.Data) {
+		that := assert.New(t)
+		keep := newUser(t, data)
+		duplicate := newUser(t, data)
+		plan := newPlan(t, data, newUser(t, data))
+		start := plan.FromDateZeroHour().Add(time.Hour).Unix()
+		_, err := data.Plans().AddEntry(&plan, keep, start, 3600)
+		require.NoError(t, err)
+		// Overlaps the kept user's entry, and touches the next one
+		_, err = data.Plans().AddEntry(&plan, duplicate, start+1800, 3600)
+		require.NoError(t, err)
+		_, err = data.Plans().AddEntry(&plan, keep, start+5400, 1800)
+		require.NoError(t, err)
+		// Doesn't overlap anything, so it's only moved
+		_, err = data.Plans().AddEntry(&plan, duplicate, start+10800, 600)
+		require.NoError(t, err)
+
+		require.NoError(t, data.MergeUsers(keep, duplicate))
+
+		entries, err := data.Plans().GetEntriesOnPlanByUser(plan.Identifier, keep)
+		require.NoError(t, err)
+		if that.Len(entries, 2) {
+			that.Equal(start, entries[0].StartTimeUnix)
+			that.EqualValues(7200, entries[0].DurationSeconds)
+			that.Equal(start+10800, entries[1].StartTimeUnix)
+			that.EqualValues(600, entries[1].DurationSeconds)
+		}
+	})
+}
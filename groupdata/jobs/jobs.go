@@ -0,0 +1,120 @@
+// Package jobs is responsible for storing scheduled jobs, work that has to happen around a certain
+// time, such as the reminders about plans. They're kept in the database, so they survive restarts.
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job kinds
+const (
+	// KindDeadlineReminder reminds the members of a plan who haven't added their availability yet
+	// that its response deadline is coming up
+	KindDeadlineReminder = "deadline_reminder"
+	// KindEventReminder reminds everyone taking part in a finalized plan that it's coming up
+	KindEventReminder = "event_reminder"
+	// KindClosePlan closes a plan to new availability at its response deadline
+	KindClosePlan = "close_plan"
+)
+
+// Job statuses
+const (
+	StatusPending   = "pending"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Job is a single piece of scheduled work on a plan
+type Job struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PlanID    uint   `gorm:"not null;index"`
+	Kind      string `gorm:"not null"`
+	// TargetTime is the time the job is about, such as the deadline a reminder is for. How long
+	// before it the job runs is up to whoever runs that kind of job.
+	TargetTime time.Time `gorm:"not null"`
+	Status     string    `gorm:"not null;index"`
+	Attempts   uint      `gorm:"not null"`
+	LastError  string
+	FinishedAt *time.Time
+}
+
+// Handler is the data sub-handler for scheduled jobs
+type Handler struct {
+	db *gorm.DB
+}
+
+// New creates a new instance of the jobs Handler with the given gorm DB instance
+func New(db *gorm.DB) *Handler {
+	return &Handler{
+		db: db,
+	}
+}
+
+// Schedule schedules a job of the given kind on the plan, about the given time. A plan has at most
+// one pending job of every kind, any earlier one is cancelled.
+func (h *Handler) Schedule(planID uint, kind string, at time.Time) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := New(tx).Cancel(planID, kind); err != nil {
+			return err
+		}
+		job := Job{
+			PlanID:     planID,
+			Kind:       kind,
+			TargetTime: at,
+			Status:     StatusPending,
+		}
+		if err := tx.Create(&job).Error; err != nil {
+			return fmt.Errorf("failed scheduling %s on plan [%d]: %w", kind, planID, err)
+		}
+		return nil
+	})
+}
+
+// Cancel cancels the pending jobs of the given kinds on the plan, or all of them if no kinds are given
+func (h *Handler) Cancel(planID uint, kinds ...string) error {
+	query := h.db.Model(&Job{}).Where("plan_id = ? AND status = ?", planID, StatusPending)
+	if len(kinds) != 0 {
+		query = query.Where("kind IN ?", kinds)
+	}
+	if err := query.Updates(map[string]interface{}{
+		"status":      StatusCancelled,
+		"finished_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed cancelling the jobs of plan [%d]: %w", planID, err)
+	}
+	return nil
+}
+
+// Due returns up to limit pending jobs of the given kind that are about a time before the given
+// one, the soonest first
+func (h *Handler) Due(kind string, before time.Time, limit int) ([]Job, error) {
+	due := []Job{}
+	if err := h.db.Where("kind = ? AND status = ? AND target_time <= ?", kind, StatusPending, before).
+		Order("target_time").Limit(limit).Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed getting due %s jobs: %w", kind, err)
+	}
+	return due, nil
+}
+
+// ListJobs returns every job of a plan, oldest first
+func (h *Handler) ListJobs(planID uint) ([]Job, error) {
+	found := []Job{}
+	if err := h.db.Where(Job{PlanID: planID}).Order("id").Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("failed listing the jobs of plan [%d]: %w", planID, err)
+	}
+	return found, nil
+}
+
+// UpdateJob saves the outcome of running a job
+func (h *Handler) UpdateJob(job *Job) error {
+	if err := h.db.Save(job).Error; err != nil {
+		return fmt.Errorf("failed updating job [%d]: %w", job.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/migration"
+	"gorm.io/gorm"
+)
+
+// The types below are frozen snapshots of the schema at the time of each migration. They must
+// not change along with the live types, or old migrations would start doing something different.
+
+// jobV10 is the jobs table as of migration 10
+type jobV10 struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	PlanID     uint      `gorm:"not null;index"`
+	Kind       string    `gorm:"not null"`
+	TargetTime time.Time `gorm:"not null"`
+	Status     string    `gorm:"not null;index"`
+	Attempts   uint      `gorm:"not null"`
+	LastError  string
+	FinishedAt *time.Time
+}
+
+func (jobV10) TableName() string { return "jobs" }
+
+// Migrations returns the schema migrations of the jobs package
+func Migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 10,
+			Name:    "create jobs table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&jobV10{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&jobV10{})
+			},
+		},
+	}
+}
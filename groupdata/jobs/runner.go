@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+)
+
+const (
+	// checkInterval is how often a Runner looks for due jobs
+	checkInterval = time.Minute
+	// batchSize is how many jobs of a kind a Runner does per check
+	batchSize = 50
+	// maxAttempts is how many times a job is tried before giving up on it
+	maxAttempts = 5
+)
+
+// RunnerData is the part of the jobs Handler a Runner needs
+type RunnerData interface {
+	Due(kind string, before time.Time, limit int) ([]Job, error)
+	UpdateJob(job *Job) error
+}
+
+// Work does a due job, at the given time. A failed job is tried again on the next check, unless
+// the error is a dataerror.CodeNotFound one, which means its plan is gone.
+type Work func(job Job, now time.Time) error
+
+// Runner does the pending jobs of some kinds in the background once they're due, recording how
+// each went in the database
+type Runner struct {
+	data RunnerData
+	name string
+	// leads are how long before the time they're about jobs are done, by kind
+	leads map[string]time.Duration
+	work  Work
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRunner creates a Runner doing the jobs of the kinds in leads with work, the lead time of their
+// kind before the time they're about. name says what the work is in logs and errors.
+func NewRunner(data RunnerData, name string, leads map[string]time.Duration, work Work) *Runner {
+	return &Runner{
+		data:  data,
+		name:  name,
+		leads: leads,
+		work:  work,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start starts doing jobs in the background, beginning with the ones that came due while the
+// server wasn't running
+func (r *Runner) Start() {
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			r.runDue(time.Now())
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops doing jobs, waiting for the job in progress to finish or the context to be done
+func (r *Runner) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s did not stop in time: %w", r.name, ctx.Err())
+	}
+}
+
+// runDue does every job that's due at the given time
+func (r *Runner) runDue(now time.Time) {
+	for kind, lead := range r.leads {
+		due, err := r.data.Due(kind, now.Add(lead), batchSize)
+		if err != nil {
+			logrus.WithError(err).WithField("kind", kind).Errorf("Failed finding due jobs for %s", r.name)
+			continue
+		}
+		for index := range due {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+			r.run(&due[index], now)
+		}
+	}
+}
+
+// run does a job and records how it went
+func (r *Runner) run(job *Job, now time.Time) {
+	log := logrus.WithFields(logrus.Fields{"job_id": job.ID, "kind": job.Kind, "plan_id": job.PlanID})
+	err := r.work(*job, now)
+	job.Attempts++
+	userError, isUserError := dataerror.As(err)
+	switch {
+	case err == nil:
+		job.Status = StatusDone
+	case isUserError && userError.Code == dataerror.CodeNotFound:
+		// The plan was deleted without its jobs being cancelled
+		job.Status = StatusCancelled
+	case job.Attempts >= maxAttempts:
+		log.WithError(err).Warnf("Job for %s failed for good", r.name)
+		job.Status = StatusFailed
+	default:
+		log.WithError(err).Warnf("Job for %s failed, trying again later", r.name)
+	}
+	if err != nil {
+		job.LastError = err.Error()
+	}
+	if job.Status != StatusPending {
+		job.FinishedAt = &now
+	}
+	if err := r.data.UpdateJob(job); err != nil {
+		log.WithError(err).Errorf("Failed saving the outcome of a job for %s", r.name)
+	}
+}
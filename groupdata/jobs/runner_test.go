@@ -0,0 +1,73 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+)
+
+// fakeJobs hands out its jobs as due once, and passes on every outcome saved
+type fakeJobs struct {
+	due     []jobs.Job
+	updated chan jobs.Job
+}
+
+func (f *fakeJobs) Due(kind string, before time.Time, limit int) ([]jobs.Job, error) {
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeJobs) UpdateJob(job *jobs.Job) error {
+	f.updated <- *job
+	return nil
+}
+
+func TestRunner_RecordsOutcomes(t *testing.T) {
+	that := assert.New(t)
+	data := &fakeJobs{
+		due: []jobs.Job{
+			{ID: 1, Kind: jobs.KindClosePlan, Status: jobs.StatusPending},
+			{ID: 2, Kind: jobs.KindClosePlan, Status: jobs.StatusPending},
+			{ID: 3, Kind: jobs.KindClosePlan, Status: jobs.StatusPending},
+			{ID: 4, Kind: jobs.KindClosePlan, Status: jobs.StatusPending, Attempts: 4},
+		},
+		updated: make(chan jobs.Job, 4),
+	}
+	outcomes := map[uint]error{
+		1: nil,
+		2: fmt.Errorf("no plan: %w", dataerror.ErrNotFound("plan not found")),
+		3: errors.New("database is down"),
+		4: errors.New("database is down"),
+	}
+	runner := jobs.NewRunner(data, "testing", map[string]time.Duration{jobs.KindClosePlan: 0}, func(job jobs.Job, now time.Time) error {
+		return outcomes[job.ID]
+	})
+	runner.Start()
+	saved := map[uint]jobs.Job{}
+	for i := 0; i < 4; i++ {
+		select {
+		case job := <-data.updated:
+			saved[job.ID] = job
+		case <-time.After(5 * time.Second):
+			t.Fatal("not every job was run")
+		}
+	}
+	require.NoError(t, runner.Stop(context.Background()))
+
+	that.Equal(jobs.StatusDone, saved[1].Status)
+	that.Equal(jobs.StatusCancelled, saved[2].Status, "the plan is gone")
+	that.Equal(jobs.StatusPending, saved[3].Status, "tried again on the next check")
+	that.EqualValues(1, saved[3].Attempts)
+	that.Equal("database is down", saved[3].LastError)
+	that.Nil(saved[3].FinishedAt)
+	that.Equal(jobs.StatusFailed, saved[4].Status, "out of attempts")
+	that.NotNil(saved[4].FinishedAt)
+}
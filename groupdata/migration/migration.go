@@ -0,0 +1,260 @@
+// Package migration applies and rolls back numbered, versioned schema migrations, keeping track
+// of which ones have been applied in the schema_versions table
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations applied that this binary doesn't
+// know about, meaning it was migrated by a newer version of groupplan
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of groupplan supports")
+
+// Migration is a single, numbered schema change. Migrations must never be edited once released,
+// any further change needs a new migration with a higher version.
+type Migration struct {
+	// Version orders the migrations, it must be unique across every package
+	Version uint
+	// Name is a short human-readable description of the change
+	Name string
+	// Up applies the change
+	Up func(tx *gorm.DB) error
+	// Down reverts the change made by Up
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaVersion is a record of an applied migration
+type SchemaVersion struct {
+	Version   uint `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Status describes a single known migration and whether it was applied
+type Status struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back a set of migrations on a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a Migrator for the given migrations, which can come from any number of packages.
+// It returns an error if two migrations share a version.
+func New(db *gorm.DB, sets ...[]Migration) (*Migrator, error) {
+	all := []Migration{}
+	for _, set := range sets {
+		all = append(all, set...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Version < all[j].Version
+	})
+	for index := range all {
+		if all[index].Version == 0 {
+			return nil, fmt.Errorf("migration [%s] has no version", all[index].Name)
+		}
+		if index > 0 && all[index].Version == all[index-1].Version {
+			return nil, fmt.Errorf("migrations [%s] and [%s] share version %d", all[index-1].Name, all[index].Name, all[index].Version)
+		}
+	}
+	return &Migrator{
+		db:         db,
+		migrations: all,
+	}, nil
+}
+
+// Latest returns the highest migration version this Migrator knows about
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// applied returns every applied migration record, ordered by version. It only reads, a database
+// without the schema version table has no migrations applied.
+func (m *Migrator) applied() ([]SchemaVersion, error) {
+	versions := []SchemaVersion{}
+	if !m.db.Migrator().HasTable(&SchemaVersion{}) {
+		return versions, nil
+	}
+	if err := m.db.Order("version").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed reading applied schema versions: %w", err)
+	}
+	return versions, nil
+}
+
+// Current returns the version of the most recently applied migration, or 0 if none were applied
+func (m *Migrator) Current() (uint, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[len(versions)-1].Version, nil
+}
+
+// Check returns ErrSchemaTooNew if the database was migrated past what this Migrator knows about
+func (m *Migrator) Check() error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w (database at version %d, latest known is %d)", ErrSchemaTooNew, current, m.Latest())
+	}
+	return nil
+}
+
+// Status returns every known migration along with whether it's been applied
+func (m *Migrator) Status() ([]Status, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[uint]time.Time{}
+	for _, version := range versions {
+		appliedAt[version.Version] = version.AppliedAt
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for index, migration := range m.migrations {
+		at, applied := appliedAt[migration.Version]
+		statuses[index] = Status{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   applied,
+			AppliedAt: at,
+		}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func (m *Migrator) Pending() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for index, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, m.migrations[index])
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction. It returns the
+// migrations that were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+	if !m.db.Migrator().HasTable(&SchemaVersion{}) {
+		if err := m.db.Migrator().CreateTable(&SchemaVersion{}); err != nil {
+			return nil, fmt.Errorf("failed creating the schema version table: %w", err)
+		}
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+	for index, migration := range pending {
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return pending[:index], fmt.Errorf("failed applying migration %d [%s]: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down rolls back the given number of most recently applied migrations, newest first. It returns
+// the migrations that were rolled back.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint]Migration{}
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	rolledBack := []Migration{}
+	for index := len(versions) - 1; index >= 0 && len(rolledBack) < steps; index-- {
+		migration, known := byVersion[versions[index].Version]
+		if !known {
+			return rolledBack, fmt.Errorf("applied migration %d is unknown to this version of groupplan", versions[index].Version)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaVersion{}, migration.Version).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("failed rolling back migration %d [%s]: %w", migration.Version, migration.Name, err)
+		}
+		rolledBack = append(rolledBack, migration)
+	}
+	return rolledBack, nil
+}
+
+// AddColumns adds the given fields of a model to its table, skipping any that already exist
+func AddColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return fmt.Errorf("failed adding column [%s]: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// DropColumns drops the given columns from the table of a model. The columns must not be part of
+// an index or constraint, as SQLite can't drop those.
+func DropColumns(tx *gorm.DB, model interface{}, columns ...string) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Errorf("failed parsing model: %w", err)
+	}
+	table := stmt.Schema.Table
+	for _, column := range columns {
+		if !tx.Migrator().HasColumn(model, column) {
+			continue
+		}
+		// gorm's own DropColumn rebuilds SQLite tables by rewriting their SQL, which doesn't work
+		// for columns added later, so rely on ALTER TABLE support instead
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tx.Statement.Quote(table), tx.Statement.Quote(column))).Error; err != nil {
+			return fmt.Errorf("failed dropping column [%s] from [%s]: %w", column, table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package migration_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/groupdata/migration"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openDB opens an empty sqlite database in a temporary directory
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrations.sqlite3")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	return db
+}
+
+// widgetMigrations creates the widgets table, then the gadgets table
+func widgetMigrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 1,
+			Name:    "create widgets",
+			Up:      func(tx *gorm.DB) error { return tx.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY)").Error },
+			Down:    func(tx *gorm.DB) error { return tx.Exec("DROP TABLE widgets").Error },
+		},
+		{
+			Version: 2,
+			Name:    "create gadgets",
+			Up:      func(tx *gorm.DB) error { return tx.Exec("CREATE TABLE gadgets (id INTEGER PRIMARY KEY)").Error },
+			Down:    func(tx *gorm.DB) error { return tx.Exec("DROP TABLE gadgets").Error },
+		},
+	}
+}
+
+func TestMigrator_UpDown_TracksVersion(t *testing.T) {
+	that := assert.New(t)
+	db := openDB(t)
+	migrator, err := migration.New(db, widgetMigrations())
+	require.NoError(t, err)
+
+	applied, err := migrator.Up()
+	require.NoError(t, err)
+	that.Len(applied, 2)
+	current, _ := migrator.Current()
+	that.EqualValues(2, current)
+	that.True(db.Migrator().HasTable("gadgets"))
+
+	rolledBack, err := migrator.Down(1)
+	require.NoError(t, err)
+	that.Len(rolledBack, 1)
+	current, _ = migrator.Current()
+	that.EqualValues(1, current)
+	that.False(db.Migrator().HasTable("gadgets"))
+	that.True(db.Migrator().HasTable("widgets"))
+
+	applied, err = migrator.Up()
+	require.NoError(t, err)
+	that.Len(applied, 1, "only the rolled back migration should be applied again")
+}
+
+func TestMigrator_Status_OnlyReads(t *testing.T) {
+	that := assert.New(t)
+	db := openDB(t)
+	migrator, err := migration.New(db, widgetMigrations())
+	require.NoError(t, err)
+
+	that.NoError(migrator.Check())
+	pending, err := migrator.Pending()
+	require.NoError(t, err)
+	that.Len(pending, 2)
+	that.False(db.Migrator().HasTable(&migration.SchemaVersion{}), "checking the status should not change the database")
+}
+
+func TestMigrator_NewerSchema_Refused(t *testing.T) {
+	that := assert.New(t)
+	db := openDB(t)
+	newer, err := migration.New(db, widgetMigrations())
+	require.NoError(t, err)
+	_, err = newer.Up()
+	require.NoError(t, err)
+
+	// An older binary only knows about the first migration
+	older, err := migration.New(db, widgetMigrations()[:1])
+	require.NoError(t, err)
+	_, err = older.Up()
+	that.True(errors.Is(err, migration.ErrSchemaTooNew), "expected ErrSchemaTooNew, got %v", err)
+}
+
+func TestNew_DuplicateVersion_Fails(t *testing.T) {
+	_, err := migration.New(openDB(t), widgetMigrations(), widgetMigrations()[:1])
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package plans
+
+import (
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/migration"
+	"gorm.io/gorm"
+)
+
+// The types below are frozen snapshots of the schema at the time of each migration. They must
+// not change along with the live types, or old migrations would start doing something different.
+
+// userRefV1 is the part of the users table the plan tables reference
+type userRefV1 struct {
+	gorm.Model
+}
+
+func (userRefV1) TableName() string { return "users" }
+
+// planV1 is the plans table as of migration 2
+type planV1 struct {
+	gorm.Model
+	Owner                      userRefV1     `gorm:"foreignkey:OwnerID"`
+	OwnerID                    uint          `gorm:"not null"`
+	Identifier                 string        `gorm:"index;not null"`
+	Title                      string        `gorm:"not null"`
+	FromDate                   time.Time     `gorm:"not null"`
+	DurationDays               uint          `gorm:"not null"`
+	Entries                    []planEntryV1 `gorm:"foreignkey:PlanID"`
+	MinimumAvailabilitySeconds uint          `gorm:"not null"`
+}
+
+func (planV1) TableName() string { return "plans" }
+
+// planEntryV1 is the plan_entries table as of migration 2
+type planEntryV1 struct {
+	gorm.Model
+	User            userRefV1 `gorm:"foreignkey:UserID"`
+	UserID          uint      `gorm:"not null"`
+	PlanID          uint      `gorm:"not null"`
+	StartTimeUnix   int64     `gorm:"not null"`
+	DurationSeconds int64     `gorm:"not null"`
+}
+
+func (planEntryV1) TableName() string { return "plan_entries" }
+
+// planV7 contains the columns added to the plans table in migration 7
+type planV7 struct {
+	DiscordWebhookURL    string `gorm:"not null;default:''"`
+	Quorum               uint   `gorm:"not null;default:0"`
+	QuorumReachedAt      *time.Time
+	FinalStartUnix       int64 `gorm:"not null;default:0"`
+	FinalDurationSeconds int64 `gorm:"not null;default:0"`
+	FinalizedAt          *time.Time
+}
+
+func (planV7) TableName() string { return "plans" }
+
+// planV9 contains the column added to the plans table in migration 9
+type planV9 struct {
+	ResponseDeadline *time.Time
+}
+
+func (planV9) TableName() string { return "plans" }
+
+// planMemberV9 is the plan_members table as of migration 9
+type planMemberV9 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	PlanID    uint `gorm:"not null;uniqueIndex:idx_plan_members_plan_user"`
+	UserID    uint `gorm:"not null;uniqueIndex:idx_plan_members_plan_user"`
+}
+
+func (planMemberV9) TableName() string { return "plan_members" }
+
+// planV11 contains the columns added to the plans table in migration 11
+type planV11 struct {
+	ClosedAt     *time.Time
+	AutoFinalize bool `gorm:"not null;default:false"`
+}
+
+func (planV11) TableName() string { return "plans" }
+
+// planMemberV12 contains the column added to the plan_members table in migration 12
+type planMemberV12 struct {
+	Required bool `gorm:"not null;default:false"`
+}
+
+func (planMemberV12) TableName() string { return "plan_members" }
+
+// Migrations returns the schema migrations of the plans package
+func Migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 2,
+			Name:    "create plan tables",
+			Up: func(tx *gorm.DB) error {
+				// AutoMigrate, rather than CreateTable, so databases created before versioned
+				// migrations existed are adopted as they are
+				return tx.AutoMigrate(&planV1{}, &planEntryV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&planEntryV1{}, &planV1{})
+			},
+		},
+		{
+			Version: 7,
+			Name:    "add plan announcements, quorum and finalization",
+			Up: func(tx *gorm.DB) error {
+				return migration.AddColumns(tx, &planV7{}, "DiscordWebhookURL", "Quorum", "QuorumReachedAt",
+					"FinalStartUnix", "FinalDurationSeconds", "FinalizedAt")
+			},
+			Down: func(tx *gorm.DB) error {
+				return migration.DropColumns(tx, &planV7{}, "discord_webhook_url", "quorum", "quorum_reached_at",
+					"final_start_unix", "final_duration_seconds", "finalized_at")
+			},
+		},
+		{
+			Version: 9,
+			Name:    "add plan response deadlines and members",
+			Up: func(tx *gorm.DB) error {
+				if err := migration.AddColumns(tx, &planV9{}, "ResponseDeadline"); err != nil {
+					return err
+				}
+				return tx.Migrator().CreateTable(&planMemberV9{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable(&planMemberV9{}); err != nil {
+					return err
+				}
+				return migration.DropColumns(tx, &planV9{}, "response_deadline")
+			},
+		},
+		{
+			Version: 11,
+			Name:    "add plan closing",
+			Up: func(tx *gorm.DB) error {
+				if err := migration.AddColumns(tx, &planV11{}, "ClosedAt", "AutoFinalize"); err != nil {
+					return err
+				}
+				// Plans that already have a deadline get closed at it too. The jobs table exists
+				// since migration 10.
+				now := time.Now()
+				return tx.Exec("INSERT INTO jobs (created_at, updated_at, plan_id, kind, target_time, status, attempts) "+
+					"SELECT ?, ?, id, 'close_plan', response_deadline, 'pending', 0 FROM plans "+
+					"WHERE response_deadline IS NOT NULL AND deleted_at IS NULL", now, now).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Exec("DELETE FROM jobs WHERE kind = 'close_plan'").Error; err != nil {
+					return err
+				}
+				return migration.DropColumns(tx, &planV11{}, "closed_at", "auto_finalize")
+			},
+		},
+		{
+			Version: 12,
+			Name:    "add required plan members",
+			Up: func(tx *gorm.DB) error {
+				if err := migration.AddColumns(tx, &planMemberV12{}, "Required"); err != nil {
+					return err
+				}
+				// Owners are members of their plans from now on, so they can be required too. The
+				// memberships added here are dated to when their plan was created, so Down can tell
+				// them apart from owners who had joined their own plans.
+				return tx.Exec("INSERT INTO plan_members (created_at, plan_id, user_id) " +
+					"SELECT created_at, id, owner_id FROM plans WHERE deleted_at IS NULL AND NOT EXISTS " +
+					"(SELECT 1 FROM plan_members WHERE plan_members.plan_id = plans.id AND plan_members.user_id = plans.owner_id)").Error
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Exec("DELETE FROM plan_members WHERE EXISTS " +
+					"(SELECT 1 FROM plans WHERE plans.id = plan_members.plan_id AND plans.owner_id = plan_members.user_id " +
+					"AND plans.created_at = plan_members.created_at)").Error; err != nil {
+					return err
+				}
+				return migration.DropColumns(tx, &planMemberV12{}, "required")
+			},
+		},
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"gorm.io/gorm/clause"
 
 	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
 	"github.com/wallnutkraken/groupplan/groupdata/users"
 	"gorm.io/gorm"
 )
@@ -26,19 +27,36 @@ func New(db *gorm.DB) *PlanHandler {
 	}
 }
 
-// AllTypes returns all the gorm data types defined in this package, to be used with gorm.AutoMigrate
-func AllTypes() []interface{} {
-	return []interface{}{PlanEntry{}, Plan{}}
-}
-
-// CreatePlan creates a new entry in the database for the given plan.
+// CreatePlan creates a new entry in the database for the given plan, with its owner as its first
+// member, scheduling the reminder before its response deadline and its closing at it, if it has one.
 // It does not create entries for the `Entries` element or its children.
 func (p *PlanHandler) CreatePlan(plan *Plan) error {
 	if err := plan.Validate(); err != nil {
 		return fmt.Errorf("plan failed validation: %w", err)
 	}
-	if err := p.db.Create(plan).Error; err != nil {
-		return fmt.Errorf("failed creating plan: %w", err)
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(plan).Error; err != nil {
+			return fmt.Errorf("failed creating plan: %w", err)
+		}
+		owner := PlanMember{PlanID: plan.ID, UserID: plan.OwnerID}
+		if err := tx.Omit("User").Create(&owner).Error; err != nil {
+			return fmt.Errorf("failed adding the owner to plan: %w", err)
+		}
+		owner.User = plan.Owner
+		plan.Members = append(plan.Members, owner)
+		if plan.ResponseDeadline != nil {
+			return scheduleDeadline(tx, plan.ID, *plan.ResponseDeadline)
+		}
+		return nil
+	})
+}
+
+// scheduleDeadline schedules the jobs happening around a plan's response deadline
+func scheduleDeadline(tx *gorm.DB, planID uint, deadline time.Time) error {
+	for _, kind := range []string{jobs.KindDeadlineReminder, jobs.KindClosePlan} {
+		if err := jobs.New(tx).Schedule(planID, kind, deadline); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -47,11 +65,11 @@ func (p *PlanHandler) CreatePlan(plan *Plan) error {
 // specified plan
 func (p *PlanHandler) GetEntriesOnPlanByUser(planID string, user users.User) ([]PlanEntry, error) {
 	entries := []PlanEntry{}
-	if err := p.db.Where(Plan{
-		Identifier: planID,
-	}, PlanEntry{
-		UserID: user.ID,
-	}).Find(&entries).Error; err != nil {
+	// The identifier lives on the plan, so join against it. Written in plain SQL that works
+	// the same on every supported database engine.
+	if err := p.db.Joins("JOIN plans ON plans.id = plan_entries.plan_id AND plans.deleted_at IS NULL").
+		Where("plans.identifier = ? AND plan_entries.user_id = ?", planID, user.ID).
+		Find(&entries).Error; err != nil {
 		return nil, fmt.Errorf("failed getting entries on plan [%s] made by user with id [%d]: %w", planID, user.ID, err)
 	}
 
@@ -60,7 +78,7 @@ func (p *PlanHandler) GetEntriesOnPlanByUser(planID string, user users.User) ([]
 
 // GetPlan returns an existing Plan by the identifier
 func (p *PlanHandler) GetPlan(identifier string) (plan Plan, err error) {
-	if err = p.db.Preload("Entries.User").Preload(clause.Associations).Where(Plan{Identifier: identifier}).First(&plan).Error; err != nil {
+	if err = p.db.Preload("Entries.User").Preload("Members", orderByID).Preload("Members.User").Preload(clause.Associations).Where(Plan{Identifier: identifier}).First(&plan).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = dataerror.ErrNotFound("no such plan exists")
 		}
@@ -69,12 +87,14 @@ func (p *PlanHandler) GetPlan(identifier string) (plan Plan, err error) {
 	return
 }
 
-// DeletePlan deletes the provided plan from the database
+// DeletePlan deletes the provided plan from the database, cancelling the jobs scheduled on it
 func (p *PlanHandler) DeletePlan(plan Plan) error {
-	if err := p.db.Delete(&plan).Error; err != nil {
-		return fmt.Errorf("failed deleting plan: %w", err)
-	}
-	return nil
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&plan).Error; err != nil {
+			return fmt.Errorf("failed deleting plan: %w", err)
+		}
+		return jobs.New(tx).Cancel(plan.ID)
+	})
 }
 
 // GetPlansByUser returns all plans by a given user
@@ -87,6 +107,122 @@ func (p *PlanHandler) GetPlansByUser(user users.User) ([]Plan, error) {
 	return plans, nil
 }
 
+// ListPlans returns a page of all plans, newest first, along with the total number of plans
+func (p *PlanHandler) ListPlans(offset, limit int) ([]Plan, int64, error) {
+	var total int64
+	if err := p.db.Model(&Plan{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed counting plans: %w", err)
+	}
+	found := []Plan{}
+	if err := p.db.Preload("Owner").Order("id DESC").Offset(offset).Limit(limit).Find(&found).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed listing plans: %w", err)
+	}
+	return found, total, nil
+}
+
+// PlanStats contains aggregate numbers about plans
+type PlanStats struct {
+	Plans           int64
+	Entries         int64
+	PlansLastWeek   int64
+	EntriesLastWeek int64
+}
+
+// GetStats counts plans and entries, overall and created in the past week
+func (p *PlanHandler) GetStats() (stats PlanStats, err error) {
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	if err = p.db.Model(&Plan{}).Count(&stats.Plans).Error; err != nil {
+		return stats, fmt.Errorf("failed counting plans: %w", err)
+	}
+	if err = p.db.Model(&PlanEntry{}).Count(&stats.Entries).Error; err != nil {
+		return stats, fmt.Errorf("failed counting entries: %w", err)
+	}
+	if err = p.db.Model(&Plan{}).Where("created_at > ?", weekAgo).Count(&stats.PlansLastWeek).Error; err != nil {
+		return stats, fmt.Errorf("failed counting recent plans: %w", err)
+	}
+	if err = p.db.Model(&PlanEntry{}).Where("created_at > ?", weekAgo).Count(&stats.EntriesLastWeek).Error; err != nil {
+		return stats, fmt.Errorf("failed counting recent entries: %w", err)
+	}
+	return stats, nil
+}
+
+// ReassignPlan makes the given user the owner of the plan, and a member of it if they weren't one
+func (p *PlanHandler) ReassignPlan(plan *Plan, owner users.User) error {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(plan).Update("owner_id", owner.ID).Error; err != nil {
+			return fmt.Errorf("failed reassigning plan [%s] to user [%d]: %w", plan.Identifier, owner.ID, err)
+		}
+		return New(tx).AddMember(plan, owner)
+	})
+	if err != nil {
+		return err
+	}
+	plan.Owner = owner
+	return nil
+}
+
+// MoveUserData moves every plan owned by, and every entry made by, one user to another user.
+// Entries that overlap ones of the other user on the same plan are merged with them, as a single
+// user can't have overlapping entries.
+func (p *PlanHandler) MoveUserData(from, to users.User) error {
+	if err := p.db.Model(&Plan{}).Where("owner_id = ?", from.ID).Update("owner_id", to.ID).Error; err != nil {
+		return fmt.Errorf("failed moving plans from user [%d] to user [%d]: %w", from.ID, to.ID, err)
+	}
+	if err := p.mergeOverlappingEntries(from, to); err != nil {
+		return err
+	}
+	if err := p.db.Model(&PlanEntry{}).Where("user_id = ?", from.ID).Update("user_id", to.ID).Error; err != nil {
+		return fmt.Errorf("failed moving entries from user [%d] to user [%d]: %w", from.ID, to.ID, err)
+	}
+	// Plans both users are members of would end up with the same member twice, keep the one that
+	// stays required if either was
+	if err := p.db.Model(&PlanMember{}).Where("user_id = ? AND plan_id IN (?)", to.ID, p.db.Model(&PlanMember{}).Select("plan_id").Where("user_id = ? AND required = ?", from.ID, true)).
+		Update("required", true).Error; err != nil {
+		return fmt.Errorf("failed moving required plan memberships from user [%d] to user [%d]: %w", from.ID, to.ID, err)
+	}
+	if err := p.db.Where("user_id = ? AND plan_id IN (?)", from.ID, p.db.Model(&PlanMember{}).Select("plan_id").Where("user_id = ?", to.ID)).
+		Delete(&PlanMember{}).Error; err != nil {
+		return fmt.Errorf("failed removing duplicate plan memberships of user [%d]: %w", from.ID, err)
+	}
+	if err := p.db.Model(&PlanMember{}).Where("user_id = ?", from.ID).Update("user_id", to.ID).Error; err != nil {
+		return fmt.Errorf("failed moving plan memberships from user [%d] to user [%d]: %w", from.ID, to.ID, err)
+	}
+	return nil
+}
+
+// mergeOverlappingEntries merges the entries of two users that overlap or touch on the same plan,
+// the way AddEntry would have refused them for a single user. The earliest entry of every
+// overlapping run is stretched to cover all of it, the others are deleted.
+func (p *PlanHandler) mergeOverlappingEntries(from, to users.User) error {
+	entries := []PlanEntry{}
+	if err := p.db.Where("user_id IN ?", []uint{from.ID, to.ID}).Order("plan_id, start_time_unix").Find(&entries).Error; err != nil {
+		return fmt.Errorf("failed getting the entries of users [%d] and [%d]: %w", from.ID, to.ID, err)
+	}
+	for index := 0; index < len(entries); {
+		merged := entries[index]
+		end := merged.StartTimeUnix + merged.DurationSeconds
+		overlapping := []uint{}
+		next := index + 1
+		for ; next < len(entries) && entries[next].PlanID == merged.PlanID && entries[next].StartTimeUnix <= end; next++ {
+			if nextEnd := entries[next].StartTimeUnix + entries[next].DurationSeconds; nextEnd > end {
+				end = nextEnd
+			}
+			overlapping = append(overlapping, entries[next].ID)
+		}
+		index = next
+		if len(overlapping) == 0 {
+			continue
+		}
+		if err := p.db.Delete(&PlanEntry{}, overlapping).Error; err != nil {
+			return fmt.Errorf("failed deleting entries overlapping entry [%d]: %w", merged.ID, err)
+		}
+		if err := p.db.Model(&PlanEntry{}).Where("id = ?", merged.ID).Update("duration_seconds", end-merged.StartTimeUnix).Error; err != nil {
+			return fmt.Errorf("failed merging entries into entry [%d]: %w", merged.ID, err)
+		}
+	}
+	return nil
+}
+
 // DeleteEntry deletes the plan entry with the associated ID
 func (p *PlanHandler) DeleteEntry(entryID uint) error {
 	if err := p.db.Delete(&PlanEntry{
@@ -119,6 +255,126 @@ func (p *PlanHandler) GetEntry(entryID uint) (entry PlanEntry, err error) {
 	return
 }
 
+// GetPlanIdentifier returns the identifier of the plan with the given database ID, deleted or not
+func (p *PlanHandler) GetPlanIdentifier(planID uint) (string, error) {
+	plan := Plan{}
+	if err := p.db.Unscoped().Select("identifier").Where("id = ?", planID).First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", dataerror.ErrNotFound("no such plan exists")
+		}
+		return "", fmt.Errorf("failed getting the identifier of plan [%d]: %w", planID, err)
+	}
+	return plan.Identifier, nil
+}
+
+// SetDiscordWebhook sets, or with an empty URL removes, the Discord webhook announcements about the
+// plan are posted to
+func (p *PlanHandler) SetDiscordWebhook(plan *Plan, webhookURL string) error {
+	if err := p.db.Model(plan).Update("discord_webhook_url", webhookURL).Error; err != nil {
+		return fmt.Errorf("failed setting the Discord webhook of plan [%s]: %w", plan.Identifier, err)
+	}
+	return nil
+}
+
+// MarkQuorumReached records that the plan reached its quorum at the given time. It returns false,
+// changing nothing, if that was already recorded, so the quorum is only ever reached once.
+func (p *PlanHandler) MarkQuorumReached(plan *Plan, at time.Time) (bool, error) {
+	result := p.db.Model(&Plan{}).Where("id = ? AND quorum_reached_at IS NULL", plan.ID).Update("quorum_reached_at", at)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed marking the quorum of plan [%s] as reached: %w", plan.Identifier, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	plan.QuorumReachedAt = &at
+	return true, nil
+}
+
+// FinalizePlan settles the plan on the given time, scheduling the reminder before it
+func (p *PlanHandler) FinalizePlan(plan *Plan, startUnix, durationSecs int64, at time.Time) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(plan).Updates(map[string]interface{}{
+			"final_start_unix":       startUnix,
+			"final_duration_seconds": durationSecs,
+			"finalized_at":           at,
+		}).Error; err != nil {
+			return fmt.Errorf("failed finalizing plan [%s]: %w", plan.Identifier, err)
+		}
+		return jobs.New(tx).Schedule(plan.ID, jobs.KindEventReminder, time.Unix(startUnix, 0))
+	})
+}
+
+// SetResponseDeadline sets, or with nil removes, the time by which the plan's members should have
+// added their availability, and whether the plan is finalized on its best time then. The reminder
+// before the deadline and the closing at it are rescheduled, a closed plan opening up again.
+func (p *PlanHandler) SetResponseDeadline(plan *Plan, deadline *time.Time, autoFinalize bool) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(plan).Updates(map[string]interface{}{
+			"response_deadline": deadline,
+			"auto_finalize":     autoFinalize,
+			"closed_at":         nil,
+		}).Error; err != nil {
+			return fmt.Errorf("failed setting the response deadline of plan [%s]: %w", plan.Identifier, err)
+		}
+		if deadline == nil {
+			return jobs.New(tx).Cancel(plan.ID, jobs.KindDeadlineReminder, jobs.KindClosePlan)
+		}
+		return scheduleDeadline(tx, plan.ID, *deadline)
+	})
+}
+
+// MarkClosed records that the plan stopped taking availability at the given time. It returns
+// false, changing nothing, if it was already closed, so a plan is only ever closed once.
+func (p *PlanHandler) MarkClosed(plan *Plan, at time.Time) (bool, error) {
+	result := p.db.Model(&Plan{}).Where("id = ? AND closed_at IS NULL", plan.ID).Update("closed_at", at)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed closing plan [%s]: %w", plan.Identifier, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	plan.ClosedAt = &at
+	return true, nil
+}
+
+// SetRequirements sets how many people the plan needs, and which of its members it can't happen
+// without. Changing the quorum forgets that it was reached, so it can be reached again.
+func (p *PlanHandler) SetRequirements(plan *Plan, quorum uint, requiredMemberIDs []uint) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if quorum != plan.Quorum {
+			if err := tx.Model(plan).Updates(map[string]interface{}{
+				"quorum":            quorum,
+				"quorum_reached_at": nil,
+			}).Error; err != nil {
+				return fmt.Errorf("failed setting the quorum of plan [%s]: %w", plan.Identifier, err)
+			}
+		}
+		if err := tx.Model(&PlanMember{}).Where("plan_id = ?", plan.ID).Update("required", false).Error; err != nil {
+			return fmt.Errorf("failed clearing the required members of plan [%s]: %w", plan.Identifier, err)
+		}
+		if len(requiredMemberIDs) == 0 {
+			return nil
+		}
+		if err := tx.Model(&PlanMember{}).Where("plan_id = ? AND id IN ?", plan.ID, requiredMemberIDs).Update("required", true).Error; err != nil {
+			return fmt.Errorf("failed setting the required members of plan [%s]: %w", plan.Identifier, err)
+		}
+		return nil
+	})
+}
+
+// AddMember records that the user joined the plan, making them one of the people expected to add
+// their availability to it. Adding an existing member changes nothing.
+func (p *PlanHandler) AddMember(plan *Plan, user users.User) error {
+	member := PlanMember{
+		PlanID: plan.ID,
+		UserID: user.ID,
+	}
+	if err := p.db.Clauses(clause.OnConflict{DoNothing: true}).Omit("User").Create(&member).Error; err != nil {
+		return fmt.Errorf("failed adding user [%d] to plan [%s]: %w", user.ID, plan.Identifier, err)
+	}
+	return nil
+}
+
 // AddEntry creates a new plan availability entry for a user with a given time range,
 // then adds the created object to the provided Plan pointer.
 func (p *PlanHandler) AddEntry(plan *Plan, user users.User, availFrom, durationSecs int64) (PlanEntry, error) {
@@ -136,13 +392,13 @@ func (p *PlanHandler) AddEntry(plan *Plan, user users.User, availFrom, durationS
 	}
 	// Check if it's within the bounds of its parent plan
 	if plan.FromDateZeroHour().After(time.Unix(availFrom, 0)) {
-		return PlanEntry{}, dataerror.ErrBasic("start at time cannot be before the plan start date")
+		return PlanEntry{}, dataerror.ErrField("start_time_unix", "start at time cannot be before the plan start date")
 	}
 	if plan.EndDate().Before(time.Unix(availFrom, 0)) {
-		return PlanEntry{}, dataerror.ErrBasic("start time can't be after plan end date")
+		return PlanEntry{}, dataerror.ErrField("start_time_unix", "start time can't be after plan end date")
 	}
 	if plan.EndDate().Before(time.Unix(availFrom+durationSecs, 0)) {
-		return PlanEntry{}, dataerror.ErrBasic("this entry would end after the plan ends")
+		return PlanEntry{}, dataerror.ErrField("duration_seconds", "this entry would end after the plan ends")
 	}
 
 	// Check if it overlaps with any current availability
@@ -153,12 +409,18 @@ func (p *PlanHandler) AddEntry(plan *Plan, user users.User, availFrom, durationS
 		return PlanEntry{}, fmt.Errorf("failed checking for conflicting entries: %w", err)
 	}
 	if len(conflicts) != 0 {
-		return PlanEntry{}, dataerror.ErrBasic("availability conflicts with another entry owned by the same user")
+		return PlanEntry{}, dataerror.ErrConflict("availability conflicts with another entry owned by the same user")
 	}
 
-	// Write it to the database
-	if err := p.db.Create(&entry).Error; err != nil {
-		return entry, fmt.Errorf("failed creating plan entry: %w", err)
+	// Write it to the database, the user becoming a member of the plan if they weren't one
+	err = p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return fmt.Errorf("failed creating plan entry: %w", err)
+		}
+		return New(tx).AddMember(plan, user)
+	})
+	if err != nil {
+		return entry, err
 	}
 
 	// Created successfully. Add it to plan and return it.
@@ -178,6 +440,96 @@ type Plan struct {
 	DurationDays               uint        `gorm:"not null"`
 	Entries                    []PlanEntry `gorm:"foreignkey:PlanID"`
 	MinimumAvailabilitySeconds uint        `gorm:"not null"`
+	// DiscordWebhookURL, if set, is where announcements about the plan are posted
+	DiscordWebhookURL string `gorm:"not null;default:''"`
+	// Quorum is how many participants the plan needs, 0 if it doesn't care
+	Quorum          uint `gorm:"not null;default:0"`
+	QuorumReachedAt *time.Time
+	// FinalStartUnix and FinalDurationSeconds are the time the plan was settled on, once FinalizedAt is set
+	FinalStartUnix       int64 `gorm:"not null;default:0"`
+	FinalDurationSeconds int64 `gorm:"not null;default:0"`
+	FinalizedAt          *time.Time
+	// ResponseDeadline, if set, is when the plan's members should have added their availability by.
+	// Once it passes, availability can't be changed anymore, and ClosedAt is set.
+	ResponseDeadline *time.Time
+	ClosedAt         *time.Time
+	// AutoFinalize finalizes the plan on its best time when it closes
+	AutoFinalize bool `gorm:"not null;default:false"`
+	// Members are the users who joined the plan or added their availability to it
+	Members []PlanMember `gorm:"foreignkey:PlanID"`
+}
+
+// PlanMember is a user who joined a plan
+type PlanMember struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	PlanID    uint       `gorm:"not null;uniqueIndex:idx_plan_members_plan_user"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_plan_members_plan_user"`
+	User      users.User `gorm:"foreignkey:UserID"`
+	// Required members have to be available for a time to work for the plan
+	Required bool `gorm:"not null;default:false"`
+}
+
+// Finalized returns whether a time has been settled on for the plan
+func (p Plan) Finalized() bool {
+	return p.FinalizedAt != nil
+}
+
+// Participants returns how many different users have availability on the plan
+func (p Plan) Participants() int {
+	seen := map[uint]bool{}
+	for _, entry := range p.Entries {
+		seen[entry.UserID] = true
+	}
+	return len(seen)
+}
+
+// Closed returns whether the plan's response deadline has passed at the given time, whether it has
+// been marked closed yet or not
+func (p Plan) Closed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ResponseDeadline != nil && !now.Before(*p.ResponseDeadline))
+}
+
+// orderByID orders preloaded rows by their ID, the order they were created in
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// IsMember returns whether the user with the given ID is a member of the plan
+func (p Plan) IsMember(userID uint) bool {
+	for _, member := range p.Members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredUserIDs returns the IDs of the users who have to be available for a time to work for the plan
+func (p Plan) RequiredUserIDs() []uint {
+	required := []uint{}
+	for _, member := range p.Members {
+		if member.Required {
+			required = append(required, member.UserID)
+		}
+	}
+	return required
+}
+
+// MembersWithoutEntries returns the members of the plan who haven't added any availability yet,
+// apart from its owner
+func (p Plan) MembersWithoutEntries() []users.User {
+	responded := map[uint]bool{p.OwnerID: true}
+	for _, entry := range p.Entries {
+		responded[entry.UserID] = true
+	}
+	waiting := []users.User{}
+	for _, member := range p.Members {
+		if !responded[member.UserID] {
+			waiting = append(waiting, member.User)
+		}
+	}
+	return waiting
 }
 
 // FromDateZeroHour takes the given start date and returns a time
@@ -206,17 +558,17 @@ func (p Plan) EndDate() time.Time {
 // Will return nil if the data is valid.
 func (p Plan) Validate() error {
 	if p.FromDateZeroHour().Before(TimeToZeroHour(time.Now())) {
-		return dataerror.ErrBasic("Date cannot be in the past")
+		return dataerror.ErrField("start_date", "Date cannot be in the past")
 	}
 	var minAvailability uint = 60
 	if p.MinimumAvailabilitySeconds < minAvailability {
-		return dataerror.ErrBasic(fmt.Sprintf("Cannot have minimum availability be under %d seconds", minAvailability))
+		return dataerror.ErrField("min_availability_seconds", fmt.Sprintf("Cannot have minimum availability be under %d seconds", minAvailability))
 	}
 	if p.DurationDays == 0 {
-		return dataerror.ErrBasic("Duration cannot be zero days")
+		return dataerror.ErrField("duration_days", "Duration cannot be zero days")
 	}
 	if strings.TrimSpace(p.Title) == "" {
-		return dataerror.ErrBasic("Title cannot be empty")
+		return dataerror.ErrField("title", "Title cannot be empty")
 	}
 	if p.Identifier == "" {
 		return dataerror.ErrBasic("No identifier")
@@ -238,7 +590,7 @@ type PlanEntry struct {
 // Will return nil if the data is valid.
 func (p PlanEntry) Validate() error {
 	if p.StartTimeUnix <= 0 {
-		return dataerror.ErrBasic("Why did you think that would work?")
+		return dataerror.ErrField("start_time_unix", "Why did you think that would work?")
 	}
 	return nil
 }
@@ -2,6 +2,7 @@ package plans_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wallnutkraken/groupplan/groupdata/plans"
@@ -10,8 +11,11 @@ import (
 func TestPlan_HasTitle_ValidateSucceds(t *testing.T) {
 	that := assert.New(t)
 	plan := plans.Plan{
-		Title:      "ads",
-		Identifier: "asd",
+		Title:                      "ads",
+		Identifier:                 "asd",
+		FromDate:                   time.Now(),
+		DurationDays:               1,
+		MinimumAvailabilitySeconds: 60,
 	}
 
 	that.NoError(plan.Validate(), "Validate returned an error when it should not have")
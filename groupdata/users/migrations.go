@@ -0,0 +1,186 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/migration"
+	"gorm.io/gorm"
+)
+
+// The types below are frozen snapshots of the schema at the time of each migration. They must
+// not change along with the live types, or old migrations would start doing something different.
+
+// authenticationProviderV1 is the authentication_providers table as of migration 1
+type authenticationProviderV1 struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"index"`
+}
+
+func (authenticationProviderV1) TableName() string { return "authentication_providers" }
+
+// userV1 is the users table as of migration 1
+type userV1 struct {
+	gorm.Model
+	Email             string `gorm:"unique"`
+	DisplayName       string
+	ProfilePictureURL string
+	AuthPoints        []userAuthPointV1 `gorm:"foreignKey:UserID"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+// userAuthPointV1 is the user_auth_points table as of migration 1
+type userAuthPointV1 struct {
+	ID         uint `gorm:"primarykey"`
+	UserID     uint
+	Identifier string
+	Provider   authenticationProviderV1 `gorm:"foreignkey:ProviderID"`
+	ProviderID uint
+}
+
+func (userAuthPointV1) TableName() string { return "user_auth_points" }
+
+// userV4 contains the columns added to the users table in migration 4
+type userV4 struct {
+	IsAdmin  bool `gorm:"not null;default:false"`
+	Disabled bool `gorm:"not null;default:false"`
+}
+
+func (userV4) TableName() string { return "users" }
+
+// apiTokenV5 is the api_tokens table as of migration 5
+type apiTokenV5 struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint   `gorm:"not null;index"`
+	Name       string `gorm:"not null"`
+	TokenHash  string `gorm:"not null;uniqueIndex"`
+	LastUsedAt *time.Time
+}
+
+func (apiTokenV5) TableName() string { return "api_tokens" }
+
+// userV8 contains the columns added to the users table in migration 8
+type userV8 struct {
+	NotificationWebhookURL string
+	NotificationKey        string
+}
+
+func (userV8) TableName() string { return "users" }
+
+// notificationPreferenceV8 is the notification_preferences table as of migration 8
+type notificationPreferenceV8 struct {
+	ID      uint   `gorm:"primarykey"`
+	UserID  uint   `gorm:"not null;uniqueIndex:idx_notification_preferences_user_event"`
+	Event   string `gorm:"not null;uniqueIndex:idx_notification_preferences_user_event"`
+	Channel string `gorm:"not null"`
+	Digest  bool   `gorm:"not null;default:false"`
+}
+
+func (notificationPreferenceV8) TableName() string { return "notification_preferences" }
+
+// digestItemV8 is the digest_items table as of migration 8
+type digestItemV8 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	Channel   string `gorm:"not null"`
+	Event     string `gorm:"not null"`
+	Summary   string `gorm:"not null"`
+}
+
+func (digestItemV8) TableName() string { return "digest_items" }
+
+// Migrations returns the schema migrations of the users package
+func Migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 1,
+			Name:    "create user tables",
+			Up: func(tx *gorm.DB) error {
+				// AutoMigrate, rather than CreateTable, so databases created before versioned
+				// migrations existed are adopted as they are
+				return tx.AutoMigrate(&authenticationProviderV1{}, &userV1{}, &userAuthPointV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&userAuthPointV1{}, &userV1{}, &authenticationProviderV1{})
+			},
+		},
+		{
+			Version: 3,
+			Name:    "seed authentication providers",
+			Up:      seedProviders,
+			Down: func(tx *gorm.DB) error {
+				// Providers are referenced by auth points, so they're left in place. They're
+				// harmless to keep, and seeding again skips the existing ones.
+				return nil
+			},
+		},
+		{
+			Version: 4,
+			Name:    "add user admin and disabled flags",
+			Up: func(tx *gorm.DB) error {
+				return migration.AddColumns(tx, &userV4{}, "IsAdmin", "Disabled")
+			},
+			Down: func(tx *gorm.DB) error {
+				return migration.DropColumns(tx, &userV4{}, "is_admin", "disabled")
+			},
+		},
+		{
+			Version: 5,
+			Name:    "create api tokens",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&apiTokenV5{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&apiTokenV5{})
+			},
+		},
+		{
+			Version: 8,
+			Name:    "add notification preferences",
+			Up: func(tx *gorm.DB) error {
+				if err := migration.AddColumns(tx, &userV8{}, "NotificationWebhookURL", "NotificationKey"); err != nil {
+					return err
+				}
+				return tx.Migrator().CreateTable(&notificationPreferenceV8{}, &digestItemV8{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable(&digestItemV8{}, &notificationPreferenceV8{}); err != nil {
+					return err
+				}
+				return migration.DropColumns(tx, &userV8{}, "notification_webhook_url", "notification_key")
+			},
+		},
+	}
+}
+
+// seedProviders ensures every supported authentication provider exists in the database
+func seedProviders(tx *gorm.DB) error {
+	authProviders := []authenticationProviderV1{}
+	if err := tx.Find(&authProviders).Error; err != nil {
+		return fmt.Errorf("failed getting auth providers: %w", err)
+	}
+	// Create an array of missing providers so we can add them later
+	missing := []authenticationProviderV1{}
+	for _, provider := range supportedProviders {
+		found := false
+		for _, existing := range authProviders {
+			if existing.Name == provider {
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, authenticationProviderV1{Name: provider})
+		}
+	}
+
+	// Save each missing provider
+	for _, prov := range missing {
+		if err := tx.Create(&prov).Error; err != nil {
+			return fmt.Errorf("failed saving provider [%s] to database: %w", prov.Name, err)
+		}
+	}
+	return nil
+}
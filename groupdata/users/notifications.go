@@ -0,0 +1,112 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationPreference is how a user wants to hear about one kind of notification. Kinds of
+// notification without a preference are emailed right away.
+type NotificationPreference struct {
+	ID     uint   `gorm:"primarykey"`
+	UserID uint   `gorm:"not null;uniqueIndex:idx_notification_preferences_user_event"`
+	Event  string `gorm:"not null;uniqueIndex:idx_notification_preferences_user_event"`
+	// Channel is where the notification is sent, "email", "discord" or "none"
+	Channel string `gorm:"not null"`
+	// Digest collects the notifications into one message a day, instead of sending each right away
+	Digest bool `gorm:"not null;default:false"`
+}
+
+// DigestItem is a notification waiting to be sent as part of a user's next digest
+type DigestItem struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	Channel   string `gorm:"not null"`
+	Event     string `gorm:"not null"`
+	// Summary is the one line describing the notification in the digest
+	Summary string `gorm:"not null"`
+}
+
+// GetNotificationPreferences returns the notification preferences of a user, those that differ
+// from the default at least
+func (u UserHandler) GetNotificationPreferences(userID uint) ([]NotificationPreference, error) {
+	preferences := []NotificationPreference{}
+	if err := u.db.Where(NotificationPreference{UserID: userID}).Order("event").Find(&preferences).Error; err != nil {
+		return nil, fmt.Errorf("failed getting notification preferences of user [%d]: %w", userID, err)
+	}
+	return preferences, nil
+}
+
+// SetNotificationPreferences saves the given notification preferences of a user, replacing the
+// ones for the same events, along with the Discord webhook their Discord notifications go to
+func (u UserHandler) SetNotificationPreferences(user *User, webhookURL string, preferences []NotificationPreference) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("notification_webhook_url", webhookURL).Error; err != nil {
+			return fmt.Errorf("failed setting notification webhook of user [%d]: %w", user.ID, err)
+		}
+		for index := range preferences {
+			preferences[index].UserID = user.ID
+		}
+		if len(preferences) == 0 {
+			return nil
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "event"}},
+			DoUpdates: clause.AssignmentColumns([]string{"channel", "digest"}),
+		}).Create(&preferences).Error; err != nil {
+			return fmt.Errorf("failed saving notification preferences of user [%d]: %w", user.ID, err)
+		}
+		return nil
+	})
+}
+
+// SetNotificationKey sets the key the user's unsubscribe links are signed with. Changing it
+// invalidates every link sent before.
+func (u UserHandler) SetNotificationKey(user *User, key string) error {
+	if err := u.db.Model(user).Update("notification_key", key).Error; err != nil {
+		return fmt.Errorf("failed setting notification key of user [%d]: %w", user.ID, err)
+	}
+	return nil
+}
+
+// AddDigestItem saves a notification for the user's next digest
+func (u UserHandler) AddDigestItem(item *DigestItem) error {
+	if err := u.db.Create(item).Error; err != nil {
+		return fmt.Errorf("failed saving digest item for user [%d]: %w", item.UserID, err)
+	}
+	return nil
+}
+
+// DueDigests returns the IDs of the users with a digest item from before the given time, whose
+// digest is due
+func (u UserHandler) DueDigests(before time.Time) ([]uint, error) {
+	userIDs := []uint{}
+	if err := u.db.Model(&DigestItem{}).Distinct("user_id").Where("created_at < ?", before).Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed finding due digests: %w", err)
+	}
+	return userIDs, nil
+}
+
+// ListDigestItems returns every digest item of a user, oldest first
+func (u UserHandler) ListDigestItems(userID uint) ([]DigestItem, error) {
+	items := []DigestItem{}
+	if err := u.db.Where(DigestItem{UserID: userID}).Order("id").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed listing digest items of user [%d]: %w", userID, err)
+	}
+	return items, nil
+}
+
+// DeleteDigestItems deletes the given digest items, once they've been sent
+func (u UserHandler) DeleteDigestItems(items []DigestItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := u.db.Delete(&items).Error; err != nil {
+		return fmt.Errorf("failed deleting %d digest items: %w", len(items), err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"gorm.io/gorm"
+)
+
+// APIToken is a long-lived token a user created for scripts and the command-line client.
+// Only a hash of the token itself is stored.
+type APIToken struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint   `gorm:"not null;index"`
+	User       User   `gorm:"foreignkey:UserID"`
+	Name       string `gorm:"not null"`
+	TokenHash  string `gorm:"not null;uniqueIndex"`
+	LastUsedAt *time.Time
+}
+
+// CreateAPIToken saves a new API token
+func (u UserHandler) CreateAPIToken(token *APIToken) error {
+	if err := u.db.Omit("User").Create(token).Error; err != nil {
+		return fmt.Errorf("failed creating API token for user [%d]: %w", token.UserID, err)
+	}
+	return nil
+}
+
+// GetAPITokenByHash returns the API token with the given hash, along with its user
+func (u UserHandler) GetAPITokenByHash(hash string) (token APIToken, err error) {
+	if err = u.db.Preload("User").Where(APIToken{TokenHash: hash}).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = dataerror.ErrNotFound("no such API token exists")
+		}
+		err = fmt.Errorf("failed getting API token: %w", err)
+	}
+	return
+}
+
+// ListAPITokens returns every API token of a user, oldest first
+func (u UserHandler) ListAPITokens(user User) ([]APIToken, error) {
+	tokens := []APIToken{}
+	if err := u.db.Where(APIToken{UserID: user.ID}).Order("id").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed listing API tokens of user [%d]: %w", user.ID, err)
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken deletes one of the user's API tokens
+func (u UserHandler) DeleteAPIToken(user User, tokenID uint) error {
+	result := u.db.Where(APIToken{UserID: user.ID}).Delete(&APIToken{}, tokenID)
+	if result.Error != nil {
+		return fmt.Errorf("failed deleting API token [%d]: %w", tokenID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return dataerror.ErrNotFound("no such API token exists")
+	}
+	return nil
+}
+
+// TouchAPIToken records that the token was just used
+func (u UserHandler) TouchAPIToken(token *APIToken) error {
+	now := time.Now()
+	if err := u.db.Model(token).Update("last_used_at", now).Error; err != nil {
+		return fmt.Errorf("failed updating last use of API token [%d]: %w", token.ID, err)
+	}
+	token.LastUsedAt = &now
+	return nil
+}
+
+// MoveAPITokens moves every API token of one user to another
+func (u UserHandler) MoveAPITokens(from, to User) error {
+	if err := u.db.Model(&APIToken{}).Where(APIToken{UserID: from.ID}).Update("user_id", to.ID).Error; err != nil {
+		return fmt.Errorf("failed moving API tokens from user [%d] to [%d]: %w", from.ID, to.ID, err)
+	}
+	return nil
+}
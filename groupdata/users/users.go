@@ -2,8 +2,11 @@
 package users
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -74,6 +77,150 @@ func (u UserHandler) UserAuthorizedWith(user User, provider AuthenticationProvid
 	return authPt, nil
 }
 
+// ListUsers returns a page of users ordered by ID, along with the total number of users
+func (u UserHandler) ListUsers(offset, limit int) ([]User, int64, error) {
+	var total int64
+	if err := u.db.Model(&User{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed counting users: %w", err)
+	}
+	found := []User{}
+	if err := u.db.Order("id").Offset(offset).Limit(limit).Find(&found).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed listing users: %w", err)
+	}
+	return found, total, nil
+}
+
+// FindUsers returns every user whose email address or display name contains the query, case-insensitively
+func (u UserHandler) FindUsers(query string) ([]User, error) {
+	pattern := "%" + strings.ToLower(query) + "%"
+	found := []User{}
+	if err := u.db.Where("LOWER(email) LIKE ? OR LOWER(display_name) LIKE ?", pattern, pattern).Order("id").Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("failed searching users for [%s]: %w", query, err)
+	}
+	return found, nil
+}
+
+// GetUser returns the user with the given ID, along with their authentication points
+func (u UserHandler) GetUser(id uint) (user User, err error) {
+	if err = u.db.Preload("AuthPoints.Provider").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = dataerror.ErrNotFound("no such user exists")
+		}
+		err = fmt.Errorf("failed getting user [%d]: %w", id, err)
+	}
+	return
+}
+
+// GetUserByEmail returns the user with the given email address, along with their authentication points
+func (u UserHandler) GetUserByEmail(email string) (user User, err error) {
+	if err = u.db.Preload("AuthPoints.Provider").Where(User{Email: email}).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = dataerror.ErrNotFound("no such user exists")
+		}
+		err = fmt.Errorf("failed getting user with email [%s]: %w", email, err)
+	}
+	return
+}
+
+// GetUserByAuthPoint returns the user who authenticated with the given provider under the given
+// identifier, such as the user's ID on the provider's side
+func (u UserHandler) GetUserByAuthPoint(provider, identifier string) (user User, err error) {
+	if err = u.db.Joins("JOIN user_auth_points ON user_auth_points.user_id = users.id").
+		Joins("JOIN authentication_providers ON authentication_providers.id = user_auth_points.provider_id").
+		Where("authentication_providers.name = ? AND user_auth_points.identifier = ?", provider, identifier).
+		First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = dataerror.ErrNotFound("no such user exists")
+		}
+		err = fmt.Errorf("failed getting user with [%s] identifier [%s]: %w", provider, identifier, err)
+	}
+	return
+}
+
+// MergeAuthPoints moves the authentication points of the duplicate user to the kept user. Points for
+// a provider the kept user is already authenticated with are deleted instead.
+func (u UserHandler) MergeAuthPoints(keep, duplicate User) error {
+	kept := []UserAuthPoint{}
+	if err := u.db.Where(UserAuthPoint{UserID: keep.ID}).Find(&kept).Error; err != nil {
+		return fmt.Errorf("failed getting auth points of user [%d]: %w", keep.ID, err)
+	}
+	moving := []UserAuthPoint{}
+	if err := u.db.Where(UserAuthPoint{UserID: duplicate.ID}).Find(&moving).Error; err != nil {
+		return fmt.Errorf("failed getting auth points of user [%d]: %w", duplicate.ID, err)
+	}
+	for _, point := range moving {
+		alreadyHas := false
+		for _, existing := range kept {
+			if existing.ProviderID == point.ProviderID {
+				alreadyHas = true
+			}
+		}
+		if alreadyHas {
+			if err := u.db.Delete(&point).Error; err != nil {
+				return fmt.Errorf("failed deleting duplicate auth point [%d]: %w", point.ID, err)
+			}
+			continue
+		}
+		if err := u.db.Model(&point).Update("user_id", keep.ID).Error; err != nil {
+			return fmt.Errorf("failed moving auth point [%d]: %w", point.ID, err)
+		}
+	}
+	return nil
+}
+
+// SetAdmin grants or revokes the admin capability of a user
+func (u UserHandler) SetAdmin(user *User, admin bool) error {
+	if err := u.db.Model(user).Update("is_admin", admin).Error; err != nil {
+		return fmt.Errorf("failed setting admin to [%t] for user [%d]: %w", admin, user.ID, err)
+	}
+	return nil
+}
+
+// SetDisabled disables or re-enables a user account
+func (u UserHandler) SetDisabled(user *User, disabled bool) error {
+	if err := u.db.Model(user).Update("disabled", disabled).Error; err != nil {
+		return fmt.Errorf("failed setting disabled to [%t] for user [%d]: %w", disabled, user.ID, err)
+	}
+	return nil
+}
+
+// UserStats contains aggregate numbers about users
+type UserStats struct {
+	Total    int64
+	Admins   int64
+	Disabled int64
+}
+
+// GetStats counts the users, admins and disabled users
+func (u UserHandler) GetStats() (stats UserStats, err error) {
+	if err = u.db.Model(&User{}).Count(&stats.Total).Error; err != nil {
+		return stats, fmt.Errorf("failed counting users: %w", err)
+	}
+	if err = u.db.Model(&User{}).Where("is_admin = ?", true).Count(&stats.Admins).Error; err != nil {
+		return stats, fmt.Errorf("failed counting admins: %w", err)
+	}
+	if err = u.db.Model(&User{}).Where("disabled = ?", true).Count(&stats.Disabled).Error; err != nil {
+		return stats, fmt.Errorf("failed counting disabled users: %w", err)
+	}
+	return stats, nil
+}
+
+// RetireUser disables a user whose data was moved to another one, deleting what of theirs is left.
+// The user itself stays, so logging in with their email address, or using a session they still
+// have, is refused instead of creating them again.
+func (u UserHandler) RetireUser(user *User) error {
+	if err := u.db.Where(APIToken{UserID: user.ID}).Delete(&APIToken{}).Error; err != nil {
+		return fmt.Errorf("failed deleting API tokens of user [%d]: %w", user.ID, err)
+	}
+	if err := u.db.Where(NotificationPreference{UserID: user.ID}).Delete(&NotificationPreference{}).Error; err != nil {
+		return fmt.Errorf("failed deleting notification preferences of user [%d]: %w", user.ID, err)
+	}
+	if err := u.db.Where(DigestItem{UserID: user.ID}).Delete(&DigestItem{}).Error; err != nil {
+		return fmt.Errorf("failed deleting digest items of user [%d]: %w", user.ID, err)
+	}
+	return u.SetDisabled(user, true)
+}
+
 // AuthenticationProvider contains information about an oauth provider
 type AuthenticationProvider struct {
 	ID   uint   `gorm:"primarykey"`
@@ -87,6 +234,14 @@ type User struct {
 	DisplayName       string
 	ProfilePictureURL string
 	AuthPoints        []UserAuthPoint `gorm:"foreignKey:UserID"`
+	IsAdmin           bool            `gorm:"not null;default:false"`
+	Disabled          bool            `gorm:"not null;default:false"`
+	// NotificationWebhookURL is the Discord webhook the user's Discord notifications are posted to
+	NotificationWebhookURL string
+	// NotificationKey signs the user's unsubscribe links, it's set when the first one is made
+	NotificationKey string
+	// NotificationPreferences are how the user wants to hear about each kind of notification
+	NotificationPreferences []NotificationPreference `gorm:"foreignKey:UserID"`
 }
 
 // UserAuthPoint contains information about a single point of authentication for a user
@@ -97,39 +252,3 @@ type UserAuthPoint struct {
 	Provider   AuthenticationProvider `gorm:"foreignkey:ProviderID"`
 	ProviderID uint
 }
-
-// AllTypes returns all the gorm data types defined in this package, to be used with gorm.AutoMigrate
-func AllTypes() []interface{} {
-	return []interface{}{AuthenticationProvider{}, User{}, UserAuthPoint{}}
-}
-
-// Migrate ensures the necessary minimum data exists in the database
-func Migrate(db *gorm.DB) error {
-	authProviders := []AuthenticationProvider{}
-	if err := db.Find(&authProviders).Error; err != nil {
-		return fmt.Errorf("failed getting auth providers: %w", err)
-	}
-	// Create an array of missing providers so we can add them later
-	missing := []AuthenticationProvider{}
-	for _, provider := range supportedProviders {
-		found := false
-		for _, existing := range authProviders {
-			if existing.Name == provider {
-				found = true
-			}
-		}
-		if !found {
-			missing = append(missing, AuthenticationProvider{Name: provider})
-		}
-	}
-
-	// Save each missing provider
-	for _, prov := range missing {
-		if err := db.Create(&prov).Error; err != nil {
-			return fmt.Errorf("failed saving provider [%s] to database: %w", prov.Name, err)
-		}
-	}
-
-	// All done!
-	return nil
-}
@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/migration"
+	"gorm.io/gorm"
+)
+
+// The types below are frozen snapshots of the schema at the time of each migration. They must
+// not change along with the live types, or old migrations would start doing something different.
+
+// webhookV6 is the webhooks table as of migration 6
+type webhookV6 struct {
+	gorm.Model
+	PlanID uint   `gorm:"not null;index"`
+	URL    string `gorm:"not null"`
+	Secret string `gorm:"not null"`
+	Events string `gorm:"not null"`
+}
+
+func (webhookV6) TableName() string { return "webhooks" }
+
+// deliveryV6 is the deliveries table as of migration 6
+type deliveryV6 struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uint   `gorm:"not null;index"`
+	Event          string `gorm:"not null"`
+	Payload        string `gorm:"not null"`
+	Status         string `gorm:"not null;index"`
+	Attempts       uint   `gorm:"not null"`
+	NextAttemptAt  time.Time
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    *time.Time
+}
+
+func (deliveryV6) TableName() string { return "deliveries" }
+
+// Migrations returns the schema migrations of the webhooks package
+func Migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 6,
+			Name:    "create webhook tables",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&webhookV6{}, &deliveryV6{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&deliveryV6{}, &webhookV6{})
+			},
+		},
+	}
+}
@@ -0,0 +1,162 @@
+// Package webhooks is responsible for storing the webhooks registered on plans, and the log of
+// deliveries made to them
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"gorm.io/gorm"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Webhook is a URL that's sent the events of a plan
+type Webhook struct {
+	gorm.Model
+	PlanID uint   `gorm:"not null;index"`
+	URL    string `gorm:"not null"`
+	// Secret signs every delivery, so the receiver can tell it came from us
+	Secret string `gorm:"not null"`
+	// Events is a comma-separated list of the event types sent, empty meaning all of them
+	Events string `gorm:"not null"`
+}
+
+// Delivery is a single event sent, or yet to be sent, to a webhook
+type Delivery struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	WebhookID uint    `gorm:"not null;index"`
+	Webhook   Webhook `gorm:"foreignkey:WebhookID"`
+	Event     string  `gorm:"not null"`
+	// Payload is the JSON body, exactly as it's sent on every attempt
+	Payload       string `gorm:"not null"`
+	Status        string `gorm:"not null;index"`
+	Attempts      uint   `gorm:"not null"`
+	NextAttemptAt time.Time
+	// ResponseStatus is the HTTP status of the last attempt, 0 if it got no response
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    *time.Time
+}
+
+// Handler is the data sub-handler for webhooks and their deliveries
+type Handler struct {
+	db *gorm.DB
+}
+
+// New creates a new instance of the webhooks Handler with the given gorm DB instance
+func New(db *gorm.DB) *Handler {
+	return &Handler{
+		db: db,
+	}
+}
+
+// CreateWebhook saves a new webhook
+func (h *Handler) CreateWebhook(hook *Webhook) error {
+	if err := h.db.Create(hook).Error; err != nil {
+		return fmt.Errorf("failed creating webhook on plan [%d]: %w", hook.PlanID, err)
+	}
+	return nil
+}
+
+// ListWebhooks returns the webhooks of a plan, oldest first
+func (h *Handler) ListWebhooks(planID uint) ([]Webhook, error) {
+	hooks := []Webhook{}
+	if err := h.db.Where(Webhook{PlanID: planID}).Order("id").Find(&hooks).Error; err != nil {
+		return nil, fmt.Errorf("failed listing webhooks of plan [%d]: %w", planID, err)
+	}
+	return hooks, nil
+}
+
+// ListWebhooksByPlanIdentifier returns the webhooks of a plan by its identifier, including plans
+// that have just been deleted, so they can be told about it
+func (h *Handler) ListWebhooksByPlanIdentifier(identifier string) ([]Webhook, error) {
+	hooks := []Webhook{}
+	if err := h.db.Joins("JOIN plans ON plans.id = webhooks.plan_id").
+		Where("plans.identifier = ?", identifier).Order("webhooks.id").Find(&hooks).Error; err != nil {
+		return nil, fmt.Errorf("failed listing webhooks of plan [%s]: %w", identifier, err)
+	}
+	return hooks, nil
+}
+
+// GetWebhook returns a webhook of a plan
+func (h *Handler) GetWebhook(planID, webhookID uint) (hook Webhook, err error) {
+	if err = h.db.Where(Webhook{PlanID: planID}).First(&hook, webhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = dataerror.ErrNotFound("no such webhook exists")
+		}
+		err = fmt.Errorf("failed getting webhook [%d]: %w", webhookID, err)
+	}
+	return
+}
+
+// DeleteWebhook deletes a webhook of a plan, along with its deliveries
+func (h *Handler) DeleteWebhook(planID, webhookID uint) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where(Webhook{PlanID: planID}).Delete(&Webhook{}, webhookID)
+		if result.Error != nil {
+			return fmt.Errorf("failed deleting webhook [%d]: %w", webhookID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return dataerror.ErrNotFound("no such webhook exists")
+		}
+		if err := tx.Where(Delivery{WebhookID: webhookID}).Delete(&Delivery{}).Error; err != nil {
+			return fmt.Errorf("failed deleting deliveries of webhook [%d]: %w", webhookID, err)
+		}
+		return nil
+	})
+}
+
+// CreateDelivery queues up a new delivery
+func (h *Handler) CreateDelivery(delivery *Delivery) error {
+	if err := h.db.Omit("Webhook").Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed creating delivery to webhook [%d]: %w", delivery.WebhookID, err)
+	}
+	return nil
+}
+
+// DueDeliveries returns up to limit pending deliveries that are due to be attempted, along with
+// their webhooks, the longest waiting first
+func (h *Handler) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	due := []Delivery{}
+	if err := h.db.Preload("Webhook").Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed getting due deliveries: %w", err)
+	}
+	return due, nil
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt
+func (h *Handler) UpdateDelivery(delivery *Delivery) error {
+	if err := h.db.Omit("Webhook").Save(delivery).Error; err != nil {
+		return fmt.Errorf("failed updating delivery [%d]: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries to a webhook, newest first
+func (h *Handler) ListDeliveries(webhookID uint, limit int) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	if err := h.db.Where(Delivery{WebhookID: webhookID}).Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed listing deliveries of webhook [%d]: %w", webhookID, err)
+	}
+	return deliveries, nil
+}
+
+// PruneDeliveries deletes finished deliveries created before the given time, returning how many
+func (h *Handler) PruneDeliveries(before time.Time) (int64, error) {
+	result := h.db.Where("status <> ? AND created_at < ?", StatusPending, before).Delete(&Delivery{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed pruning deliveries: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,284 @@
+// Package hookman is the webhook manager, it lets plan owners register webhooks and delivers the
+// events of their plans to them in the background, retrying failed deliveries
+package hookman
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/groupdata/webhooks"
+	"github.com/wallnutkraken/groupplan/secid"
+)
+
+// The headers sent with every delivery
+const (
+	HeaderEvent     = "X-Groupplan-Event"
+	HeaderDelivery  = "X-Groupplan-Delivery"
+	HeaderTimestamp = "X-Groupplan-Timestamp"
+	HeaderSignature = "X-Groupplan-Signature"
+)
+
+const (
+	// maxWebhooksPerPlan limits how many webhooks a single plan can have
+	maxWebhooksPerPlan = 5
+	// maxURLLength is the longest webhook URL accepted
+	maxURLLength = 2048
+	// defaultDeliveryLimit and maxDeliveryLimit bound how many deliveries are listed at once
+	defaultDeliveryLimit = 20
+	maxDeliveryLimit     = 100
+)
+
+// Events are the event types webhooks can receive
+var Events = []events.Type{events.EntryAdded, events.EntryRemoved, events.QuorumReached, events.PlanFinalized, events.PlanClosed, events.PlanDeleted}
+
+// HookData is the interface for what the webhook persistence layer should provide the Manager
+type HookData interface {
+	CreateWebhook(hook *webhooks.Webhook) error
+	ListWebhooks(planID uint) ([]webhooks.Webhook, error)
+	ListWebhooksByPlanIdentifier(identifier string) ([]webhooks.Webhook, error)
+	GetWebhook(planID, webhookID uint) (webhooks.Webhook, error)
+	DeleteWebhook(planID, webhookID uint) error
+	CreateDelivery(delivery *webhooks.Delivery) error
+	DueDeliveries(now time.Time, limit int) ([]webhooks.Delivery, error)
+	UpdateDelivery(delivery *webhooks.Delivery) error
+	ListDeliveries(webhookID uint, limit int) ([]webhooks.Delivery, error)
+	PruneDeliveries(before time.Time) (int64, error)
+}
+
+// PlanData is the part of the plan persistence layer the Manager needs, to check plan ownership
+type PlanData interface {
+	GetPlan(identifier string) (plans.Plan, error)
+}
+
+// Webhook describes a webhook. The secret is only filled in when the webhook is created.
+type Webhook struct {
+	ID        uint          `json:"id"`
+	URL       string        `json:"url"`
+	Events    []events.Type `json:"events"`
+	Secret    string        `json:"secret,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// FillFromDataType fills the Webhook object from the provided database type, without the secret
+func (w *Webhook) FillFromDataType(hook webhooks.Webhook) {
+	w.ID = hook.ID
+	w.URL = hook.URL
+	w.Events = splitEvents(hook.Events)
+	w.CreatedAt = hook.CreatedAt
+}
+
+// Delivery describes a single event sent, or yet to be sent, to a webhook
+type Delivery struct {
+	ID             uint        `json:"id"`
+	Event          events.Type `json:"event"`
+	Status         string      `json:"status"`
+	Attempts       uint        `json:"attempts"`
+	ResponseStatus int         `json:"response_status,omitempty"`
+	LastError      string      `json:"last_error,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	NextAttemptAt  *time.Time  `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time  `json:"delivered_at,omitempty"`
+}
+
+// FillFromDataType fills the Delivery object from the provided database type
+func (d *Delivery) FillFromDataType(delivery webhooks.Delivery) {
+	d.ID = delivery.ID
+	d.Event = events.Type(delivery.Event)
+	d.Status = delivery.Status
+	d.Attempts = delivery.Attempts
+	d.ResponseStatus = delivery.ResponseStatus
+	d.LastError = delivery.LastError
+	d.CreatedAt = delivery.CreatedAt
+	if delivery.Status == webhooks.StatusPending {
+		next := delivery.NextAttemptAt
+		d.NextAttemptAt = &next
+	}
+	d.DeliveredAt = delivery.DeliveredAt
+}
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	Event      events.Type `json:"event"`
+	Plan       string      `json:"plan"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Sign returns the signature of a delivery body sent at the given unix time, as found in the
+// X-Groupplan-Signature header: sha256= followed by the hex HMAC-SHA256 of the timestamp, a dot
+// and the body, keyed with the webhook's secret. Receivers should compute the same and compare.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ownedPlan returns the plan with the identifier, if the user owns it
+func (m *Manager) ownedPlan(identifier string, user users.User) (plans.Plan, error) {
+	plan, err := m.plans.GetPlan(identifier)
+	if err != nil {
+		return plan, err
+	}
+	if plan.OwnerID != user.ID {
+		return plan, dataerror.ErrForbidden("only the owner of a plan can manage its webhooks")
+	}
+	return plan, nil
+}
+
+// CreateWebhook registers a webhook on a plan owned by the user. No event types means all of them.
+func (m *Manager) CreateWebhook(identifier string, user users.User, rawURL string, eventTypes []events.Type) (Webhook, error) {
+	plan, err := m.ownedPlan(identifier, user)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := validateURL(rawURL); err != nil {
+		return Webhook{}, err
+	}
+	for _, eventType := range eventTypes {
+		if !knownEvent(eventType) {
+			return Webhook{}, dataerror.ErrField("events", fmt.Sprintf("unknown event type [%s]", eventType))
+		}
+	}
+	existing, err := m.data.ListWebhooks(plan.ID)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if len(existing) >= maxWebhooksPerPlan {
+		return Webhook{}, dataerror.ErrConflict(fmt.Sprintf("a plan can have at most %d webhooks", maxWebhooksPerPlan))
+	}
+	secret, err := secid.String(32)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("failed creating webhook secret: %w", err)
+	}
+	names := make([]string, len(eventTypes))
+	for index, eventType := range eventTypes {
+		names[index] = string(eventType)
+	}
+	hook := webhooks.Webhook{
+		PlanID: plan.ID,
+		URL:    rawURL,
+		Secret: secret,
+		Events: strings.Join(names, ","),
+	}
+	if err := m.data.CreateWebhook(&hook); err != nil {
+		return Webhook{}, err
+	}
+	created := Webhook{}
+	created.FillFromDataType(hook)
+	created.Secret = hook.Secret
+	return created, nil
+}
+
+// ListWebhooks returns the webhooks of a plan owned by the user
+func (m *Manager) ListWebhooks(identifier string, user users.User) ([]Webhook, error) {
+	plan, err := m.ownedPlan(identifier, user)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := m.data.ListWebhooks(plan.ID)
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]Webhook, len(hooks))
+	for index, hook := range hooks {
+		converted[index].FillFromDataType(hook)
+	}
+	return converted, nil
+}
+
+// DeleteWebhook deletes a webhook of a plan owned by the user, and its pending deliveries with it
+func (m *Manager) DeleteWebhook(identifier string, user users.User, webhookID uint) error {
+	plan, err := m.ownedPlan(identifier, user)
+	if err != nil {
+		return err
+	}
+	return m.data.DeleteWebhook(plan.ID, webhookID)
+}
+
+// ListDeliveries returns the latest deliveries to a webhook of a plan owned by the user, newest
+// first. A limit of 0 uses the default.
+func (m *Manager) ListDeliveries(identifier string, user users.User, webhookID uint, limit int) ([]Delivery, error) {
+	if limit == 0 {
+		limit = defaultDeliveryLimit
+	}
+	if limit < 1 || limit > maxDeliveryLimit {
+		return nil, dataerror.ErrField("limit", fmt.Sprintf("limit must be a number between 1 and %d", maxDeliveryLimit))
+	}
+	plan, err := m.ownedPlan(identifier, user)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := m.data.GetWebhook(plan.ID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := m.data.ListDeliveries(hook.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]Delivery, len(deliveries))
+	for index, delivery := range deliveries {
+		converted[index].FillFromDataType(delivery)
+	}
+	return converted, nil
+}
+
+// validateURL checks that a webhook URL is an absolute http or https URL
+func validateURL(rawURL string) error {
+	if len(rawURL) > maxURLLength {
+		return dataerror.ErrField("url", fmt.Sprintf("the URL cannot be longer than %d characters", maxURLLength))
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return dataerror.ErrField("url", "the URL must be an absolute http or https URL")
+	}
+	if parsed.User != nil {
+		return dataerror.ErrField("url", "the URL cannot contain credentials")
+	}
+	return nil
+}
+
+// knownEvent returns whether webhooks can receive the event type
+func knownEvent(eventType events.Type) bool {
+	for _, known := range Events {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// splitEvents turns the stored list of event types back into a slice, an empty list meaning all
+func splitEvents(stored string) []events.Type {
+	if stored == "" {
+		return append([]events.Type{}, Events...)
+	}
+	names := strings.Split(stored, ",")
+	types := make([]events.Type, len(names))
+	for index, name := range names {
+		types[index] = events.Type(name)
+	}
+	return types
+}
+
+// wants returns whether the webhook receives the event type
+func wants(hook webhooks.Webhook, eventType events.Type) bool {
+	for _, wanted := range splitEvents(hook.Events) {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package hookman
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/groupdata/webhooks"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// setup returns a Manager on a fresh database, with a plan owned by the returned user
+func setup(t *testing.T) (*Manager, groupdata.Data, planman.GroupPlan, users.User) {
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	owner, err := userman.New(db.Users(), nil).Authenticate("owner@example.com", "", "discord", "1", "Owner")
+	require.NoError(t, err)
+	plan, err := planman.New(db.Plans(), events.NewHub()).NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, owner, planman.PlanOptions{})
+	require.NoError(t, err)
+	return New(db.Webhooks(), db.Plans(), http.DefaultClient), db, plan, owner
+}
+
+func TestDelivery_IsSigned(t *testing.T) {
+	that := assert.New(t)
+	received := make(chan *http.Request, 1)
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		received <- r
+	}))
+	defer receiver.Close()
+
+	manager, _, plan, owner := setup(t)
+	hook, err := manager.CreateWebhook(plan.Identifier, owner, receiver.URL, nil)
+	require.NoError(t, err)
+	that.NotEmpty(hook.Secret)
+	that.Equal(Events, hook.Events)
+
+	manager.enqueue(events.Event{ID: 1, Type: events.EntryRemoved, Plan: plan.Identifier, At: time.Now(), Data: planman.EntryRemovedEvent{EntryID: 7}})
+	manager.deliverDue()
+
+	req := <-received
+	that.Equal(string(events.EntryRemoved), req.Header.Get(HeaderEvent))
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	that.Equal(Sign(hook.Secret, timestamp, body), req.Header.Get(HeaderSignature))
+	payload := Payload{}
+	require.NoError(t, json.Unmarshal(body, &payload))
+	that.Equal(plan.Identifier, payload.Plan)
+
+	deliveries, err := manager.ListDeliveries(plan.Identifier, owner, hook.ID, 0)
+	require.NoError(t, err)
+	if that.Len(deliveries, 1) {
+		that.Equal(webhooks.StatusDelivered, deliveries[0].Status)
+		that.Equal(http.StatusOK, deliveries[0].ResponseStatus)
+	}
+}
+
+func TestDelivery_RetriesWithBackoff(t *testing.T) {
+	that := assert.New(t)
+	failures := 2
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	manager, db, plan, owner := setup(t)
+	hook, err := manager.CreateWebhook(plan.Identifier, owner, receiver.URL, []events.Type{events.PlanDeleted})
+	require.NoError(t, err)
+
+	// Not subscribed to, so nothing is queued
+	manager.enqueue(events.Event{ID: 1, Type: events.EntryAdded, Plan: plan.Identifier})
+	manager.enqueue(events.Event{ID: 2, Type: events.PlanDeleted, Plan: plan.Identifier})
+	for attempt := 1; attempt <= 3; attempt++ {
+		manager.deliverDue()
+		deliveries, err := manager.ListDeliveries(plan.Identifier, owner, hook.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		that.Equal(uint(attempt), deliveries[0].Attempts)
+		if attempt < 3 {
+			that.Equal(webhooks.StatusPending, deliveries[0].Status)
+			that.Equal(http.StatusServiceUnavailable, deliveries[0].ResponseStatus)
+			that.WithinDuration(time.Now().Add(retryBackoff.Delay(uint(attempt))), *deliveries[0].NextAttemptAt, 5*time.Second)
+			// Nothing is due until the backoff has passed
+			due, err := db.Webhooks().DueDeliveries(time.Now(), deliveryBatch)
+			require.NoError(t, err)
+			that.Empty(due)
+			waiting, err := db.Webhooks().DueDeliveries(time.Now().Add(retryBackoff.Max), deliveryBatch)
+			require.NoError(t, err)
+			for index := range waiting {
+				waiting[index].NextAttemptAt = time.Now().Add(-time.Second)
+				require.NoError(t, db.Webhooks().UpdateDelivery(&waiting[index]))
+			}
+		} else {
+			that.Equal(webhooks.StatusDelivered, deliveries[0].Status)
+		}
+	}
+}
+
+func TestCreateWebhook_Validation(t *testing.T) {
+	that := assert.New(t)
+	manager, db, plan, owner := setup(t)
+	other, err := userman.New(db.Users(), nil).Authenticate("other@example.com", "", "discord", "2", "Other")
+	require.NoError(t, err)
+
+	_, err = manager.CreateWebhook(plan.Identifier, other, "https://example.com/hook", nil)
+	that.Error(err, "only the owner can add webhooks")
+	_, err = manager.CreateWebhook(plan.Identifier, owner, "ftp://example.com/hook", nil)
+	that.Error(err)
+	_, err = manager.CreateWebhook(plan.Identifier, owner, "https://example.com/hook", []events.Type{"made_up"})
+	that.Error(err)
+	for i := 0; i < maxWebhooksPerPlan; i++ {
+		_, err = manager.CreateWebhook(plan.Identifier, owner, "https://example.com/hook", nil)
+		require.NoError(t, err)
+	}
+	_, err = manager.CreateWebhook(plan.Identifier, owner, "https://example.com/hook", nil)
+	that.Error(err, "too many webhooks")
+}
+
+func TestHTTPClient_RefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	_, err := NewHTTPClient(false).Get(receiver.URL)
+	assert.True(t, errors.Is(err, ErrPrivateAddress))
+	resp, err := NewHTTPClient(true).Get(receiver.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+}
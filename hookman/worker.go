@@ -0,0 +1,288 @@
+package hookman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/backoff"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata/webhooks"
+)
+
+const (
+	// maxAttempts is how many times a delivery is tried before it's marked as failed
+	maxAttempts = 8
+	// pollInterval is how often due deliveries are looked for, new events are delivered right away
+	pollInterval = 5 * time.Second
+	// deliveryBatch is how many due deliveries are attempted per poll
+	deliveryBatch = 20
+	// deliveryTimeout is how long a webhook gets to respond
+	deliveryTimeout = 10 * time.Second
+	// keepDeliveries is how long finished deliveries stay in the log
+	keepDeliveries = 30 * 24 * time.Hour
+	// maxErrorLength is how much of an error, or a response body, is kept in the log
+	maxErrorLength = 512
+)
+
+// retryBackoff is the wait between attempts, starting at 10 seconds and doubling up to an hour
+var retryBackoff = backoff.Exponential{First: 10 * time.Second, Max: time.Hour}
+
+// ErrPrivateAddress is returned when a webhook points at a loopback, private or link-local address
+var ErrPrivateAddress = errors.New("webhooks cannot be delivered to private network addresses")
+
+// Manager manages webhooks and delivers events to them
+type Manager struct {
+	data   HookData
+	plans  PlanData
+	client *http.Client
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a new webhook Manager, sending deliveries with the given HTTP client
+func New(data HookData, plans PlanData, client *http.Client) *Manager {
+	return &Manager{
+		data:   data,
+		plans:  plans,
+		client: client,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// NewHTTPClient returns the HTTP client deliveries should be made with. Unless allowPrivate is set,
+// it refuses to connect to private network addresses, so webhooks can't be used to reach services
+// that aren't meant to be public.
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: deliveryTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   deliveryTimeout,
+		Transport: transport,
+		// A redirect could lead anywhere, the webhook URL should be the final one
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// privateNetworks are the address ranges that aren't reachable from the internet
+var privateNetworks = func() []*net.IPNet {
+	ranges := []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"}
+	networks := make([]*net.IPNet, len(ranges))
+	for index, cidr := range ranges {
+		_, networks[index], _ = net.ParseCIDR(cidr)
+	}
+	return networks
+}()
+
+// isPrivate returns whether the address is loopback, link-local, unspecified or in a private range
+func isPrivate(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start starts queueing up deliveries for the events published on the hub, and delivering them
+// in the background
+func (m *Manager) Start(hub *events.Hub) {
+	followed := hub.Follow(m.stop, func(lastID uint64) {
+		logrus.WithField("last_event_id", lastID).Warn("Some plan events were missed, their webhook deliveries are lost")
+	})
+	go m.listen(followed)
+	go func() {
+		defer close(m.done)
+		poll := time.NewTicker(pollInterval)
+		defer poll.Stop()
+		prune := time.NewTicker(time.Hour)
+		defer prune.Stop()
+		for {
+			m.deliverDue()
+			select {
+			case <-m.stop:
+				return
+			case <-poll.C:
+			case <-m.wake:
+			case <-prune.C:
+				if pruned, err := m.data.PruneDeliveries(time.Now().Add(-keepDeliveries)); err != nil {
+					logrus.WithError(err).Error("Failed pruning webhook deliveries")
+				} else if pruned > 0 {
+					logrus.WithField("deliveries", pruned).Info("Pruned old webhook deliveries")
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops delivering, waiting for the delivery in progress to finish or the context to be done.
+// Pending deliveries are picked up again after a restart.
+func (m *Manager) Stop(ctx context.Context) error {
+	close(m.stop)
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries did not stop in time: %w", ctx.Err())
+	}
+}
+
+// listen queues up deliveries for every event followed, until the Manager is stopped
+func (m *Manager) listen(followed <-chan events.Event) {
+	for event := range followed {
+		m.enqueue(event)
+	}
+}
+
+// enqueue creates a delivery of the event for every webhook of its plan that wants it
+func (m *Manager) enqueue(event events.Event) {
+	if !knownEvent(event.Type) {
+		return
+	}
+	log := logrus.WithFields(logrus.Fields{"plan": event.Plan, "event": event.Type})
+	hooks, err := m.data.ListWebhooksByPlanIdentifier(event.Plan)
+	if err != nil {
+		log.WithError(err).Error("Failed getting webhooks for an event")
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(Payload{Event: event.Type, Plan: event.Plan, OccurredAt: event.At, Data: event.Data})
+	if err != nil {
+		log.WithError(err).Error("Failed encoding webhook payload")
+		return
+	}
+	for _, hook := range hooks {
+		if !wants(hook, event.Type) {
+			continue
+		}
+		delivery := webhooks.Delivery{
+			WebhookID:     hook.ID,
+			Event:         string(event.Type),
+			Payload:       string(payload),
+			Status:        webhooks.StatusPending,
+			NextAttemptAt: time.Now(),
+		}
+		if err := m.data.CreateDelivery(&delivery); err != nil {
+			log.WithError(err).WithField("webhook_id", hook.ID).Error("Failed queueing webhook delivery")
+		}
+	}
+	// Deliver right away rather than on the next poll
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue attempts every delivery that's due
+func (m *Manager) deliverDue() {
+	due, err := m.data.DueDeliveries(time.Now(), deliveryBatch)
+	if err != nil {
+		logrus.WithError(err).Error("Failed getting due webhook deliveries")
+		return
+	}
+	for index := range due {
+		select {
+		case <-m.stop:
+			return
+		default:
+		}
+		m.attempt(&due[index])
+	}
+}
+
+// attempt makes a single delivery attempt and records its outcome
+func (m *Manager) attempt(delivery *webhooks.Delivery) {
+	log := logrus.WithFields(logrus.Fields{"delivery_id": delivery.ID, "webhook_id": delivery.WebhookID})
+	delivery.Attempts++
+	status, err := m.send(delivery)
+	delivery.ResponseStatus = status
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = webhooks.StatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = webhooks.StatusFailed
+		delivery.LastError = truncate(err.Error())
+		log.WithError(err).Warn("Webhook delivery failed for good")
+	default:
+		delivery.LastError = truncate(err.Error())
+		delivery.NextAttemptAt = now.Add(retryBackoff.Delay(delivery.Attempts))
+	}
+	if err := m.data.UpdateDelivery(delivery); err != nil {
+		log.WithError(err).Error("Failed saving webhook delivery")
+	}
+}
+
+// send posts the delivery to its webhook, returning the response status, if any. Anything but a
+// 2xx response is an error.
+func (m *Manager) send(delivery *webhooks.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed creating request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "groupplan-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		excerpt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return resp.StatusCode, fmt.Errorf("webhook responded with %d: %s", resp.StatusCode, excerpt)
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
+
+// truncate shortens an error message to fit the delivery log
+func truncate(message string) string {
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
@@ -0,0 +1,166 @@
+// Package admin is responsible for all endpoints on the /admin resource, only usable by admins
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/userauth"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 200
+)
+
+// Handler is the object responsible for the /admin endpoint
+type Handler struct {
+	group   *gin.RouterGroup
+	auther  userauth.Authenticator
+	userMan *userman.Manager
+	planner planman.Planner
+}
+
+// New creates a new instance of the admin handler
+func New(router gin.IRouter, auth userauth.Authenticator, userMan *userman.Manager, planner planman.Planner) *Handler {
+	handl := &Handler{
+		auther:  auth,
+		userMan: userMan,
+		planner: planner,
+	}
+	// Every endpoint in the group requires an admin
+	handl.group = router.Group("admin", handl.RequireAdmin)
+
+	// Add the endpoints
+	handl.group.GET("users", handl.ListUsers)
+	handl.group.POST("users/:userID/disable", handl.DisableUser)
+	handl.group.POST("users/:userID/enable", handl.EnableUser)
+	handl.group.GET("plans", handl.ListPlans)
+	handl.group.DELETE("plans/:identifier", handl.DeletePlan)
+	handl.group.GET("stats", handl.GetStats)
+
+	return handl
+}
+
+// RequireAdmin is the middleware rejecting anyone who isn't a logged in admin
+func (h Handler) RequireAdmin(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	if !h.auther.IsAdmin(user) {
+		apierror.Abort(ctx, dataerror.ErrForbidden("You are not an admin"))
+		return
+	}
+	ctx.Next()
+}
+
+// pagination reads the page and per_page query parameters, applying defaults and limits
+func pagination(ctx *gin.Context) (page, perPage int, err error) {
+	page, perPage = 1, defaultPerPage
+	if raw := ctx.Query("page"); raw != "" {
+		if page, err = strconv.Atoi(raw); err != nil || page < 1 {
+			return 0, 0, dataerror.ErrField("page", "page must be a positive integer")
+		}
+	}
+	if raw := ctx.Query("per_page"); raw != "" {
+		if perPage, err = strconv.Atoi(raw); err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, dataerror.ErrField("per_page", fmt.Sprintf("per_page must be an integer between 1 and %d", maxPerPage))
+		}
+	}
+	return page, perPage, nil
+}
+
+// ListUsers returns a page of all users
+func (h Handler) ListUsers(ctx *gin.Context) {
+	page, perPage, err := pagination(ctx)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	found, total, err := h.userMan.ListUsers(page, perPage)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Page{Items: found, Page: page, PerPage: perPage, Total: total})
+}
+
+// DisableUser disables a user account, after which they can no longer log in or use their session
+func (h Handler) DisableUser(ctx *gin.Context) {
+	h.setDisabled(ctx, true)
+}
+
+// EnableUser re-enables a disabled user account
+func (h Handler) EnableUser(ctx *gin.Context) {
+	h.setDisabled(ctx, false)
+}
+
+// setDisabled is the shared implementation of DisableUser and EnableUser
+func (h Handler) setDisabled(ctx *gin.Context, disabled bool) {
+	userID, err := strconv.ParseUint(ctx.Param("userID"), 10, 32)
+	if err != nil {
+		apierror.Abort(ctx, dataerror.ErrBadRequest("user ID is not an unsigned integer"))
+		return
+	}
+	user, err := h.userMan.SetDisabled(uint(userID), disabled)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+// ListPlans returns a page of all plans, newest first
+func (h Handler) ListPlans(ctx *gin.Context) {
+	page, perPage, err := pagination(ctx)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	found, total, err := h.planner.ListAllPlans(page, perPage)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Page{Items: found, Page: page, PerPage: perPage, Total: total})
+}
+
+// DeletePlan deletes any plan, regardless of who owns it
+func (h Handler) DeletePlan(ctx *gin.Context) {
+	if err := h.planner.ForceDeletePlan(ctx.Param("identifier")); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetStats returns aggregate statistics about users, plans and entries
+func (h Handler) GetStats(ctx *gin.Context) {
+	userStats, err := h.userMan.GetStats()
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	planStats, err := h.planner.GetStats()
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Stats{
+		Users:           userStats.Total,
+		Admins:          userStats.Admins,
+		DisabledUsers:   userStats.Disabled,
+		Plans:           planStats.Plans,
+		Entries:         planStats.Entries,
+		PlansLastWeek:   planStats.PlansLastWeek,
+		EntriesLastWeek: planStats.EntriesLastWeek,
+	})
+}
@@ -0,0 +1,86 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/httpend/admin"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// emailAuth authenticates requests as the user whose email address is in the X-Email header, the
+// way a session would: disabled users are rejected
+type emailAuth struct {
+	accounts *userman.Manager
+}
+
+func (a emailAuth) GetJWT(ctx *gin.Context) (users.User, error) {
+	if ctx.GetHeader("X-Email") == "" {
+		return users.User{}, errors.New("not logged in")
+	}
+	return a.accounts.GetAuthenticatedUser(ctx.GetHeader("X-Email"))
+}
+
+func (a emailAuth) IsAdmin(user users.User) bool {
+	return a.accounts.IsAdmin(user)
+}
+
+func TestAdmin_OnlyAdmins_CannotDisableAdmins(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	accounts := userman.New(db.Users(), []string{"admin@example.com"})
+	adminUser, err := db.Users().GetOrCreateUser("admin@example.com", "", "Admin")
+	require.NoError(t, err)
+	user, err := db.Users().GetOrCreateUser("user@example.com", "", "User")
+	require.NoError(t, err)
+	planner := planman.New(db.Plans(), events.NewHub())
+	created, err := planner.NewPlan("Someone's plan", time.Now(), 2, 60, user, planman.PlanOptions{})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin.New(router.Group("", apierror.Middleware()), emailAuth{accounts: accounts}, accounts, planner)
+	request := func(method, path, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Email", email)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	that.Equal(http.StatusUnauthorized, request(http.MethodGet, "/admin/users", "").Code)
+	that.Equal(http.StatusForbidden, request(http.MethodGet, "/admin/users", user.Email).Code)
+	listed := request(http.MethodGet, "/admin/users?per_page=1", adminUser.Email)
+	if that.Equal(http.StatusOK, listed.Code) {
+		page := admin.Page{}
+		require.NoError(t, json.Unmarshal(listed.Body.Bytes(), &page))
+		that.EqualValues(2, page.Total)
+		that.Equal(1, page.PerPage)
+	}
+	that.Equal(http.StatusUnprocessableEntity, request(http.MethodGet, "/admin/users?per_page=1000", adminUser.Email).Code)
+
+	that.Equal(http.StatusConflict, request(http.MethodPost, fmt.Sprintf("/admin/users/%d/disable", adminUser.ID), adminUser.Email).Code,
+		"admins can't be disabled")
+	that.Equal(http.StatusOK, request(http.MethodPost, fmt.Sprintf("/admin/users/%d/disable", user.ID), adminUser.Email).Code)
+	that.Equal(http.StatusForbidden, request(http.MethodGet, "/admin/users", user.Email).Code, "disabled users are locked out")
+
+	that.Equal(http.StatusNoContent, request(http.MethodDelete, "/admin/plans/"+created.Identifier, adminUser.Email).Code)
+	_, err = planner.GetPlan(created.Identifier)
+	that.Error(err, "admins can delete anyone's plan")
+}
@@ -0,0 +1,20 @@
+package admin
+
+// Page is the JSON response object for paginated lists
+type Page struct {
+	Items   interface{} `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int64       `json:"total"`
+}
+
+// Stats is the JSON response object for aggregate statistics
+type Stats struct {
+	Users           int64 `json:"users"`
+	Admins          int64 `json:"admins"`
+	DisabledUsers   int64 `json:"disabled_users"`
+	Plans           int64 `json:"plans"`
+	Entries         int64 `json:"entries"`
+	PlansLastWeek   int64 `json:"plans_last_week"`
+	EntriesLastWeek int64 `json:"entries_last_week"`
+}
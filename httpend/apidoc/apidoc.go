@@ -0,0 +1,556 @@
+// Package apidoc describes the groupplan HTTP API as an OpenAPI 3 document, served at /openapi.json.
+// Request and response schemas are generated from the Go types the handlers actually use.
+package apidoc
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/hookman"
+	"github.com/wallnutkraken/groupplan/httpend/admin"
+	"github.com/wallnutkraken/groupplan/httpend/health"
+	"github.com/wallnutkraken/groupplan/httpend/plan"
+	"github.com/wallnutkraken/groupplan/httpend/shtypes"
+	"github.com/wallnutkraken/groupplan/httpend/token"
+	"github.com/wallnutkraken/groupplan/httpend/webhook"
+	"github.com/wallnutkraken/groupplan/notifications"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// Document is the root OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info is the OpenAPI info object
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Components holds the reusable schemas and security schemes
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is an OpenAPI security scheme
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation is a single method on a path
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of a request
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a single possible response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the schema of a body in a given media type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// pathParam matches gin path parameters, to turn /plans/:identifier into /plans/{identifier}
+var pathParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// OpenAPIPath converts a gin route pattern to an OpenAPI path
+func OpenAPIPath(ginPath string) string {
+	return pathParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+// builder assembles the document
+type builder struct {
+	doc     Document
+	schemas *schemaRegistry
+	prefix  string
+}
+
+// add adds an operation on the given gin route pattern, creating path parameters for it
+func (b *builder) add(method, ginPath string, op *Operation) {
+	for _, match := range pathParam.FindAllStringSubmatch(ginPath, -1) {
+		op.Parameters = append([]Parameter{{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}}}, op.Parameters...)
+	}
+	path := OpenAPIPath(ginPath)
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = map[string]*Operation{}
+	}
+	b.doc.Paths[path][method] = op
+}
+
+// json returns a JSON response with the schema of the given value
+func (b *builder) json(description string, value interface{}) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: b.schemas.ref(value)}},
+	}
+}
+
+// body returns a required JSON request body with the schema of the given value
+func (b *builder) body(value interface{}) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{"application/json": {Schema: b.schemas.ref(value)}},
+	}
+}
+
+// api adds an API operation twice: under the versioned prefix, with shtypes.ErrorResponse error
+// bodies, and at its original unversioned path, marked as deprecated, with the original
+// shtypes.UserError and shtypes.ServerError bodies. The given error statuses are added to the
+// responses, along with the ones every endpoint can return.
+func (b *builder) api(method, path string, op Operation, errorStatuses map[int]string) {
+	b.v1(method, path, op, errorStatuses)
+	legacy := op
+	legacy.Responses = map[string]Response{}
+	legacy.Deprecated = true
+	for status, response := range op.Responses {
+		legacy.Responses[status] = response
+	}
+	for status, description := range errorResponses(op, errorStatuses) {
+		code := strconv.Itoa(status)
+		if status >= http.StatusInternalServerError {
+			legacy.Responses[code] = b.json(description, shtypes.ServerError{})
+		} else {
+			legacy.Responses[code] = b.json(description, shtypes.UserError{})
+		}
+	}
+	b.add(method, path, &legacy)
+}
+
+// v1 adds an API operation only under the versioned prefix, for endpoints added after the
+// unversioned API was frozen. Errors are described the same way as by api.
+func (b *builder) v1(method, path string, op Operation, errorStatuses map[int]string) {
+	versioned := op
+	versioned.Responses = map[string]Response{}
+	for status, response := range op.Responses {
+		versioned.Responses[status] = response
+	}
+	for status, description := range errorResponses(op, errorStatuses) {
+		versioned.Responses[strconv.Itoa(status)] = b.json(description, shtypes.ErrorResponse{})
+	}
+	b.add(method, b.prefix+path, &versioned)
+}
+
+// errorResponses returns the given error statuses of an operation, along with the ones every
+// endpoint can return
+func errorResponses(op Operation, errorStatuses map[int]string) map[int]string {
+	statuses := map[int]string{http.StatusInternalServerError: "Server error, the reference can be found in the logs"}
+	if op.Security != nil {
+		statuses[http.StatusUnauthorized] = "Not logged in"
+	}
+	for status, description := range errorStatuses {
+		statuses[status] = description
+	}
+	return statuses
+}
+
+// query returns an optional integer query parameter
+func query(name, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: "integer"}}
+}
+
+// Spec builds the OpenAPI document for every groupplan endpoint, with the versioned API under the
+// given prefix
+func Spec(apiPrefix string) Document {
+	b := &builder{
+		doc: Document{
+			OpenAPI: "3.0.3",
+			Info:    Info{Title: "GroupPlan", Version: "1"},
+			Paths:   map[string]map[string]*Operation{},
+		},
+		schemas: &schemaRegistry{components: map[string]*Schema{}},
+		prefix:  apiPrefix,
+	}
+	// Either the session cookie or the same token as a bearer token
+	cookie := []map[string][]string{{"cookieAuth": {}}, {"bearerAuth": {}}}
+	const (
+		invalid   = "Invalid input, the field it's about is named if known"
+		malformed = "The request could not be understood"
+		notFound  = "Not found"
+		forbidden = "Not allowed"
+		conflict  = "Conflicts with existing data"
+	)
+
+	// userauth
+	b.api("get", "/auth/:provider", Operation{
+		Summary:    "Start logging in with an authentication provider",
+		Tags:       []string{"auth"},
+		Parameters: []Parameter{{Name: "return_to", In: "query", Description: "Local path to return to after logging in", Schema: &Schema{Type: "string"}}},
+		Responses:  map[string]Response{"307": {Description: "Redirect to the provider"}},
+	}, nil)
+	b.api("get", "/auth/:provider/callback", Operation{
+		Summary: "Provider callback, completes the login and sets the session cookie",
+		Tags:    []string{"auth"},
+		Responses: map[string]Response{
+			"302": {Description: "Logged in, redirect to the application"},
+			"403": {Description: "The account is disabled"},
+		},
+	}, nil)
+
+	// plans
+	b.api("put", "/plans", Operation{
+		Summary:     "Create a plan",
+		Tags:        []string{"plans"},
+		Security:    cookie,
+		RequestBody: b.body(plan.CreatePlanRequest{}),
+		Responses:   map[string]Response{"201": b.json("The created plan", planman.GroupPlan{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusUnprocessableEntity: invalid})
+	b.api("get", "/plans", Operation{
+		Summary:   "List the plans owned by the logged in user",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("Owned plans", []planman.GroupPlan{})},
+	}, nil)
+	b.api("get", "/plans/:identifier", Operation{
+		Summary:   "Get a plan with all its entries",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("The plan", planman.GroupPlan{})},
+	}, map[int]string{http.StatusNotFound: notFound})
+	b.api("put", "/plans/:identifier", Operation{
+		Summary:     "Add an availability entry to a plan",
+		Tags:        []string{"entries"},
+		Security:    cookie,
+		RequestBody: b.body(plan.AddEntryRequest{}),
+		Responses:   map[string]Response{"201": b.json("The created entry", planman.PlanEntry{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusNotFound: notFound, http.StatusConflict: "Overlaps another entry of the user, or the response deadline of the plan has passed", http.StatusUnprocessableEntity: invalid})
+	b.api("delete", "/plans/:identifier", Operation{
+		Summary:   "Delete a plan owned by the logged in user",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Deleted"}},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusNotFound: notFound})
+	b.api("get", "/plans/:identifier/entries", Operation{
+		Summary:   "List the logged in user's entries on a plan",
+		Tags:      []string{"entries"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("The user's entries", []planman.PlanEntry{})},
+	}, nil)
+	b.api("delete", "/plans/:identifier/entries/:entryID", Operation{
+		Summary:   "Delete one of the logged in user's entries",
+		Tags:      []string{"entries"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Deleted"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusConflict: "The response deadline of the plan has passed"})
+	b.api("get", "/plans/:identifier/slots", Operation{
+		Summary: "Best times on a plan, where the most users are available at once",
+		Description: "Only times when at least the plan's quorum, and every one of its required members, are available " +
+			"are included.",
+		Tags:       []string{"plans"},
+		Security:   cookie,
+		Parameters: []Parameter{query("limit", "Number of slots to return, up to 50, defaults to 5")},
+		Responses:  map[string]Response{"200": b.json("Slots, best first", []planman.Slot{})},
+	}, map[int]string{http.StatusNotFound: notFound, http.StatusUnprocessableEntity: invalid})
+	b.v1("put", "/plans/:identifier/join", Operation{
+		Summary: "Join a plan as the logged in user",
+		Description: "Members are the people expected to add their availability, who are reminded before the response " +
+			"deadline and whom the owner can make required. Adding availability makes someone a member too.",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("The plan", planman.GroupPlan{})},
+	}, map[int]string{http.StatusNotFound: notFound})
+	b.v1("put", "/plans/:identifier/final", Operation{
+		Summary:     "Settle a plan owned by the logged in user on a time, it can be moved by finalizing again",
+		Tags:        []string{"plans"},
+		Security:    cookie,
+		RequestBody: b.body(plan.FinalizePlanRequest{}),
+		Responses:   map[string]Response{"200": b.json("The final time", planman.FinalTime{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: invalid})
+	b.v1("put", "/plans/:identifier/discord", Operation{
+		Summary: "Post announcements about a plan owned by the logged in user to a Discord webhook",
+		Description: "Announcements are posted when the plan is created, when it reaches its quorum and when it's " +
+			"finalized, each with the best times so far.",
+		Tags:        []string{"plans"},
+		Security:    cookie,
+		RequestBody: b.body(plan.DiscordWebhookRequest{}),
+		Responses:   map[string]Response{"204": {Description: "Set"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: invalid})
+	b.v1("delete", "/plans/:identifier/discord", Operation{
+		Summary:   "Stop posting announcements about a plan owned by the logged in user to Discord",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Removed"}},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusNotFound: notFound})
+	b.v1("put", "/plans/:identifier/deadline", Operation{
+		Summary: "Set when participants of a plan owned by the logged in user should have added their availability by",
+		Description: "Every member of the plan who hasn't added their availability is reminded before the deadline. " +
+			"Once it passes the plan is closed, and availability can't be added or deleted anymore. With auto_finalize, " +
+			"the plan is then finalized on its best slot. Moving the deadline of a closed plan opens it up again. " +
+			"Once the plan is finalized, everyone taking part is reminded before it starts.",
+		Tags:        []string{"plans"},
+		Security:    cookie,
+		RequestBody: b.body(plan.ResponseDeadlineRequest{}),
+		Responses:   map[string]Response{"204": {Description: "Set"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: invalid})
+	b.v1("delete", "/plans/:identifier/deadline", Operation{
+		Summary:   "Remove the response deadline of a plan owned by the logged in user",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Removed"}},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusNotFound: notFound})
+	b.v1("put", "/plans/:identifier/requirements", Operation{
+		Summary: "Set how many people a plan owned by the logged in user needs, and which of its members are required",
+		Description: "Only times when at least quorum people, and every required member, are available at once count as " +
+			"the plan's best slots, the plan's qualifying_slot tells whether there is one yet. Members are everyone who " +
+			"joined the plan or added their availability to it, listed in it with their member_id. Members left out of required_member_ids stop being required.",
+		Tags:        []string{"plans"},
+		Security:    cookie,
+		RequestBody: b.body(plan.RequirementsRequest{}),
+		Responses:   map[string]Response{"204": {Description: "Set"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: invalid})
+	b.v1("get", "/plans/:identifier/events", Operation{
+		Summary: "Stream changes to a plan as Server-Sent Events",
+		Description: "Events are entry_added (PlanEntry), entry_removed (EntryRemovedEvent), quorum_reached (QuorumReachedEvent), " +
+			"plan_updated (GroupPlan), plan_finalized (FinalTime), plan_closed (PlanClosedEvent), plan_deleted (PlanDeletedEvent) and presence_changed (the users watching). " +
+			"Event IDs are opaque, and not reused after the server restarts. Reconnecting with Last-Event-ID " +
+			"replays the missed events, or sends a resync event when the plan should be reloaded instead.",
+		Tags:       []string{"plans"},
+		Security:   cookie,
+		Parameters: []Parameter{{Name: "Last-Event-ID", In: "header", Description: "ID of the last event received, to resume from", Schema: &Schema{Type: "string"}}},
+		Responses:  map[string]Response{"200": {Description: "The event stream", Content: map[string]MediaType{"text/event-stream": {Schema: &Schema{Type: "string"}}}}},
+	}, map[int]string{http.StatusNotFound: notFound})
+	b.v1("get", "/plans/:identifier/socket", Operation{
+		Summary: "Edit a plan together over a WebSocket",
+		Description: "Clients send SocketCommand messages: add_entry and delete_entry. The server sends SocketMessage messages: " +
+			"a snapshot of the plan and who's watching first, then an event for every change (the same events as the event stream, " +
+			"plus presence_changed), a result for every command, and a ping now and then.",
+		Tags:      []string{"plans"},
+		Security:  cookie,
+		Responses: map[string]Response{"101": {Description: "Switching to the WebSocket protocol"}},
+	}, map[int]string{http.StatusForbidden: "The Origin is another site", http.StatusNotFound: notFound})
+	b.schemas.ref(plan.SocketCommand{})
+	b.schemas.ref(plan.SocketMessage{})
+	b.schemas.ref(planman.EntryRemovedEvent{})
+	b.schemas.ref(planman.QuorumReachedEvent{})
+	b.schemas.ref(planman.PlanClosedEvent{})
+	b.schemas.ref(planman.PlanDeletedEvent{})
+
+	// webhooks
+	b.v1("get", "/plans/:identifier/webhooks", Operation{
+		Summary:   "List the webhooks of a plan owned by the logged in user",
+		Tags:      []string{"webhooks"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("Webhooks, without their secrets", []hookman.Webhook{})},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusNotFound: notFound})
+	b.v1("put", "/plans/:identifier/webhooks", Operation{
+		Summary: "Register a webhook on a plan owned by the logged in user",
+		Description: "Events are POSTed to the URL as a Payload, with the X-Groupplan-Event, X-Groupplan-Delivery, " +
+			"X-Groupplan-Timestamp and X-Groupplan-Signature headers. The signature is sha256= followed by the hex " +
+			"HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret. Anything but a 2xx response is " +
+			"retried with exponential backoff.",
+		Tags:        []string{"webhooks"},
+		Security:    cookie,
+		RequestBody: b.body(webhook.CreateWebhookRequest{}),
+		Responses:   map[string]Response{"201": b.json("The created webhook, the secret is only shown here", hookman.Webhook{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusConflict: conflict, http.StatusUnprocessableEntity: invalid})
+	b.schemas.ref(hookman.Payload{})
+	b.v1("delete", "/plans/:identifier/webhooks/:webhookID", Operation{
+		Summary:   "Delete a webhook, along with its pending deliveries",
+		Tags:      []string{"webhooks"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Deleted"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound})
+	b.v1("get", "/plans/:identifier/webhooks/:webhookID/deliveries", Operation{
+		Summary:    "The latest deliveries to a webhook, newest first",
+		Tags:       []string{"webhooks"},
+		Security:   cookie,
+		Parameters: []Parameter{query("limit", "Number of deliveries to return, up to 100, defaults to 20")},
+		Responses:  map[string]Response{"200": b.json("Deliveries", []hookman.Delivery{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: invalid})
+
+	// discord
+	b.v1("post", "/discord/interactions", Operation{
+		Summary: "Discord slash-command interactions, for the /groupplan command",
+		Description: "Only meant for Discord. Requests must be signed with the Discord application's key, in the " +
+			"X-Signature-Ed25519 and X-Signature-Timestamp headers. Commands act as the user who logged in with the " +
+			"same Discord account.",
+		Tags:        []string{"discord"},
+		RequestBody: b.body(discordbot.Interaction{}),
+		Responses:   map[string]Response{"200": b.json("The answer to the interaction", discordbot.InteractionResponse{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusUnauthorized: "The signature is missing or invalid", http.StatusNotFound: "Interactions are not set up"})
+
+	// notifications
+	b.v1("get", "/me/notifications", Operation{
+		Summary:   "Get the logged in user's notification preferences",
+		Tags:      []string{"notifications"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("How the user hears about each kind of notification", notifications.Settings{})},
+	}, nil)
+	b.v1("put", "/me/notifications", Operation{
+		Summary: "Change the logged in user's notification preferences",
+		Description: "Kinds of notification are plan_finalized, plan_updated, new_participant and reminder, each sent by email, " +
+			"discord or none, right away or in a daily digest. Discord notifications are posted to discord_webhook_url, " +
+			"as webhooks can't send direct messages, an empty one removes it. Kinds of notification left out, and the webhook " +
+			"if it's left out, are unchanged.",
+		Tags:        []string{"notifications"},
+		Security:    cookie,
+		RequestBody: b.body(notifications.SettingsChange{}),
+		Responses:   map[string]Response{"200": b.json("The preferences as they are now", notifications.Settings{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusUnprocessableEntity: invalid})
+	unsubscribeParams := []Parameter{
+		{Name: "user", In: "query", Required: true, Description: "ID of the user the link was made for", Schema: &Schema{Type: "integer"}},
+		{Name: "event", In: "query", Required: true, Description: "Kind of notification to turn off, or all of them with all", Schema: &Schema{Type: "string"}},
+		{Name: "signature", In: "query", Required: true, Description: "Signature of the link", Schema: &Schema{Type: "string"}},
+	}
+	b.v1("get", "/notifications/unsubscribe", Operation{
+		Summary:    "Open the unsubscribe link sent in emails, which asks to confirm before unsubscribing",
+		Tags:       []string{"notifications"},
+		Parameters: unsubscribeParams,
+		Responses:  map[string]Response{"200": {Description: "A page confirming with a POST to the same link"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: "The link is not valid", http.StatusNotFound: notFound})
+	b.v1("post", "/notifications/unsubscribe", Operation{
+		Summary:    "Unsubscribe from a kind of notification, confirmed on the unsubscribe page or in one click from a mail client (RFC 8058)",
+		Tags:       []string{"notifications"},
+		Parameters: unsubscribeParams,
+		Responses: map[string]Response{
+			"200": {Description: "Unsubscribed from the unsubscribe page, with a page saying so"},
+			"204": {Description: "Unsubscribed"},
+		},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: "The link is not valid", http.StatusNotFound: notFound})
+
+	// tokens
+	b.api("get", "/tokens", Operation{
+		Summary:   "List the logged in user's API tokens",
+		Tags:      []string{"tokens"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("API tokens, without the tokens themselves", []userman.APIToken{})},
+	}, nil)
+	b.api("put", "/tokens", Operation{
+		Summary:     "Create an API token, which is only shown in this response",
+		Tags:        []string{"tokens"},
+		Security:    cookie,
+		RequestBody: b.body(token.CreateTokenRequest{}),
+		Responses:   map[string]Response{"201": b.json("The created token", token.CreateTokenResponse{})},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusUnprocessableEntity: invalid})
+	b.api("delete", "/tokens/:tokenID", Operation{
+		Summary:   "Revoke one of the logged in user's API tokens",
+		Tags:      []string{"tokens"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Revoked"}},
+	}, map[int]string{http.StatusBadRequest: malformed, http.StatusNotFound: notFound})
+
+	// admin
+	pageParams := []Parameter{query("page", "1-based page number"), query("per_page", "Items per page, up to 200")}
+	b.api("get", "/admin/users", Operation{
+		Summary:    "List all users",
+		Tags:       []string{"admin"},
+		Security:   cookie,
+		Parameters: pageParams,
+		Responses:  map[string]Response{"200": b.json("A page of users, items are AdminUser", admin.Page{})},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusUnprocessableEntity: invalid})
+	b.schemas.ref(userman.AdminUser{})
+	b.schemas.ref(planman.AdminPlan{})
+	for _, action := range []string{"disable", "enable"} {
+		b.api("post", "/admin/users/:userID/"+action, Operation{
+			Summary:   "Set whether a user is disabled (" + action + ")",
+			Tags:      []string{"admin"},
+			Security:  cookie,
+			Responses: map[string]Response{"200": b.json("The updated user", userman.AdminUser{})},
+		}, map[int]string{http.StatusBadRequest: malformed, http.StatusForbidden: forbidden, http.StatusNotFound: notFound, http.StatusConflict: conflict})
+	}
+	b.api("get", "/admin/plans", Operation{
+		Summary:    "List all plans, newest first",
+		Tags:       []string{"admin"},
+		Security:   cookie,
+		Parameters: pageParams,
+		Responses:  map[string]Response{"200": b.json("A page of plans, items are AdminPlan", admin.Page{})},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusUnprocessableEntity: invalid})
+	b.api("delete", "/admin/plans/:identifier", Operation{
+		Summary:   "Delete any plan",
+		Tags:      []string{"admin"},
+		Security:  cookie,
+		Responses: map[string]Response{"204": {Description: "Deleted"}},
+	}, map[int]string{http.StatusForbidden: forbidden, http.StatusNotFound: notFound})
+	b.api("get", "/admin/stats", Operation{
+		Summary:   "Aggregate statistics",
+		Tags:      []string{"admin"},
+		Security:  cookie,
+		Responses: map[string]Response{"200": b.json("Statistics", admin.Stats{})},
+	}, map[int]string{http.StatusForbidden: forbidden})
+
+	// operations
+	b.add("get", "/healthz", &Operation{
+		Summary:   "Liveness check",
+		Tags:      []string{"operations"},
+		Responses: map[string]Response{"200": b.json("Alive", health.Report{})},
+	})
+	b.add("get", "/readyz", &Operation{
+		Summary: "Readiness check, covering the database, schema and frontend",
+		Tags:    []string{"operations"},
+		Responses: map[string]Response{
+			"200": b.json("Ready", health.Report{}),
+			"503": b.json("Not ready, see the failing checks", health.Report{}),
+		},
+	})
+	b.add("get", "/ping", &Operation{
+		Summary:   "Responds with pong",
+		Tags:      []string{"operations"},
+		Responses: map[string]Response{"200": {Description: "pong", Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}}},
+	})
+	b.add("get", "/metrics", &Operation{
+		Summary:   "Prometheus metrics",
+		Tags:      []string{"operations"},
+		Security:  []map[string][]string{{"metricsToken": {}}},
+		Responses: map[string]Response{"200": {Description: "Metrics in the Prometheus text format", Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}}},
+	})
+	b.add("get", "/openapi.json", &Operation{
+		Summary:   "This document",
+		Tags:      []string{"operations"},
+		Responses: map[string]Response{"200": {Description: "The OpenAPI document", Content: map[string]MediaType{"application/json": {Schema: &Schema{Type: "object"}}}}},
+	})
+
+	b.doc.Components = Components{
+		Schemas: b.schemas.components,
+		SecuritySchemes: map[string]*SecurityScheme{
+			"cookieAuth":   {Type: "apiKey", In: "cookie", Name: "groupplan_jwt", Description: "Session cookie set after logging in"},
+			"bearerAuth":   {Type: "http", Scheme: "bearer", Description: "An API token, or the session token"},
+			"metricsToken": {Type: "http", Scheme: "bearer", Description: "Only required if a metrics token is configured"},
+		},
+	}
+	return b.doc
+}
+
+// Register serves the document at /openapi.json
+func Register(router *gin.Engine, apiPrefix string) {
+	spec := Spec(apiPrefix)
+	router.GET("/openapi.json", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, spec)
+	})
+}
@@ -0,0 +1,108 @@
+// Package apierror turns the errors handlers attach to a request into consistent JSON responses, so
+// every handler reports errors the same way
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/httpend/shtypes"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// CodeInternal is the error code of server errors
+const CodeInternal = "internal"
+
+// serverErrorMessage is the message of every server error, the details are only logged
+const serverErrorMessage = "Something went wrong on our end"
+
+// Abort stops handling the request and responds with the given error. Errors from the dataerror
+// package are shown to the user, anything else is logged and answered with a server error.
+func Abort(ctx *gin.Context, err error) {
+	ctx.Error(err)
+	ctx.Abort()
+}
+
+// Unauthenticated converts an authentication failure into the error to respond with
+func Unauthenticated(err error) error {
+	if errors.Is(err, userman.ErrDisabled) {
+		return dataerror.ErrForbidden(userman.ErrDisabled.Error())
+	}
+	return dataerror.ErrUnauthorized("Please log in")
+}
+
+// Bind converts an error from binding a JSON request body into the error to respond with
+func Bind(err error) error {
+	typeErr := &json.UnmarshalTypeError{}
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return dataerror.ErrField(typeErr.Field, fmt.Sprintf("must be of type %s", typeErr.Type))
+	}
+	return dataerror.ErrBadRequest(fmt.Sprintf("invalid JSON body: %s", err.Error()))
+}
+
+// Detail converts an error into what's shown to the user, along with its status code, for errors
+// that don't go through the middleware, such as ones sent over a WebSocket. Server errors are logged.
+func Detail(ctx *gin.Context, err error) (int, shtypes.ErrorDetail) {
+	if userError, ok := dataerror.As(err); ok {
+		return userError.StatusCode(), shtypes.ErrorDetail{
+			Code:    userError.Code,
+			Message: userError.Message,
+			Field:   userError.Field,
+		}
+	}
+	reqlog.Logger(ctx).WithError(err).Error("Request failed")
+	return http.StatusInternalServerError, shtypes.ErrorDetail{
+		Code:      CodeInternal,
+		Message:   serverErrorMessage,
+		Reference: shtypes.NewServerError(ctx).Reference,
+	}
+}
+
+// Middleware responds with the error attached by Abort, wrapped in a shtypes.ErrorResponse
+func Middleware() gin.HandlerFunc {
+	return translate(func(ctx *gin.Context, userError dataerror.BaseError) {
+		ctx.JSON(userError.StatusCode(), shtypes.ErrorResponse{Error: shtypes.ErrorDetail{
+			Code:    userError.Code,
+			Message: userError.Message,
+			Field:   userError.Field,
+		}})
+	}, func(ctx *gin.Context, ref shtypes.ServerError) {
+		ctx.JSON(http.StatusInternalServerError, shtypes.ErrorResponse{Error: shtypes.ErrorDetail{
+			Code:      CodeInternal,
+			Message:   serverErrorMessage,
+			Reference: ref.Reference,
+		}})
+	})
+}
+
+// LegacyMiddleware is Middleware for the unversioned routes, responding with the original
+// shtypes.UserError and shtypes.ServerError bodies, but the same status codes
+func LegacyMiddleware() gin.HandlerFunc {
+	return translate(func(ctx *gin.Context, userError dataerror.BaseError) {
+		ctx.JSON(userError.StatusCode(), shtypes.NewUserError(userError.Message))
+	}, func(ctx *gin.Context, ref shtypes.ServerError) {
+		ctx.JSON(http.StatusInternalServerError, ref)
+	})
+}
+
+// translate creates the middleware rendering the last error of a request, if the handler didn't respond itself
+func translate(user func(ctx *gin.Context, userError dataerror.BaseError), server func(ctx *gin.Context, ref shtypes.ServerError)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+		err := ctx.Errors.Last().Err
+		if userError, ok := dataerror.As(err); ok {
+			user(ctx, userError)
+			return
+		}
+		reqlog.Logger(ctx).WithError(err).Error("Request failed")
+		server(ctx, shtypes.NewServerError(ctx))
+	}
+}
@@ -0,0 +1,60 @@
+package apierror_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/shtypes"
+)
+
+func respond(middleware gin.HandlerFunc, err error) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", middleware, func(ctx *gin.Context) {
+		apierror.Abort(ctx, err)
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec
+}
+
+func TestMiddleware_Envelope(t *testing.T) {
+	that := assert.New(t)
+
+	rec := respond(apierror.Middleware(), fmt.Errorf("wrapped: %w", dataerror.ErrField("title", "Title cannot be empty")))
+	that.Equal(http.StatusUnprocessableEntity, rec.Code)
+	body := shtypes.ErrorResponse{}
+	that.NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+	that.Equal(dataerror.CodeValidation, body.Error.Code)
+	that.Equal("title", body.Error.Field)
+	that.Equal("Title cannot be empty", body.Error.Message)
+
+	rec = respond(apierror.Middleware(), dataerror.ErrNotFound("no such plan exists"))
+	that.Equal(http.StatusNotFound, rec.Code)
+
+	rec = respond(apierror.Middleware(), errors.New("database on fire"))
+	that.Equal(http.StatusInternalServerError, rec.Code)
+	body = shtypes.ErrorResponse{}
+	that.NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+	that.Equal(apierror.CodeInternal, body.Error.Code)
+	that.NotEmpty(body.Error.Reference)
+	that.NotContains(rec.Body.String(), "database on fire")
+}
+
+func TestLegacyMiddleware_OriginalBody(t *testing.T) {
+	that := assert.New(t)
+
+	rec := respond(apierror.LegacyMiddleware(), dataerror.ErrConflict("availability conflicts"))
+	that.Equal(http.StatusConflict, rec.Code)
+	body := shtypes.UserError{}
+	that.NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+	that.Equal("availability conflicts", body.Error)
+}
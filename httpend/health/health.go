@@ -0,0 +1,83 @@
+// Package health is responsible for the liveness (/healthz) and readiness (/readyz) endpoints
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkTimeout is how long all readiness checks together may take
+const checkTimeout = 5 * time.Second
+
+// Check is a single readiness check, returning nil if the dependency it checks is usable
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Handler is the object responsible for the health endpoints
+type Handler struct {
+	checks   []Check
+	draining int32
+}
+
+// New creates a new instance of the health handler, which reports ready only while every one
+// of the given checks passes
+func New(router *gin.Engine, checks ...Check) *Handler {
+	handl := &Handler{
+		checks: checks,
+	}
+	router.GET("healthz", handl.Live)
+	router.GET("readyz", handl.Ready)
+	return handl
+}
+
+// Drain makes the readiness endpoint fail from now on, so traffic is routed elsewhere while
+// the application shuts down
+func (h *Handler) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Live is the liveness endpoint, it succeeds as long as the process can serve HTTP at all
+func (h *Handler) Live(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready is the readiness endpoint, running every check and reporting on each of them
+func (h *Handler) Ready(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), checkTimeout)
+	defer cancel()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: map[string]CheckResult{},
+	}
+	if atomic.LoadInt32(&h.draining) == 1 {
+		report.Status = StatusFail
+		report.Checks["shutdown"] = CheckResult{Status: StatusFail, Error: "shutting down"}
+	}
+	for _, check := range h.checks {
+		started := time.Now()
+		err := check.Check(checkCtx)
+		result := CheckResult{
+			Status:    StatusOK,
+			LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Status = StatusFail
+			result.Error = err.Error()
+			report.Status = StatusFail
+		}
+		report.Checks[check.Name] = result
+	}
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,58 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/httpend/health"
+)
+
+// get performs a GET request against the router, returning the status and decoded report
+func get(t *testing.T, router *gin.Engine, path string) (int, health.Report) {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	report := health.Report{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	return recorder.Code, report
+}
+
+func TestReady_FailingCheck_Unavailable(t *testing.T) {
+	that := assert.New(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	health.New(router,
+		health.Check{Name: "good", Check: func(ctx context.Context) error { return nil }},
+		health.Check{Name: "database", Check: func(ctx context.Context) error { return errors.New("database is gone") }},
+	)
+
+	status, report := get(t, router, "/readyz")
+	that.Equal(http.StatusServiceUnavailable, status)
+	that.Equal(health.StatusFail, report.Status)
+	that.Equal(health.StatusOK, report.Checks["good"].Status)
+	that.Equal("database is gone", report.Checks["database"].Error)
+
+	// Liveness doesn't care about dependencies
+	status, _ = get(t, router, "/healthz")
+	that.Equal(http.StatusOK, status)
+}
+
+func TestReady_Draining_Unavailable(t *testing.T) {
+	that := assert.New(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := health.New(router)
+
+	status, _ := get(t, router, "/readyz")
+	that.Equal(http.StatusOK, status)
+
+	handler.Drain()
+	status, report := get(t, router, "/readyz")
+	that.Equal(http.StatusServiceUnavailable, status)
+	that.Equal(health.StatusFail, report.Checks["shutdown"].Status)
+}
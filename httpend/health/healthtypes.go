@@ -0,0 +1,20 @@
+package health
+
+// Check and report statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Report is the JSON response object of the health endpoints
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of a single readiness check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
@@ -2,95 +2,252 @@
 package httpend
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"net/http"
+	"time"
 
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/frontend"
 	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/hookman"
+	"github.com/wallnutkraken/groupplan/httpend/admin"
+	"github.com/wallnutkraken/groupplan/httpend/apidoc"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/health"
+	"github.com/wallnutkraken/groupplan/httpend/interactions"
+	"github.com/wallnutkraken/groupplan/httpend/notification"
 	"github.com/wallnutkraken/groupplan/httpend/plan"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/httpend/token"
+	"github.com/wallnutkraken/groupplan/httpend/webhook"
+	"github.com/wallnutkraken/groupplan/metrics"
+	"github.com/wallnutkraken/groupplan/notifications"
 	"github.com/wallnutkraken/groupplan/planman"
 
 	"golang.org/x/crypto/acme/autocert"
 
-	"github.com/gin-gonic/autotls"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"github.com/wallnutkraken/groupplan/config"
 	"github.com/wallnutkraken/groupplan/httpend/userauth"
 	"github.com/wallnutkraken/groupplan/userman"
 )
 
+// APIPrefix is where the versioned API is served
+const APIPrefix = "/api/v1"
+
 // Endpoint is the object used to start and handle the HTTP endpoint
 type Endpoint struct {
-	hostname    string
-	router      *gin.Engine
-	authHandler *userauth.Handler
-	planHanlder *plan.Handler
+	hostname       string
+	router         *gin.Engine
+	authHandler    *userauth.Handler
+	planHanlder    *plan.Handler
+	adminHandler   *admin.Handler
+	tokenHandler   *token.Handler
+	webhookHandler *webhook.Handler
+	notifications  *notification.Handler
+	interactions   *interactions.Handler
+	health         *health.Handler
+	// events carries changes to plans to the live update streams
+	events *events.Hub
+
+	// tlsServer serves the application itself, challengeServer answers ACME challenges
+	// and redirects plain HTTP traffic to HTTPS. Both are created up front, so Shutdown
+	// can stop them even before Start got to listening.
+	tlsServer       *http.Server
+	challengeServer *http.Server
+
+	// drain is how long to keep serving after reporting as not ready on shutdown
+	drain time.Duration
 
+	// files contains the frontend, liveFrontend is set when it's read from disk during development.
+	// The HTML pages are loaded once in New and never written to after, requests to a live
+	// frontend read their own copy.
+	files         fs.FS
+	liveFrontend  bool
 	loginHTML     []byte
 	dashboardHTML []byte
 }
 
-// loadHTML loads the login and dashboard HTML files into memory
-func (e *Endpoint) loadHTML() error {
-	login, err := ioutil.ReadFile("frontend/login.html")
+// readHTML reads the login and dashboard HTML files
+func (e *Endpoint) readHTML() (login, dashboard []byte, err error) {
+	login, err = fs.ReadFile(e.files, "login.html")
 	if err != nil {
-		return fmt.Errorf("failed reading the login file: %w", err)
+		return nil, nil, fmt.Errorf("failed reading the login file: %w", err)
 	}
-	dashboard, err := ioutil.ReadFile("frontend/dashboard.html")
+	dashboard, err = fs.ReadFile(e.files, "dashboard.html")
 	if err != nil {
-		return fmt.Errorf("failed reading the dashboard file: %w", err)
+		return nil, nil, fmt.Errorf("failed reading the dashboard file: %w", err)
 	}
-
-	// Put the file info into the endpoint struct and return nil
-	e.loginHTML = login
-	e.dashboardHTML = dashboard
-	return nil
+	return login, dashboard, nil
 }
 
-// New creates a new instance of the HTTP endpoint with the given port
-func New(cfg config.AppSettings, db groupdata.Data) Endpoint {
-	e := Endpoint{
-		router:   gin.Default(),
-		hostname: cfg.Hostname,
+// New creates a new instance of the HTTP endpoint. Changes to plans are published on the given hub,
+// plan webhooks are managed through the given manager and notification preferences through the
+// given preferences.
+func New(cfg config.AppSettings, db groupdata.Data, hub *events.Hub, hooks *hookman.Manager, preferences *notifications.Preferences) (*Endpoint, error) {
+	e := &Endpoint{
+		router:       gin.New(),
+		hostname:     cfg.Hostname,
+		files:        frontend.FS(cfg.FrontendDir),
+		liveFrontend: cfg.FrontendDir != "",
+		events:       hub,
+		drain:        cfg.Drain(),
 	}
+	// Structured, request-scoped logging replaces gin's own logger
+	e.router.Use(reqlog.Middleware(), metrics.Middleware(), gin.Recovery())
+
 	// Initialize the sub-handlers
-	e.authHandler = userauth.New(e.router, userman.New(db.Users()), cfg)
-	e.planHanlder = plan.New(e.router, e.authHandler, planman.New(db.Plans()))
+	userMan := userman.New(db.Users(), cfg.AdminEmails)
+	planner := planman.New(db.Plans(), e.events)
+	var discordKey ed25519.PublicKey
+	if cfg.DiscordPublicKey != "" {
+		key, err := discordbot.ParsePublicKey(cfg.DiscordPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		discordKey = key
+	}
+	bot := discordbot.NewBot(planner, userMan, cfg.URL("/"))
+	// The API lives under /api/v1, where every error comes in the same envelope. The original
+	// unversioned routes stay for existing clients, with their original error bodies, but nothing
+	// added since is served there.
+	v1 := e.router.Group(APIPrefix, apierror.Middleware())
+	legacy := e.router.Group("", apierror.LegacyMiddleware())
+	e.authHandler = userauth.New(legacy, userMan, cfg)
+	e.authHandler.Register(v1)
+	e.planHanlder = plan.New(v1, e.authHandler, planner, e.events)
+	e.adminHandler = admin.New(v1, e.authHandler, userMan, planner)
+	e.tokenHandler = token.New(v1, e.authHandler, userMan)
+	e.webhookHandler = webhook.New(v1, e.authHandler, hooks)
+	e.notifications = notification.New(v1, e.authHandler, preferences)
+	e.interactions = interactions.New(v1, bot, discordKey)
+	e.planHanlder.RegisterLegacy(legacy)
+	admin.New(legacy, e.authHandler, userMan, planner)
+	token.New(legacy, e.authHandler, userMan)
 
 	// Load the dashboard and login HTML files, as we'll be serving them from memory
-	e.loadHTML()
+	login, dashboard, err := e.readHTML()
+	if err != nil {
+		return nil, err
+	}
+	e.loginHTML = login
+	e.dashboardHTML = dashboard
 
-	e.router.StaticFS("static", http.Dir("frontend/static"))
+	static, err := fs.Sub(e.files, "static")
+	if err != nil {
+		return nil, fmt.Errorf("failed opening the static files directory: %w", err)
+	}
+	e.router.StaticFS("static", http.FS(static))
 	// And HTML endpoint methods
 	e.router.GET("/", e.Index)
 
+	// Prometheus metrics
+	e.router.GET("/metrics", metrics.Handler(cfg.MetricsToken))
+
+	// Health checks, for the orchestrator to know whether to route traffic to us
+	e.health = health.New(e.router,
+		health.Check{Name: "database", Check: db.Ping},
+		health.Check{Name: "migrations", Check: func(ctx context.Context) error {
+			return db.CheckSchema()
+		}},
+		health.Check{Name: "frontend", Check: e.checkFrontend},
+	)
+
+	// Machine-readable description of the API
+	apidoc.Register(e.router, APIPrefix)
+
 	// Ping handler
 	e.router.GET("/ping", func(c *gin.Context) {
 		c.String(http.StatusOK, "pong")
 	})
 
-	return e
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(e.hostname, fmt.Sprintf("www.%s", e.hostname)),
+	}
+	e.tlsServer = &http.Server{
+		Addr:      ":https",
+		TLSConfig: manager.TLSConfig(),
+		Handler:   e.router,
+	}
+	e.challengeServer = &http.Server{
+		Addr:    ":http",
+		Handler: manager.HTTPHandler(nil),
+	}
+
+	return e, nil
+}
+
+// checkFrontend makes sure the HTML pages and static assets are available
+func (e *Endpoint) checkFrontend(ctx context.Context) error {
+	if len(e.loginHTML) == 0 || len(e.dashboardHTML) == 0 {
+		return errors.New("HTML pages are not loaded")
+	}
+	if _, err := fs.Stat(e.files, "static/groupplan_basic.css"); err != nil {
+		return fmt.Errorf("static assets are missing: %w", err)
+	}
+	return nil
 }
 
 // Index returns the HTML index document
-func (e Endpoint) Index(ctx *gin.Context) {
+func (e *Endpoint) Index(ctx *gin.Context) {
+	login, dashboard := e.loginHTML, e.dashboardHTML
+	if e.liveFrontend {
+		// Pick up any changes made to the HTML files since the last request
+		var err error
+		if login, dashboard, err = e.readHTML(); err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
 	_, err := e.authHandler.GetJWT(ctx)
 	if err != nil {
 		// User not authed, send them to login
-		fmt.Println("returning login")
-		ctx.Data(http.StatusOK, "text/html", e.loginHTML)
+		ctx.Data(http.StatusOK, "text/html", login)
 		return
 	}
 	// User authed, give them the dashboard
-	fmt.Println("Returning dashboard")
-	ctx.Data(http.StatusOK, "text/html", e.dashboardHTML)
+	ctx.Data(http.StatusOK, "text/html", dashboard)
 }
 
-// Start starts listening, this is a blocking call
-func (e Endpoint) Start() error {
-	return autotls.Run(e.router, "www.fastvote.online", e.hostname)
-	return autotls.RunWithManager(e.router, &autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(e.hostname, fmt.Sprintf("www.%s", e.hostname)),
-	})
+// Start starts listening, this is a blocking call. It returns nil once Shutdown has been called.
+func (e *Endpoint) Start() error {
+	// The challenge server is secondary, if it fails we can still serve HTTPS
+	go func() {
+		if err := e.challengeServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Error("HTTP challenge listener stopped")
+		}
+	}()
+
+	if err := e.tlsServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting new connections and waits for in-flight requests to finish,
+// until the given context is done
+func (e *Endpoint) Shutdown(ctx context.Context) error {
+	// Report as not ready first, and keep serving until the orchestrator has noticed, so no new
+	// traffic is sent our way once we stop accepting it
+	e.health.Drain()
+	select {
+	case <-time.After(e.drain):
+	case <-ctx.Done():
+	}
+	// Event streams never finish by themselves, end them so the servers can drain
+	e.events.Close()
+	if err := e.challengeServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed shutting down the HTTP challenge server: %w", err)
+	}
+	if err := e.tlsServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed shutting down the HTTPS server: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,104 @@
+package httpend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/hookman"
+	"github.com/wallnutkraken/groupplan/httpend/apidoc"
+	"github.com/wallnutkraken/groupplan/notifications"
+)
+
+// newEndpoint creates an Endpoint on a fresh sqlite database with the given settings
+func newEndpoint(t *testing.T, cfg config.AppSettings) *Endpoint {
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	hub := events.NewHub()
+	endpoint, err := New(cfg, db, hub, hookman.New(db.Webhooks(), db.Plans(), http.DefaultClient), notifications.NewPreferences(db.Users(), ""))
+	require.NoError(t, err)
+	return endpoint
+}
+
+func TestShutdown_Drains_ReportsNotReadyWhileServing(t *testing.T) {
+	that := assert.New(t)
+	endpoint := newEndpoint(t, config.AppSettings{Hostname: "localhost", DrainSeconds: 1})
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- endpoint.Shutdown(context.Background())
+	}()
+
+	// Until the drain is over, requests are still served, readiness failing
+	that.Eventually(func() bool {
+		recorder := httptest.NewRecorder()
+		endpoint.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder.Code == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-stopped:
+		t.Fatal("shutdown should wait for the drain")
+	default:
+	}
+	that.NoError(<-stopped)
+}
+
+func TestOpenAPI_CoversEveryRoute(t *testing.T) {
+	that := assert.New(t)
+	endpoint := newEndpoint(t, config.AppSettings{Hostname: "localhost"})
+
+	spec := apidoc.Spec(APIPrefix)
+	served := map[string]bool{}
+	for _, route := range endpoint.router.Routes() {
+		// The HTML pages and static files aren't part of the API
+		if route.Path == "/" || strings.HasPrefix(route.Path, "/static/") {
+			continue
+		}
+		served[strings.ToLower(route.Method)+" "+apidoc.OpenAPIPath(route.Path)] = true
+		operations := spec.Paths[apidoc.OpenAPIPath(route.Path)]
+		that.Contains(operations, strings.ToLower(route.Method), "%s %s is missing from the OpenAPI spec", route.Method, route.Path)
+	}
+	// Nor does the spec describe routes that aren't served, such as unversioned paths for newer endpoints
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			that.True(served[method+" "+path], "%s %s is in the OpenAPI spec but not served", method, path)
+		}
+	}
+
+	for _, name := range []string{"CreatePlanRequest", "AddEntryRequest", "GroupPlan", "PlanEntry", "UserError", "ServerError", "ErrorResponse"} {
+		that.Contains(spec.Components.Schemas, name)
+	}
+}
+
+func TestShutdown_BeforeStart_StopsListening(t *testing.T) {
+	endpoint := newEndpoint(t, config.AppSettings{Hostname: "localhost", DrainSeconds: -1})
+	require.NoError(t, endpoint.Shutdown(context.Background()))
+	// A stop signal can arrive before the servers start listening, they must not start after it
+	assert.NoError(t, endpoint.Start())
+}
+
+func TestIndex_LiveFrontend_ConcurrentRequests(t *testing.T) {
+	endpoint := newEndpoint(t, config.AppSettings{Hostname: "localhost", FrontendDir: filepath.Join("..", "frontend")})
+	done := make(chan struct{})
+	for index := 0; index < 4; index++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			recorder := httptest.NewRecorder()
+			endpoint.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.NoError(t, endpoint.checkFrontend(context.Background()))
+		}()
+	}
+	for index := 0; index < 4; index++ {
+		<-done
+	}
+}
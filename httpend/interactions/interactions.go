@@ -0,0 +1,64 @@
+// Package interactions is responsible for the endpoint Discord sends slash-command interactions to,
+// on /discord/interactions
+package interactions
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+)
+
+// maxBodyBytes is the largest interaction accepted, real ones are a few kilobytes at most
+const maxBodyBytes = 64 * 1024
+
+// Handler is the object responsible for the /discord/interactions endpoint
+type Handler struct {
+	bot       *discordbot.Bot
+	publicKey ed25519.PublicKey
+}
+
+// New creates a new instance of the interactions handler, verifying interactions with the given
+// public key of the Discord application. Without a key, interactions are turned away.
+func New(router gin.IRouter, bot *discordbot.Bot, publicKey ed25519.PublicKey) *Handler {
+	handl := &Handler{
+		bot:       bot,
+		publicKey: publicKey,
+	}
+
+	router.POST("discord/interactions", handl.Interact)
+
+	return handl
+}
+
+// Interact answers an interaction, once its signature checks out. Discord itself sends requests
+// with bad signatures now and then, to make sure they're refused.
+func (h Handler) Interact(ctx *gin.Context) {
+	if h.publicKey == nil {
+		apierror.Abort(ctx, dataerror.ErrNotFound("Discord interactions are not set up"))
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, maxBodyBytes))
+	if err != nil {
+		apierror.Abort(ctx, dataerror.ErrBadRequest("failed reading the request body"))
+		return
+	}
+	if !discordbot.VerifyRequest(h.publicKey, ctx.GetHeader("X-Signature-Ed25519"), ctx.GetHeader("X-Signature-Timestamp"), body, time.Now()) {
+		apierror.Abort(ctx, dataerror.ErrUnauthorized("invalid request signature"))
+		return
+	}
+	interaction := discordbot.Interaction{}
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, h.bot.Handle(interaction))
+}
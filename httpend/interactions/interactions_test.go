@@ -0,0 +1,114 @@
+package interactions_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/interactions"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// setup returns a router with the interactions endpoint, and the key Discord would sign with
+func setup(t *testing.T) (*gin.Engine, ed25519.PrivateKey, *userman.Manager) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	accounts := userman.New(db.Users(), nil)
+	bot := discordbot.NewBot(planman.New(db.Plans(), events.NewHub()), accounts, "https://groupplan.example.com/")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	interactions.New(router.Group("", apierror.Middleware()), bot, publicKey)
+	return router, privateKey, accounts
+}
+
+// send posts an interaction signed with the given key, returning the status and decoded response
+func send(t *testing.T, router *gin.Engine, key ed25519.PrivateKey, interaction discordbot.Interaction) (int, discordbot.InteractionResponse) {
+	body, err := json.Marshal(interaction)
+	require.NoError(t, err)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/discord/interactions", bytes.NewReader(body))
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, append([]byte(timestamp), body...))))
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	response := discordbot.InteractionResponse{}
+	if recorder.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	}
+	return recorder.Code, response
+}
+
+// command builds a /groupplan interaction sent by the given Discord user
+func command(discordID, subcommand string, options map[string]interface{}) discordbot.Interaction {
+	sub := discordbot.CommandOption{Name: subcommand, Type: 1}
+	for name, value := range options {
+		encoded, _ := json.Marshal(value)
+		sub.Options = append(sub.Options, discordbot.CommandOption{Name: name, Value: encoded})
+	}
+	return discordbot.Interaction{
+		Type:   discordbot.InteractionCommand,
+		Data:   &discordbot.CommandData{Name: "groupplan", Options: []discordbot.CommandOption{sub}},
+		Member: &discordbot.Member{User: &discordbot.DiscordUser{ID: discordID, Username: "someone"}},
+	}
+}
+
+func TestInteract_VerifiesSignature(t *testing.T) {
+	that := assert.New(t)
+	router, key, _ := setup(t)
+
+	status, response := send(t, router, key, discordbot.Interaction{Type: discordbot.InteractionPing})
+	that.Equal(http.StatusOK, status)
+	that.Equal(discordbot.ResponsePong, response.Type)
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	status, _ = send(t, router, otherKey, discordbot.Interaction{Type: discordbot.InteractionPing})
+	that.Equal(http.StatusUnauthorized, status)
+}
+
+func TestInteract_CreateAndBest(t *testing.T) {
+	that := assert.New(t)
+	router, key, accounts := setup(t)
+
+	// Someone who never logged in with Discord is told to
+	_, response := send(t, router, key, command("42", "best", map[string]interface{}{"plan": "abc"}))
+	that.Contains(response.Data.Content, "Log in to groupplan with Discord first")
+	that.NotZero(response.Data.Flags, "should only be shown to the sender")
+
+	_, err := accounts.Authenticate("alice@example.com", "", "discord", "42", "Alice")
+	require.NoError(t, err)
+	tomorrow := time.Now().Add(24 * time.Hour).Format("2006-01-02")
+	_, response = send(t, router, key, command("42", "create", map[string]interface{}{"title": "Game night", "start_date": tomorrow, "days": 2}))
+	require.NotNil(t, response.Data)
+	require.Len(t, response.Data.Embeds, 1)
+	that.Equal("New plan: Game night", response.Data.Embeds[0].Title)
+	identifier := response.Data.Embeds[0].Footer.Text[len("Plan "):]
+
+	_, response = send(t, router, key, command("42", "best", map[string]interface{}{"plan": identifier}))
+	require.Len(t, response.Data.Embeds, 1)
+	that.Equal("Best times for Game night", response.Data.Embeds[0].Title)
+	that.Equal("Nobody has added their availability yet.", response.Data.Embeds[0].Description)
+
+	_, response = send(t, router, key, command("42", "status", map[string]interface{}{"plan": "missing"}))
+	that.Equal("no such plan exists", response.Data.Content)
+}
@@ -0,0 +1,151 @@
+// Package notification is responsible for the endpoints of notification preferences, the logged in
+// user's on /me/notifications and the unsubscribe links sent in emails on /notifications/unsubscribe
+package notification
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/httpend/userauth"
+	"github.com/wallnutkraken/groupplan/notifications"
+)
+
+// UnsubscribePath is where unsubscribe links point, relative to the API root
+const UnsubscribePath = "notifications/unsubscribe"
+
+// unsubscribePage asks whoever opened an unsubscribe link to confirm, as opening a link mustn't
+// change anything: mail scanners open them too. Once confirmed, it says they're unsubscribed.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe - groupplan</title></head>
+<body>
+{{if .Done}}<p>You're unsubscribed. You can change which notifications you get, and how, in your groupplan settings.</p>
+{{else}}<form method="post" action="?{{.Query}}">
+<input type="hidden" name="confirm" value="page">
+<p>Stop getting these groupplan notifications?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// unsubscribePageData is what the unsubscribe page is rendered with
+type unsubscribePageData struct {
+	Done  bool
+	Query string
+}
+
+// Handler is the object responsible for the notification preference endpoints
+type Handler struct {
+	auther      userauth.Authenticator
+	preferences *notifications.Preferences
+}
+
+// New creates a new instance of the notification preferences handler
+func New(router gin.IRouter, auth userauth.Authenticator, preferences *notifications.Preferences) *Handler {
+	handl := &Handler{
+		auther:      auth,
+		preferences: preferences,
+	}
+
+	// Add the endpoints
+	router.GET("me/notifications", handl.GetSettings)
+	router.PUT("me/notifications", handl.SetSettings)
+	// Links in emails are opened with GET, which only asks to confirm. The confirmation, and mail
+	// clients unsubscribing in one click (RFC 8058), use POST.
+	router.GET(UnsubscribePath, handl.ConfirmUnsubscribe)
+	router.POST(UnsubscribePath, handl.Unsubscribe)
+
+	return handl
+}
+
+// GetSettings returns the logged in user's notification preferences
+func (h Handler) GetSettings(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	settings, err := h.preferences.Get(user)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, settings)
+}
+
+// SetSettings changes the logged in user's notification preferences
+func (h Handler) SetSettings(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := notifications.SettingsChange{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+	settings, err := h.preferences.Set(user, req)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, settings)
+}
+
+// ConfirmUnsubscribe shows the page confirming an unsubscribe link, without unsubscribing yet
+func (h Handler) ConfirmUnsubscribe(ctx *gin.Context) {
+	userID, err := linkUser(ctx)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	event, signature := ctx.Query("event"), ctx.Query("signature")
+	if err := h.preferences.CheckUnsubscribe(userID, event, signature); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	query := url.Values{}
+	query.Set("user", strconv.FormatUint(uint64(userID), 10))
+	query.Set("event", event)
+	query.Set("signature", signature)
+	ctx.Render(http.StatusOK, render.HTML{Template: unsubscribePage, Data: unsubscribePageData{Query: query.Encode()}})
+}
+
+// Unsubscribe turns off the kind of notification an unsubscribe link is for, no login needed
+func (h Handler) Unsubscribe(ctx *gin.Context) {
+	userID, err := linkUser(ctx)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	event := ctx.Query("event")
+	if err := h.preferences.Unsubscribe(userID, event, ctx.Query("signature")); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	reqlog.Logger(ctx).WithFields(logrus.Fields{"user_id": userID, "notification": event}).Info("Unsubscribed from notifications")
+	if ctx.PostForm("confirm") == "page" {
+		ctx.Render(http.StatusOK, render.HTML{Template: unsubscribePage, Data: unsubscribePageData{Done: true}})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// linkUser returns the ID of the user an unsubscribe link is for
+func linkUser(ctx *gin.Context) (uint, error) {
+	userID, err := strconv.ParseUint(ctx.Query("user"), 10, 32)
+	if err != nil {
+		return 0, dataerror.ErrBadRequest("user is not an unsigned integer")
+	}
+	return uint(userID), nil
+}
@@ -0,0 +1,65 @@
+package notification_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/notification"
+	"github.com/wallnutkraken/groupplan/notifications"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+func TestUnsubscribe_OpeningTheLinkOnlyConfirms(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	bob, err := userman.New(db.Users(), nil).Authenticate("bob@example.com", "", "discord", "2", "Bob")
+	require.NoError(t, err)
+	preferences := notifications.NewPreferences(db.Users(), "/"+notification.UnsubscribePath)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	notification.New(router.Group("", apierror.Middleware()), nil, preferences)
+	request := func(method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	channel := func(event string) string {
+		user, err := db.Users().GetUser(bob.ID)
+		require.NoError(t, err)
+		settings, err := preferences.Get(user)
+		require.NoError(t, err)
+		return settings.Events[event].Channel
+	}
+
+	link, err := preferences.UnsubscribeURL(bob, notifications.PlanFinalized)
+	require.NoError(t, err)
+	opened := request(http.MethodGet, link, nil)
+	that.Equal(http.StatusOK, opened.Code)
+	that.Contains(opened.Body.String(), `<form method="post"`)
+	that.Equal(notifications.ChannelEmail, channel(notifications.PlanFinalized), "opening the link changes nothing")
+	that.Equal(http.StatusForbidden, request(http.MethodGet, strings.Replace(link, "signature=", "signature=0", 1), nil).Code)
+
+	confirmed := request(http.MethodPost, link, url.Values{"confirm": {"page"}})
+	that.Equal(http.StatusOK, confirmed.Code)
+	that.Contains(confirmed.Body.String(), "You're unsubscribed")
+	that.Equal(notifications.ChannelNone, channel(notifications.PlanFinalized))
+
+	// Mail clients unsubscribe in one click
+	link, err = preferences.UnsubscribeURL(bob, notifications.Reminder)
+	require.NoError(t, err)
+	that.Equal(http.StatusNoContent, request(http.MethodPost, link, url.Values{"List-Unsubscribe": {"One-Click"}}).Code)
+	that.Equal(notifications.ChannelNone, channel(notifications.Reminder))
+}
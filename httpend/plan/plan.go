@@ -2,54 +2,91 @@
 package plan
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/sirupsen/logrus"
-
 	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/events"
 	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
-	"github.com/wallnutkraken/groupplan/httpend/shtypes"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
 	"github.com/wallnutkraken/groupplan/httpend/userauth"
 	"github.com/wallnutkraken/groupplan/planman"
 )
 
+const (
+	// defaultSlotLimit and maxSlotLimit bound how many slots BestSlots returns
+	defaultSlotLimit = 5
+	maxSlotLimit     = 50
+
+	// heartbeatInterval is how often an idle event stream gets a comment, so proxies don't close it
+	heartbeatInterval = 25 * time.Second
+	// retryMillis is how long browsers wait before reconnecting a dropped event stream
+	retryMillis = 3000
+	// resyncEvent tells the client that it missed events, and should reload the plan
+	resyncEvent = "resync"
+)
+
 // Handler is the object responsible for the /plans endpoint
 type Handler struct {
 	group   *gin.RouterGroup
 	auther  userauth.Authenticator
 	planner planman.Planner
+	hub     *events.Hub
 }
 
-// New creates a new instance of the plans handler
-func New(router *gin.Engine, auth userauth.Authenticator, planner planman.Planner) *Handler {
+// New creates a new instance of the plans handler, with its endpoints on the given router. Live
+// updates on plans are streamed from the given hub.
+func New(router gin.IRouter, auth userauth.Authenticator, planner planman.Planner, hub *events.Hub) *Handler {
 	handl := &Handler{
 		group:   router.Group("plans"),
 		auther:  auth,
 		planner: planner,
+		hub:     hub,
 	}
 
 	// Add the endpoints
-	handl.group.PUT("", handl.NewPlan)
-	handl.group.GET(":identifier", handl.GetPlan)
-	handl.group.GET("", handl.MyPlans)
-	handl.group.PUT(":identifier", handl.AddEntry)
-	handl.group.DELETE(":identifier", handl.DeletePlan)
-	handl.group.DELETE(":identifier/entries/:entryID", handl.DeleteEntry)
-	handl.group.GET(":identifier/entries", handl.GetEntriesForPlan)
+	handl.addOriginal(handl.group)
+	handl.group.PUT(":identifier/join", handl.JoinPlan)
+	handl.group.PUT(":identifier/final", handl.FinalizePlan)
+	handl.group.PUT(":identifier/discord", handl.SetDiscordWebhook)
+	handl.group.DELETE(":identifier/discord", handl.RemoveDiscordWebhook)
+	handl.group.PUT(":identifier/deadline", handl.SetResponseDeadline)
+	handl.group.DELETE(":identifier/deadline", handl.RemoveResponseDeadline)
+	handl.group.PUT(":identifier/requirements", handl.SetRequirements)
+	handl.group.GET(":identifier/events", handl.Events)
+	handl.group.GET(":identifier/socket", handl.Socket)
 
 	return handl
 }
 
+// RegisterLegacy adds the endpoints the unversioned API had to another router. The ones added
+// since the versioned API are only served by New's router.
+func (h Handler) RegisterLegacy(router gin.IRouter) {
+	h.addOriginal(router.Group("plans"))
+}
+
+// addOriginal adds the endpoints the unversioned API had to the given plans group
+func (h Handler) addOriginal(group gin.IRouter) {
+	group.PUT("", h.NewPlan)
+	group.GET(":identifier", h.GetPlan)
+	group.GET("", h.MyPlans)
+	group.PUT(":identifier", h.AddEntry)
+	group.DELETE(":identifier", h.DeletePlan)
+	group.DELETE(":identifier/entries/:entryID", h.DeleteEntry)
+	group.GET(":identifier/entries", h.GetEntriesForPlan)
+	group.GET(":identifier/slots", h.BestSlots)
+}
+
 // NewPlan creates a new plan
 func (h Handler) NewPlan(ctx *gin.Context) {
 	// Check authorization
 	user, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 
@@ -59,26 +96,27 @@ func (h Handler) NewPlan(ctx *gin.Context) {
 		MinAvailabilitySeconds: 60 * 5,
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, shtypes.NewUserError(err.Error()))
+		apierror.Abort(ctx, apierror.Bind(err))
 		return
 	}
 	// Parse the start date
 	startDate, err := time.Parse("2006-1-2", req.StartDate)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, shtypes.NewUserError(fmt.Sprintf("invalid start date format [%s], please use yyyy-mm-dd", req.StartDate)))
+		apierror.Abort(ctx, dataerror.ErrField("start_date", fmt.Sprintf("invalid start date format [%s], please use yyyy-mm-dd", req.StartDate)))
 		return
 	}
-	plan, err := h.planner.NewPlan(req.Title, startDate, req.DurationDays, user)
+	options := planman.PlanOptions{
+		Quorum:            req.Quorum,
+		DiscordWebhookURL: req.DiscordWebhookURL,
+		AutoFinalize:      req.AutoFinalize,
+	}
+	if req.ResponseDeadline != 0 {
+		deadline := time.Unix(req.ResponseDeadline, 0)
+		options.ResponseDeadline = &deadline
+	}
+	plan, err := h.planner.NewPlan(req.Title, startDate, req.DurationDays, req.MinAvailabilitySeconds, user, options)
 	if err != nil {
-		if errors.As(err, &dataerror.BaseError{}) {
-			// User error, return the contents with an error
-			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, shtypes.NewUserError(err.Error()))
-			return
-		}
-		// Non-user error, log it and return 500
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
@@ -93,21 +131,13 @@ func (h Handler) GetPlan(ctx *gin.Context) {
 	// Check authorization
 	_, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 
 	plan, err := h.planner.GetPlan(identifier)
 	if err != nil {
-		if errors.As(err, &dataerror.BaseError{}) {
-			// User error, return the contents with an error
-			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, shtypes.NewUserError(err.Error()))
-			return
-		}
-		// Non-user error, log it and return 500
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
@@ -115,22 +145,36 @@ func (h Handler) GetPlan(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, plan)
 }
 
+// JoinPlan makes the user one of the members of a plan, returning the plan
+func (h Handler) JoinPlan(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+
+	plan, err := h.planner.JoinPlan(ctx.Param("identifier"), user)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, plan)
+}
+
 // MyPlans returns the authorized user's owned plans
 func (h Handler) MyPlans(ctx *gin.Context) {
 	// Check authorization
 	user, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 	// Get the plans for the authorized user
 	plans, err := h.planner.GetPlans(user)
 	if err != nil {
-		// There can be no user input error, so we just log whatever this error is
-		// and return an internal server error
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
@@ -143,26 +187,19 @@ func (h Handler) AddEntry(ctx *gin.Context) {
 	// Check authorization
 	user, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 	// Read the request body
 	req := AddEntryRequest{}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, shtypes.NewUserError(err.Error()))
+		apierror.Abort(ctx, apierror.Bind(err))
 		return
 	}
 
 	entry, err := h.planner.AddEntry(ctx.Param("identifier"), user, req.StartTime, req.DurationSeconds)
 	if err != nil {
-		if errors.As(err, &dataerror.BaseError{}) {
-			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, shtypes.NewUserError(err.Error()))
-			return
-		}
-		// Non-user error, log it and return 500
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
@@ -175,23 +212,14 @@ func (h Handler) DeletePlan(ctx *gin.Context) {
 	// Check authorization
 	user, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 	// Get the identifier
 	identifier := ctx.Param("identifier")
 
 	if err := h.planner.DeletePlan(identifier, user); err != nil {
-		userError := dataerror.BaseError{}
-		if errors.As(err, &userError) {
-			// User error, return the contents with an error
-			ctx.AbortWithStatusJSON(userError.StatusCode(), shtypes.NewUserError(userError.Error()))
-			return
-		}
-		// Non-user error, log it and return 500
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
@@ -203,7 +231,7 @@ func (h Handler) DeleteEntry(ctx *gin.Context) {
 	// Check authorization
 	user, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 	// Here's the deal, this endpoint is in /plans/:planID/entries/:entryID
@@ -216,21 +244,12 @@ func (h Handler) DeleteEntry(ctx *gin.Context) {
 	entryIDString := ctx.Param("entryID")
 	entryID, err := strconv.ParseUint(entryIDString, 10, 32)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, shtypes.NewUserError("entry ID is not an unsigned integer"))
+		apierror.Abort(ctx, dataerror.ErrBadRequest("entry ID is not an unsigned integer"))
 		return
 	}
 
 	if err := h.planner.DeleteEntry(uint(entryID), user); err != nil {
-		userError := dataerror.BaseError{}
-		if errors.As(err, &userError) {
-			// User error, return the contents with an error
-			ctx.AbortWithStatusJSON(userError.StatusCode(), shtypes.NewUserError(userError.Error()))
-			return
-		}
-		// Non-user error, log it and return 500
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
@@ -243,20 +262,248 @@ func (h Handler) GetEntriesForPlan(ctx *gin.Context) {
 	// Check authorization
 	user, err := h.auther.GetJWT(ctx)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, shtypes.NewUserError("Please log in"))
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
 		return
 	}
 
 	identifier := ctx.Param("identifier")
 	entries, err := h.planner.GetEntriesOnPlanByUser(identifier, user)
 	if err != nil {
-		// There can be no user input error, so we just log whatever this error is
-		// and return an internal server error
-		refErr := shtypes.NewServerError()
-		logrus.WithError(err).Errorf("[%s]", refErr.Reference)
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, refErr)
+		apierror.Abort(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, entries)
 }
+
+// BestSlots returns the times on a plan where the most users are available
+func (h Handler) BestSlots(ctx *gin.Context) {
+	// Check authorization
+	_, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	limit := defaultSlotLimit
+	if raw := ctx.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxSlotLimit {
+			apierror.Abort(ctx, dataerror.ErrField("limit", fmt.Sprintf("limit must be a number between 1 and %d", maxSlotLimit)))
+			return
+		}
+	}
+
+	slots, err := h.planner.BestSlots(ctx.Param("identifier"), limit)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, slots)
+}
+
+// FinalizePlan settles a plan on a time, only its owner can do it
+func (h Handler) FinalizePlan(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := FinalizePlanRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+
+	final, err := h.planner.FinalizePlan(ctx.Param("identifier"), user, req.StartTime, req.DurationSeconds)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, final)
+}
+
+// SetDiscordWebhook sets the Discord webhook announcements about a plan are posted to
+func (h Handler) SetDiscordWebhook(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := DiscordWebhookRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+	if req.WebhookURL == "" {
+		apierror.Abort(ctx, dataerror.ErrField("webhook_url", "the webhook URL is required"))
+		return
+	}
+
+	if err := h.planner.SetDiscordWebhook(ctx.Param("identifier"), user, req.WebhookURL); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RemoveDiscordWebhook stops the Discord announcements about a plan
+func (h Handler) RemoveDiscordWebhook(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+
+	if err := h.planner.SetDiscordWebhook(ctx.Param("identifier"), user, ""); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// Events streams changes made to a plan as Server-Sent Events, until the client disconnects. A
+// client reconnecting with the Last-Event-ID header first gets the events it missed, or a resync
+// event if those are no longer available.
+func (h Handler) Events(ctx *gin.Context) {
+	// Anyone who can see the plan can follow it
+	_, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	identifier := ctx.Param("identifier")
+	if _, err := h.planner.GetPlan(identifier); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	sub, missed, complete := h.hub.Resume(identifier, ctx.GetHeader("Last-Event-ID"))
+	defer sub.Close()
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	fmt.Fprintf(ctx.Writer, "retry: %d\n\n", retryMillis)
+	if !complete {
+		fmt.Fprintf(ctx.Writer, "id: %s\nevent: %s\ndata: {}\n\n", h.hub.StreamID(sub.StartID()), resyncEvent)
+	}
+	for _, event := range missed {
+		if err := h.writeEvent(ctx.Writer, event); err != nil {
+			return
+		}
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(ctx.Writer, ": heartbeat\n\n")
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped by the hub, the client will reconnect and catch up
+				return
+			}
+			if err := h.writeEvent(ctx.Writer, event); err != nil {
+				return
+			}
+			if event.Type == events.PlanDeleted {
+				// Nothing more will happen on this plan
+				ctx.Writer.Flush()
+				return
+			}
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+// writeEvent writes a single event in the Server-Sent Events format
+func (h Handler) writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed encoding event [%d]: %w", event.ID, err)
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", h.hub.StreamID(event.ID), event.Type, data)
+	return err
+}
+
+// SetResponseDeadline sets when participants of a plan should have added their availability by
+func (h Handler) SetResponseDeadline(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := ResponseDeadlineRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+	if req.DeadlineUnix == 0 {
+		apierror.Abort(ctx, dataerror.ErrField("deadline_unix", "the deadline is required"))
+		return
+	}
+
+	deadline := time.Unix(req.DeadlineUnix, 0)
+	if err := h.planner.SetResponseDeadline(ctx.Param("identifier"), user, &deadline, req.AutoFinalize); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// SetRequirements sets how many people a plan needs available at once, and which of its members
+// it can't happen without
+func (h Handler) SetRequirements(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := RequirementsRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+
+	if err := h.planner.SetRequirements(ctx.Param("identifier"), user, req.Quorum, req.RequiredMemberIDs); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RemoveResponseDeadline removes the response deadline of a plan, along with the reminder before it
+func (h Handler) RemoveResponseDeadline(ctx *gin.Context) {
+	// Check authorization
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+
+	if err := h.planner.SetResponseDeadline(ctx.Param("identifier"), user, nil, false); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -1,15 +1,67 @@
 package plan
 
+import (
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/httpend/shtypes"
+	"github.com/wallnutkraken/groupplan/planman"
+)
+
 // CreatePlanRequest is the JSON request object for creating a new plan
-type CreatePlanRequest struct {
-	Title                  string `json:"title"`
-	StartDate              string `json:"start_date"`
-	DurationDays           uint   `json:"duration_days"`
-	MinAvailabilitySeconds uint   `json:"min_availability_seconds"`
-}
+type CreatePlanRequest = apitypes.CreatePlanRequest
 
 // AddEntryRequest is the JSON request object for creating a new entry
-type AddEntryRequest struct {
-	StartTime       int64 `json:"start_time_unix"`
-	DurationSeconds int64 `json:"duration_seconds"`
+type AddEntryRequest = apitypes.AddEntryRequest
+
+// FinalizePlanRequest is the JSON request object for settling a plan on a time
+type FinalizePlanRequest = apitypes.FinalizePlanRequest
+
+// DiscordWebhookRequest is the JSON request object for setting a plan's Discord webhook
+type DiscordWebhookRequest = apitypes.DiscordWebhookRequest
+
+// ResponseDeadlineRequest is the JSON request object for setting a plan's response deadline
+type ResponseDeadlineRequest = apitypes.ResponseDeadlineRequest
+
+// RequirementsRequest is the JSON request object for setting who and how many people a plan needs
+type RequirementsRequest = apitypes.RequirementsRequest
+
+// Commands clients can send over the plan WebSocket
+const (
+	CommandAddEntry    = "add_entry"
+	CommandDeleteEntry = "delete_entry"
+)
+
+// Messages the server sends over the plan WebSocket
+const (
+	MessageSnapshot = "snapshot"
+	MessageEvent    = "event"
+	MessageResult   = "result"
+	MessagePing     = "ping"
+)
+
+// SocketCommand is a command sent by the client over the plan WebSocket. add_entry uses the
+// start time and duration, delete_entry the entry ID.
+type SocketCommand struct {
+	Type string `json:"type"`
+	// Ref is chosen by the client, and returned with the result of the command
+	Ref             string `json:"ref,omitempty"`
+	StartTime       int64  `json:"start_time_unix,omitempty"`
+	DurationSeconds int64  `json:"duration_seconds,omitempty"`
+	EntryID         uint   `json:"entry_id,omitempty"`
+}
+
+// SocketMessage is a message sent by the server over the plan WebSocket. The first message is a
+// snapshot of the plan, followed by an event message for every change, including the ones made
+// over the socket, and a result message for every command.
+type SocketMessage struct {
+	Type    string             `json:"type"`
+	Ref     string             `json:"ref,omitempty"`
+	Plan    *planman.GroupPlan `json:"plan,omitempty"`
+	Present []interface{}      `json:"present,omitempty"`
+	// EventID is the stream ID of the event, the same as over Server-Sent Events. A snapshot's is
+	// that of the last event it includes.
+	EventID string               `json:"event_id,omitempty"`
+	Event   events.Type          `json:"event,omitempty"`
+	Data    interface{}          `json:"data,omitempty"`
+	Error   *shtypes.ErrorDetail `json:"error,omitempty"`
 }
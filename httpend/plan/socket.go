@@ -0,0 +1,163 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/userman"
+	"golang.org/x/net/websocket"
+)
+
+// maxCommandBytes is the largest command accepted over the plan WebSocket
+const maxCommandBytes = 4096
+
+// Socket upgrades to a WebSocket for editing a plan together: clients send add_entry and
+// delete_entry commands, and receive everyone's changes and who else is watching as they happen
+func (h Handler) Socket(ctx *gin.Context) {
+	// Anyone who can see the plan can join, the commands check what they're allowed to change
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	identifier := ctx.Param("identifier")
+	if _, err := h.planner.GetPlan(identifier); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maxCommandBytes
+			h.serveSocket(ctx, conn, identifier, user)
+		},
+	}
+	server.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+// sameOrigin rejects WebSocket connections started by pages on other sites, which would otherwise
+// be able to use the visitor's session cookie. Clients that aren't browsers don't send an Origin.
+func sameOrigin(cfg *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host != req.Host {
+		return fmt.Errorf("origin [%s] is not allowed", origin)
+	}
+	return nil
+}
+
+// serveSocket runs a plan WebSocket until either side closes it
+func (h Handler) serveSocket(ctx *gin.Context, conn *websocket.Conn, identifier string, user users.User) {
+	defer conn.Close()
+
+	// Subscribe before taking the snapshot, so no change falls in between. Changes made in the
+	// meantime show up in both, clients can tell by the entry IDs.
+	sub, _, _ := h.hub.Subscribe(identifier, 0)
+	defer sub.Close()
+	plan, err := h.planner.GetPlan(identifier)
+	if err != nil {
+		// The plan was deleted right after the upgrade
+		return
+	}
+	h.hub.Join(identifier, user.ID, userman.User{DisplayName: user.DisplayName, AvatarURL: user.ProfilePictureURL})
+	defer h.hub.Leave(identifier, user.ID)
+	snapshot := SocketMessage{Type: MessageSnapshot, Plan: &plan, Present: h.hub.Present(identifier), EventID: h.hub.StreamID(sub.StartID())}
+	if err := websocket.JSON.Send(conn, snapshot); err != nil {
+		return
+	}
+
+	// Commands are read on their own goroutine, all writes happen here
+	results := make(chan SocketMessage)
+	done := make(chan struct{})
+	defer close(done)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var raw []byte
+			if err := websocket.Message.Receive(conn, &raw); err != nil {
+				return
+			}
+			result, authenticated := h.runCommand(ctx, identifier, raw)
+			select {
+			case results <- result:
+			case <-done:
+				return
+			}
+			if !authenticated {
+				// The session has ended, the result telling the client why is the last message
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var message SocketMessage
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			message = SocketMessage{Type: MessagePing}
+		case result := <-results:
+			message = result
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped by the hub, the client will reconnect and take a new snapshot
+				return
+			}
+			message = SocketMessage{Type: MessageEvent, EventID: h.hub.StreamID(event.ID), Event: event.Type, Data: event.Data}
+		}
+		if err := websocket.JSON.Send(conn, message); err != nil {
+			return
+		}
+		if message.Event == events.PlanDeleted {
+			return
+		}
+	}
+}
+
+// runCommand carries out a command through the planner, the same way the HTTP endpoints do. The
+// session is checked again for every command, since it can expire or its user be disabled while
+// the socket is open; authenticated is false when it no longer holds.
+func (h Handler) runCommand(ctx *gin.Context, identifier string, raw []byte) (result SocketMessage, authenticated bool) {
+	command := SocketCommand{}
+	if err := json.Unmarshal(raw, &command); err != nil {
+		_, detail := apierror.Detail(ctx, apierror.Bind(err))
+		return SocketMessage{Type: MessageResult, Error: &detail}, true
+	}
+	result = SocketMessage{Type: MessageResult, Ref: command.Ref}
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		_, detail := apierror.Detail(ctx, apierror.Unauthenticated(err))
+		result.Error = &detail
+		return result, false
+	}
+	switch command.Type {
+	case CommandAddEntry:
+		result.Data, err = h.planner.AddEntry(identifier, user, command.StartTime, command.DurationSeconds)
+	case CommandDeleteEntry:
+		err = h.planner.DeleteEntry(command.EntryID, user)
+	default:
+		err = dataerror.ErrField("type", fmt.Sprintf("unknown command [%s]", command.Type))
+	}
+	if err != nil {
+		_, detail := apierror.Detail(ctx, err)
+		result.Data = nil
+		result.Error = &detail
+	}
+	return result, true
+}
@@ -0,0 +1,196 @@
+package plan_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/plan"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+	"golang.org/x/net/websocket"
+)
+
+// emailAuth authenticates requests as the user whose email address is in the X-Email header, the
+// way a session would: disabled users are rejected
+type emailAuth struct {
+	accounts *userman.Manager
+}
+
+func (a emailAuth) GetJWT(ctx *gin.Context) (users.User, error) {
+	if ctx.GetHeader("X-Email") == "" {
+		return users.User{}, errors.New("not logged in")
+	}
+	return a.accounts.GetAuthenticatedUser(ctx.GetHeader("X-Email"))
+}
+
+func (a emailAuth) IsAdmin(user users.User) bool {
+	return a.accounts.IsAdmin(user)
+}
+
+// socketServer serves the plan endpoints on a test server, returning it along with what it uses
+func socketServer(t *testing.T) (*httptest.Server, groupdata.Data, planman.Planner) {
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	hub := events.NewHub()
+	planner := planman.New(db.Plans(), hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	plan.New(router.Group("", apierror.Middleware()), emailAuth{accounts: userman.New(db.Users(), nil)}, planner, hub)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, db, planner
+}
+
+// dial opens the WebSocket of a plan as the user with the given email, from a page on origin
+func dial(server *httptest.Server, identifier, email, origin string) (*websocket.Conn, error) {
+	cfg, err := websocket.NewConfig(strings.Replace(server.URL, "http", "ws", 1)+"/plans/"+identifier+"/socket", origin)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Header.Set("X-Email", email)
+	return websocket.DialConfig(cfg)
+}
+
+// receive returns the next message that isn't a ping or about who is watching
+func receive(t *testing.T, conn *websocket.Conn) plan.SocketMessage {
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		message := plan.SocketMessage{}
+		require.NoError(t, websocket.JSON.Receive(conn, &message))
+		if message.Type != plan.MessagePing && message.Event != events.PresenceChanged {
+			return message
+		}
+	}
+}
+
+// receiveBoth returns the result of a command and the event it caused, which can arrive in any order
+func receiveBoth(t *testing.T, conn *websocket.Conn) (result, event plan.SocketMessage) {
+	for _, message := range []plan.SocketMessage{receive(t, conn), receive(t, conn)} {
+		if message.Type == plan.MessageResult {
+			result = message
+		} else {
+			event = message
+		}
+	}
+	return result, event
+}
+
+func TestSocket_SnapshotThenEvents(t *testing.T) {
+	that := assert.New(t)
+	server, db, planner := socketServer(t)
+	owner, err := db.Users().GetOrCreateUser("owner@example.com", "", "Owner")
+	require.NoError(t, err)
+	created, err := planner.NewPlan("Plan", time.Now(), 2, 60, owner, planman.PlanOptions{})
+	require.NoError(t, err)
+	start := created.FromDate.Unix()
+	_, err = planner.AddEntry(created.Identifier, owner, start, 3600)
+	require.NoError(t, err)
+
+	conn, err := dial(server, created.Identifier, owner.Email, server.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	snapshot := receive(t, conn)
+	require.Equal(t, plan.MessageSnapshot, snapshot.Type)
+	require.NotNil(t, snapshot.Plan)
+	that.Len(snapshot.Plan.Entries, 1)
+
+	// A change made elsewhere after the snapshot follows it
+	_, err = planner.AddEntry(created.Identifier, owner, start+7200, 3600)
+	require.NoError(t, err)
+	event := receive(t, conn)
+	that.Equal(plan.MessageEvent, event.Type)
+	that.Equal(events.EntryAdded, event.Event)
+	// Both carry the hub's epoch, the same as the IDs streamed over Server-Sent Events
+	epoch := strings.SplitN(snapshot.EventID, "-", 2)[0]
+	that.NotEmpty(epoch)
+	that.True(strings.HasPrefix(event.EventID, epoch+"-"), "event ID [%s] lacks the epoch of [%s]", event.EventID, snapshot.EventID)
+	that.NotEqual(snapshot.EventID, event.EventID)
+}
+
+func TestSocket_Commands(t *testing.T) {
+	that := assert.New(t)
+	server, db, planner := socketServer(t)
+	owner, err := db.Users().GetOrCreateUser("owner@example.com", "", "Owner")
+	require.NoError(t, err)
+	guest, err := db.Users().GetOrCreateUser("guest@example.com", "", "Guest")
+	require.NoError(t, err)
+	created, err := planner.NewPlan("Plan", time.Now(), 2, 60, owner, planman.PlanOptions{})
+	require.NoError(t, err)
+	start := created.FromDate.Unix()
+	ownerEntry, err := planner.AddEntry(created.Identifier, owner, start, 3600)
+	require.NoError(t, err)
+
+	conn, err := dial(server, created.Identifier, guest.Email, server.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, plan.MessageSnapshot, receive(t, conn).Type)
+
+	require.NoError(t, websocket.JSON.Send(conn, plan.SocketCommand{Type: plan.CommandAddEntry, Ref: "add", StartTime: start, DurationSeconds: 3600}))
+	result, event := receiveBoth(t, conn)
+	that.Equal("add", result.Ref)
+	that.Nil(result.Error)
+	that.Equal(events.EntryAdded, event.Event)
+	added := event.Data.(map[string]interface{})
+	entryID := uint(added["entry_id"].(float64))
+
+	// The planner's checks apply, the same as over HTTP
+	require.NoError(t, websocket.JSON.Send(conn, plan.SocketCommand{Type: plan.CommandAddEntry, Ref: "short", StartTime: start, DurationSeconds: 1}))
+	result = receive(t, conn)
+	that.Equal("short", result.Ref)
+	if that.NotNil(result.Error) {
+		that.Equal(dataerror.CodeValidation, result.Error.Code)
+		that.Equal("duration_seconds", result.Error.Field)
+	}
+	require.NoError(t, websocket.JSON.Send(conn, plan.SocketCommand{Type: plan.CommandDeleteEntry, Ref: "theirs", EntryID: ownerEntry.EntryID}))
+	result = receive(t, conn)
+	if that.NotNil(result.Error) {
+		that.Equal(dataerror.CodeForbidden, result.Error.Code)
+	}
+
+	require.NoError(t, websocket.JSON.Send(conn, plan.SocketCommand{Type: plan.CommandDeleteEntry, Ref: "delete", EntryID: entryID}))
+	result, event = receiveBoth(t, conn)
+	that.Equal("delete", result.Ref)
+	that.Nil(result.Error)
+	that.Equal(events.EntryRemoved, event.Event)
+
+	// The session is checked on every command, not only when connecting
+	_, err = userman.New(db.Users(), nil).SetDisabled(guest.ID, true)
+	require.NoError(t, err)
+	require.NoError(t, websocket.JSON.Send(conn, plan.SocketCommand{Type: plan.CommandAddEntry, Ref: "disabled", StartTime: start, DurationSeconds: 3600}))
+	result = receive(t, conn)
+	that.Equal("disabled", result.Ref)
+	if that.NotNil(result.Error) {
+		that.Equal(dataerror.CodeForbidden, result.Error.Code)
+	}
+	var closed plan.SocketMessage
+	that.Error(websocket.JSON.Receive(conn, &closed), "the socket is closed once the session no longer holds")
+	entries, err := planner.GetEntriesOnPlanByUser(created.Identifier, guest)
+	require.NoError(t, err)
+	that.Empty(entries)
+}
+
+func TestSocket_RejectsOtherOrigins(t *testing.T) {
+	server, db, planner := socketServer(t)
+	owner, err := db.Users().GetOrCreateUser("owner@example.com", "", "Owner")
+	require.NoError(t, err)
+	created, err := planner.NewPlan("Plan", time.Now(), 2, 60, owner, planman.PlanOptions{})
+	require.NoError(t, err)
+
+	_, err = dial(server, created.Identifier, owner.Email, "https://elsewhere.example")
+	assert.Error(t, err)
+}
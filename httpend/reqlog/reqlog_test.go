@@ -0,0 +1,53 @@
+package reqlog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/httpend/shtypes"
+)
+
+// failingRouter returns a router with a single route that always fails with a server error
+func failingRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(reqlog.Middleware())
+	router.GET("/fail", func(ctx *gin.Context) {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, shtypes.NewServerError(ctx))
+	})
+	return router
+}
+
+func TestMiddleware_ServerError_ReferencesRequestID(t *testing.T) {
+	that := assert.New(t)
+	recorder := httptest.NewRecorder()
+	failingRouter().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	requestID := recorder.Header().Get(reqlog.RequestIDHeader)
+	that.NotEmpty(requestID, "response should carry a request ID")
+	body := shtypes.ServerError{}
+	that.NoError(json.Unmarshal(recorder.Body.Bytes(), &body))
+	that.Equal(requestID, body.Reference)
+}
+
+func TestMiddleware_IncomingRequestID_KeptOnlyIfValid(t *testing.T) {
+	that := assert.New(t)
+	router := failingRouter()
+
+	request := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	request.Header.Set(reqlog.RequestIDHeader, "proxy-assigned-1234")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	that.Equal("proxy-assigned-1234", recorder.Header().Get(reqlog.RequestIDHeader))
+
+	request = httptest.NewRequest(http.MethodGet, "/fail", nil)
+	request.Header.Set(reqlog.RequestIDHeader, "bad id\nwith newline")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	that.NotEqual("bad id\nwith newline", recorder.Header().Get(reqlog.RequestIDHeader))
+}
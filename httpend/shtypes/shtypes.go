@@ -2,7 +2,10 @@
 package shtypes
 
 import (
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
 )
 
 // UserError is a response type for user errors (i.e. not server errors)
@@ -10,15 +13,27 @@ type UserError struct {
 	Error string `json:"error"`
 }
 
-// ServerError is a response type for system errors, containing a UUID which should be mirrored in logs
+// ServerError is a response type for system errors, containing a reference which should be mirrored in logs
 type ServerError struct {
 	Reference string `json:"error_reference"`
 }
 
-// NewServerError creates a new ServerError instance with a UUID provided
-func NewServerError() ServerError {
+// ErrorResponse is the body of every error response on the versioned API
+type ErrorResponse = apitypes.ErrorResponse
+
+// ErrorDetail describes what went wrong. Code is one of the dataerror codes, or "internal" for server
+// errors, which come with a reference to find them in the logs instead of a detailed message.
+type ErrorDetail = apitypes.ErrorDetail
+
+// NewServerError creates a new ServerError instance, referencing the request ID so the error can be
+// found in the logs. Outside of a request a fresh UUID is used.
+func NewServerError(ctx *gin.Context) ServerError {
+	reference := reqlog.RequestID(ctx)
+	if reference == "" {
+		reference = uuid.New().String()
+	}
 	return ServerError{
-		Reference: uuid.New().String(),
+		Reference: reference,
 	}
 }
 
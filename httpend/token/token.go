@@ -0,0 +1,93 @@
+// Package token is responsible for all endpoints on the /tokens resource, managing the logged in
+// user's API tokens
+package token
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/httpend/userauth"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// Handler is the object responsible for the /tokens endpoint
+type Handler struct {
+	group   *gin.RouterGroup
+	auther  userauth.Authenticator
+	userMan *userman.Manager
+}
+
+// New creates a new instance of the tokens handler
+func New(router gin.IRouter, auth userauth.Authenticator, userMan *userman.Manager) *Handler {
+	handl := &Handler{
+		group:   router.Group("tokens"),
+		auther:  auth,
+		userMan: userMan,
+	}
+
+	// Add the endpoints
+	handl.group.GET("", handl.ListTokens)
+	handl.group.PUT("", handl.CreateToken)
+	handl.group.DELETE(":tokenID", handl.RevokeToken)
+
+	return handl
+}
+
+// ListTokens returns the logged in user's API tokens
+func (h Handler) ListTokens(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	tokens, err := h.userMan.ListAPITokens(user)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// CreateToken creates a new API token for the logged in user
+func (h Handler) CreateToken(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := CreateTokenRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+	raw, created, err := h.userMan.CreateAPIToken(user, req.Name)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	reqlog.Logger(ctx).WithField("token_id", created.ID).Info("API token created")
+	ctx.JSON(http.StatusCreated, CreateTokenResponse{APIToken: created, Token: raw})
+}
+
+// RevokeToken deletes one of the logged in user's API tokens
+func (h Handler) RevokeToken(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	tokenID, err := strconv.ParseUint(ctx.Param("tokenID"), 10, 32)
+	if err != nil {
+		apierror.Abort(ctx, dataerror.ErrBadRequest("token ID is not an unsigned integer"))
+		return
+	}
+	if err := h.userMan.RevokeAPIToken(user, uint(tokenID)); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
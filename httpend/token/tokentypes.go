@@ -0,0 +1,9 @@
+package token
+
+import "github.com/wallnutkraken/groupplan/apitypes"
+
+// CreateTokenRequest is the JSON request object for creating a new API token
+type CreateTokenRequest = apitypes.CreateTokenRequest
+
+// CreateTokenResponse is the newly created API token. The token itself is never shown again.
+type CreateTokenResponse = apitypes.CreateTokenResponse
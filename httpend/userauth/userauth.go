@@ -7,6 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -17,17 +20,26 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/wallnutkraken/groupplan/config"
 	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/metrics"
 	"github.com/wallnutkraken/groupplan/userman"
 )
 
 const (
-	authCookie = "groupplan_jwt"
+	authCookie     = "groupplan_jwt"
+	returnToCookie = "groupplan_return_to"
+	returnToParam  = "return_to"
+	bearerPrefix   = "Bearer "
 )
 
+// authPrefixes are the paths the authentication endpoints are registered under, the unversioned
+// one and the one under /api/v1
+var authPrefixes = []string{"/auth", "/api/v1/auth"}
+
 // Handler is the object responsible for the /auth endpoint
 type Handler struct {
 	hostname  string
-	group     *gin.RouterGroup
+	settings  config.AppSettings
 	userMan   *userman.Manager
 	jwtSecret string //todo: memguard
 
@@ -37,6 +49,7 @@ type Handler struct {
 // Authenticator is the interface for objects that allow JWT authentication for other (non-sign in) endpoints
 type Authenticator interface {
 	GetJWT(ctx *gin.Context) (users.User, error)
+	IsAdmin(user users.User) bool
 }
 
 // GroupPlanClaims is the JWT authentication claims object for GroupPlan
@@ -59,44 +72,63 @@ func generateJWTSecret() string {
 	return base64.StdEncoding.EncodeToString(randBytes[:written])
 }
 
-// New creates a new instance of the authentication Handler
-func New(router *gin.Engine, userH *userman.Manager, cfg config.AppSettings) *Handler {
+// New creates a new instance of the authentication Handler, with its endpoints on the given router
+func New(router gin.IRouter, userH *userman.Manager, cfg config.AppSettings) *Handler {
 	handler := &Handler{
-		group:              router.Group("auth"),
 		userMan:            userH,
 		expireAfterSeconds: 3600 * 24,
 		hostname:           cfg.Hostname,
+		settings:           cfg,
 		jwtSecret:          generateJWTSecret(),
 	}
 	// Start the goth discord provider
-	goth.UseProviders(discord.New(cfg.DiscordKey, cfg.DiscordSecret, fmt.Sprintf("https://%s/auth/discord/callback", cfg.Hostname), discord.ScopeIdentify, discord.ScopeEmail))
-
-	// Auth group methods
-	handler.group.GET(":provider", handler.StartAuth)
-	handler.group.GET(":provider/callback", handler.AuthCallback)
+	goth.UseProviders(discord.New(cfg.DiscordKey, cfg.DiscordSecret, cfg.URL("/auth/discord/callback"), discord.ScopeIdentify, discord.ScopeEmail))
 
+	handler.Register(router)
 	return handler
 }
 
+// Register adds the authentication endpoints to another router, so they can be served under more
+// than one prefix
+func (h *Handler) Register(router gin.IRouter) {
+	group := router.Group("auth")
+	group.GET(":provider", h.StartAuth)
+	group.GET(":provider/callback", h.AuthCallback)
+}
+
 // StartAuth is the endpoint to begin the authentication process
 func (h Handler) StartAuth(ctx *gin.Context) {
 	// Add the discord provider to the context so that gothic knows what we're trying to authenticate with
 	req := gothic.GetContextWithProvider(ctx.Request, ctx.Param("provider"))
 
+	// Remember where the user wanted to go, so the callback can send them back there.
+	// Anything that doesn't pass validation is dropped, and the user lands on the index.
+	if returnTo := h.sanitizeReturnTo(ctx.Query(returnToParam)); returnTo != "" {
+		ctx.SetCookie(returnToCookie, returnTo, 600, "/auth", h.hostname, h.settings.SecureCookies(), true)
+	}
+
 	// First, try to get the user without re-authenticating
 	if user, err := gothic.CompleteUserAuth(ctx.Writer, req); err == nil {
-		fmt.Printf("%+v\n", user)
+		reqlog.Logger(ctx).WithField("provider", user.Provider).Info("User already authenticated with provider")
 	} else {
 		gothic.BeginAuthHandler(ctx.Writer, req)
 	}
 }
 
-// GetJWT takes the request context and returns a parsed claim object if the authentication is valid
+// GetJWT takes the request context and returns the authenticated user if the session token, or
+// API token, is valid
 func (h Handler) GetJWT(ctx *gin.Context) (users.User, error) {
-	jwtRaw, err := ctx.Cookie(authCookie)
+	jwtRaw, err := rawToken(ctx)
 	if err != nil {
-		// ErrNoCookie
-		return users.User{}, fmt.Errorf("no authentication cookie: %w", err)
+		return users.User{}, err
+	}
+	if strings.HasPrefix(jwtRaw, userman.APITokenPrefix) {
+		user, err := h.userMan.AuthenticateAPIToken(jwtRaw)
+		if err != nil {
+			return user, err
+		}
+		reqlog.SetUserID(ctx, user.ID)
+		return user, nil
 	}
 	cl := GroupPlanClaims{}
 	parsed, err := jwt.ParseWithClaims(jwtRaw, &cl, func(token *jwt.Token) (interface{}, error) {
@@ -113,7 +145,34 @@ func (h Handler) GetJWT(ctx *gin.Context) (users.User, error) {
 	}
 
 	// Get the user data from the database about this user
-	return h.userMan.GetAuthenticatedUser(cl.Email)
+	user, err := h.userMan.GetAuthenticatedUser(cl.Email)
+	if err != nil {
+		return user, err
+	}
+	reqlog.SetUserID(ctx, user.ID)
+	return user, nil
+}
+
+// rawToken returns the token from the Authorization header, for API clients, or from the
+// session cookie set after logging in through the browser
+func rawToken(ctx *gin.Context) (string, error) {
+	if header := ctx.GetHeader("Authorization"); header != "" {
+		if !strings.HasPrefix(header, bearerPrefix) {
+			return "", errors.New("authorization header is not a bearer token")
+		}
+		return strings.TrimPrefix(header, bearerPrefix), nil
+	}
+	jwtRaw, err := ctx.Cookie(authCookie)
+	if err != nil {
+		// ErrNoCookie
+		return "", fmt.Errorf("no authentication cookie: %w", err)
+	}
+	return jwtRaw, nil
+}
+
+// IsAdmin returns whether the given (authenticated) user has the admin capability
+func (h Handler) IsAdmin(user users.User) bool {
+	return h.userMan.IsAdmin(user)
 }
 
 // AuthCallback is the HTTP endpoint for the Discord authorization callback
@@ -123,7 +182,8 @@ func (h Handler) AuthCallback(ctx *gin.Context) {
 
 	user, err := gothic.CompleteUserAuth(ctx.Writer, req)
 	if err != nil {
-		logrus.WithError(err).Error("Failed completing user authentication")
+		reqlog.Logger(ctx).WithError(err).WithField("provider", provider).Error("Failed completing user authentication")
+		metrics.LoginAttempts.WithLabelValues(provider, metrics.LoginFailure).Inc()
 		ctx.AbortWithStatus(http.StatusInternalServerError) // todo error here
 		return
 	}
@@ -140,7 +200,8 @@ func (h Handler) AuthCallback(ctx *gin.Context) {
 	// Sign the token
 	signed, err := token.SignedString([]byte(h.jwtSecret))
 	if err != nil {
-		logrus.WithError(err).Error("Failed signing JWT")
+		reqlog.Logger(ctx).WithError(err).Error("Failed signing JWT")
+		metrics.LoginAttempts.WithLabelValues(provider, metrics.LoginFailure).Inc()
 		ctx.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -148,14 +209,68 @@ func (h Handler) AuthCallback(ctx *gin.Context) {
 	// Create user info. We don't actually care about the returned object here, because err being nil
 	// guarantees we actually created the user
 	_, err = h.userMan.Authenticate(user.Email, user.AvatarURL, provider, user.UserID, user.Name)
+	if errors.Is(err, userman.ErrDisabled) {
+		metrics.LoginAttempts.WithLabelValues(provider, metrics.LoginFailure).Inc()
+		ctx.String(http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		// Aight, err wasn't nil
-		logrus.WithError(err).Errorf("Failed saving/getting user after authentication with email [%s] and provider [%s]", user.Email, provider)
+		reqlog.Logger(ctx).WithError(err).WithFields(logrus.Fields{
+			"email":    user.Email,
+			"provider": provider,
+		}).Error("Failed saving/getting user after authentication")
+		metrics.LoginAttempts.WithLabelValues(provider, metrics.LoginFailure).Inc()
 		ctx.AbortWithStatus(http.StatusInternalServerError) // Todo: errorpage
 		return
 	}
 
-	ctx.SetCookie(authCookie, signed, int(h.expireAfterSeconds), "", h.hostname, true, false)
+	metrics.LoginAttempts.WithLabelValues(provider, metrics.LoginSuccess).Inc()
+	ctx.SetCookie(authCookie, signed, int(h.expireAfterSeconds), "", h.hostname, h.settings.SecureCookies(), false)
+
+	// Send the user back to where they were before logging in, if we know (and trust) that
+	returnTo := "/"
+	if cookie, err := ctx.Cookie(returnToCookie); err == nil {
+		if sanitized := h.sanitizeReturnTo(cookie); sanitized != "" {
+			returnTo = sanitized
+		}
+		ctx.SetCookie(returnToCookie, "", -1, "/auth", h.hostname, h.settings.SecureCookies(), true)
+	}
+	ctx.Redirect(http.StatusFound, h.settings.URL(returnTo))
+}
+
+// sanitizeReturnTo validates a post-login return location, returning it as a path (with query) relative
+// to the base URL. Only local paths and absolute URLs pointing at our own base URL are allowed, anything
+// else (other hosts, protocol-relative URLs, the auth endpoints themselves) returns an empty string.
+func (h Handler) sanitizeReturnTo(raw string) string {
+	if raw == "" || strings.ContainsAny(raw, "\\\r\n") {
+		return ""
+	}
+	target, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if target.IsAbs() || target.Host != "" {
+		// Absolute URLs are fine, as long as they point at us
+		base, err := h.settings.Base()
+		if err != nil || target.Scheme != base.Scheme || target.Host != base.Host || !strings.HasPrefix(target.Path, base.Path+"/") {
+			return ""
+		}
+		target.Path = strings.TrimPrefix(target.Path, base.Path)
+	} else if !strings.HasPrefix(target.Path, "/") || strings.HasPrefix(raw, "//") {
+		return ""
+	}
+	// Don't bounce the user straight back into the login flow, under any prefix it's served at
+	cleaned := path.Clean(target.Path)
+	for _, prefix := range authPrefixes {
+		if cleaned == prefix || strings.HasPrefix(cleaned, prefix+"/") {
+			return ""
+		}
+	}
 
-	ctx.Redirect(http.StatusFound, "https://fastvote.online")
+	returnTo := target.EscapedPath()
+	if target.RawQuery != "" {
+		returnTo += "?" + target.RawQuery
+	}
+	return returnTo
 }
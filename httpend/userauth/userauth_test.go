@@ -0,0 +1,41 @@
+package userauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/config"
+)
+
+func TestSanitizeReturnTo_LocalPath_Kept(t *testing.T) {
+	that := assert.New(t)
+	h := Handler{settings: config.AppSettings{BaseURL: "https://plan.example.com"}}
+
+	that.Equal("/plans/abc?view=grid", h.sanitizeReturnTo("/plans/abc?view=grid"))
+}
+
+func TestSanitizeReturnTo_OwnAbsoluteURL_Relativized(t *testing.T) {
+	that := assert.New(t)
+	h := Handler{settings: config.AppSettings{BaseURL: "https://plan.example.com/app/"}}
+
+	that.Equal("/plans/abc", h.sanitizeReturnTo("https://plan.example.com/app/plans/abc"))
+}
+
+func TestSanitizeReturnTo_ForeignOrUnsafe_Dropped(t *testing.T) {
+	that := assert.New(t)
+	h := Handler{settings: config.AppSettings{BaseURL: "https://plan.example.com"}}
+
+	for _, raw := range []string{
+		"https://evil.example.com/plans/abc",
+		"http://plan.example.com/plans/abc",
+		"//evil.example.com",
+		"/\\evil.example.com",
+		"plans/abc",
+		"javascript:alert(1)",
+		"/auth/discord",
+		"/api/v1/auth/discord",
+		"/plans/../auth/discord",
+	} {
+		that.Empty(h.sanitizeReturnTo(raw), "return_to [%s] should have been rejected", raw)
+	}
+}
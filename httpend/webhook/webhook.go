@@ -0,0 +1,121 @@
+// Package webhook is responsible for all endpoints on the /plans/:identifier/webhooks resource,
+// letting plan owners manage the webhooks of their plans
+package webhook
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/hookman"
+	"github.com/wallnutkraken/groupplan/httpend/apierror"
+	"github.com/wallnutkraken/groupplan/httpend/reqlog"
+	"github.com/wallnutkraken/groupplan/httpend/userauth"
+)
+
+// Handler is the object responsible for the /plans/:identifier/webhooks endpoint
+type Handler struct {
+	group  *gin.RouterGroup
+	auther userauth.Authenticator
+	hooks  *hookman.Manager
+}
+
+// New creates a new instance of the webhooks handler
+func New(router gin.IRouter, auth userauth.Authenticator, hooks *hookman.Manager) *Handler {
+	handl := &Handler{
+		group:  router.Group("plans/:identifier/webhooks"),
+		auther: auth,
+		hooks:  hooks,
+	}
+
+	// Add the endpoints
+	handl.group.GET("", handl.ListWebhooks)
+	handl.group.PUT("", handl.CreateWebhook)
+	handl.group.DELETE(":webhookID", handl.DeleteWebhook)
+	handl.group.GET(":webhookID/deliveries", handl.ListDeliveries)
+
+	return handl
+}
+
+// ListWebhooks returns the webhooks of a plan owned by the logged in user
+func (h Handler) ListWebhooks(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	hooks, err := h.hooks.ListWebhooks(ctx.Param("identifier"), user)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, hooks)
+}
+
+// CreateWebhook registers a webhook on a plan owned by the logged in user
+func (h Handler) CreateWebhook(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	req := CreateWebhookRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(ctx, apierror.Bind(err))
+		return
+	}
+	created, err := h.hooks.CreateWebhook(ctx.Param("identifier"), user, req.URL, req.Events)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	reqlog.Logger(ctx).WithField("webhook_id", created.ID).Info("Webhook created")
+	ctx.JSON(http.StatusCreated, created)
+}
+
+// DeleteWebhook deletes a webhook of a plan owned by the logged in user
+func (h Handler) DeleteWebhook(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	webhookID, err := strconv.ParseUint(ctx.Param("webhookID"), 10, 32)
+	if err != nil {
+		apierror.Abort(ctx, dataerror.ErrBadRequest("webhook ID is not an unsigned integer"))
+		return
+	}
+	if err := h.hooks.DeleteWebhook(ctx.Param("identifier"), user, uint(webhookID)); err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListDeliveries returns the latest deliveries to a webhook, newest first
+func (h Handler) ListDeliveries(ctx *gin.Context) {
+	user, err := h.auther.GetJWT(ctx)
+	if err != nil {
+		apierror.Abort(ctx, apierror.Unauthenticated(err))
+		return
+	}
+	webhookID, err := strconv.ParseUint(ctx.Param("webhookID"), 10, 32)
+	if err != nil {
+		apierror.Abort(ctx, dataerror.ErrBadRequest("webhook ID is not an unsigned integer"))
+		return
+	}
+	limit := 0
+	if raw := ctx.Query("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil {
+			apierror.Abort(ctx, dataerror.ErrField("limit", "limit must be a number"))
+			return
+		}
+	}
+	deliveries, err := h.hooks.ListDeliveries(ctx.Param("identifier"), user, uint(webhookID), limit)
+	if err != nil {
+		apierror.Abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, deliveries)
+}
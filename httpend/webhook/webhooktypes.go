@@ -0,0 +1,10 @@
+package webhook
+
+import "github.com/wallnutkraken/groupplan/events"
+
+// CreateWebhookRequest is the JSON request object for registering a webhook on a plan. Leaving out
+// the events sends all of them.
+type CreateWebhookRequest struct {
+	URL    string        `json:"url"`
+	Events []events.Type `json:"events"`
+}
@@ -0,0 +1,64 @@
+// Package lifecycle coordinates the orderly shutdown of the long-running parts of groupplan
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StopFunc stops a single component. It should return once the component has fully stopped,
+// or when the given context is done, whichever comes first.
+type StopFunc func(ctx context.Context) error
+
+// component is a single registered, named StopFunc
+type component struct {
+	name string
+	stop StopFunc
+}
+
+// Manager keeps track of every component that needs to be stopped on shutdown
+type Manager struct {
+	lock       sync.Mutex
+	components []component
+}
+
+// New creates a new, empty lifecycle Manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// Add registers a component to be stopped on shutdown. Components are stopped in the reverse
+// order of registration, so dependencies (e.g. the database) should be added before the
+// components that use them.
+func (m *Manager) Add(name string, stop StopFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Shutdown stops every registered component, last registered first. A failing component does not
+// prevent the rest from being stopped, all failures are returned together.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.lock.Lock()
+	components := m.components
+	m.components = nil
+	m.lock.Unlock()
+
+	failures := []string{}
+	for index := len(components) - 1; index >= 0; index-- {
+		current := components[index]
+		logrus.Infof("Stopping %s", current.name)
+		if err := current.stop(ctx); err != nil {
+			logrus.WithError(err).Errorf("Failed stopping %s", current.name)
+			failures = append(failures, fmt.Sprintf("%s: %s", current.name, err.Error()))
+		}
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("failed stopping components: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/mail"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/backup"
 	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/events"
 	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/hookman"
 	"github.com/wallnutkraken/groupplan/httpend"
+	"github.com/wallnutkraken/groupplan/httpend/notification"
+	"github.com/wallnutkraken/groupplan/lifecycle"
+	"github.com/wallnutkraken/groupplan/notifications"
+	"github.com/wallnutkraken/groupplan/planman"
 )
 
-// DBPath is the static path to the database file
-var DBPath = "groupplan.sqlite3"
-
 func main() {
+	devFrontend := flag.Bool("dev", false, "serve the frontend from the frontend directory on disk instead of the embedded copy")
+	flag.Parse()
+
 	// Load the config
 	cfg, err := config.Load()
 	if err != nil {
@@ -25,15 +40,157 @@ func main() {
 		fmt.Printf("Failed reading the config at [%s], new one created, please fill it out and launch the application again\n", config.ConfigPath)
 		os.Exit(1)
 	}
-	// Spin up the database, locally
-	db, err := groupdata.New(DBPath)
+	// Subcommands run instead of the server
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			fmt.Printf("Migration failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	case "backup":
+		if err := runBackup(cfg, flag.Args()[1:]); err != nil {
+			fmt.Printf("Backup failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	case "restore":
+		if err := runRestore(cfg, flag.Args()[1:]); err != nil {
+			fmt.Printf("Restore failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	case "admin":
+		if err := runAdmin(cfg, flag.Args()[1:]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	case "discord":
+		if err := runDiscord(cfg, flag.Args()[1:]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Printf("Unknown command [%s]\n", flag.Arg(0))
+		os.Exit(2)
+	}
+
+	// The server logs structured JSON, so log lines can be searched by request ID
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+
+	if *devFrontend && cfg.FrontendDir == "" {
+		cfg.FrontendDir = "frontend"
+	}
+	// Spin up the database
+	driver, dsn := cfg.Database()
+	db, err := groupdata.New(driver, dsn)
+	if err != nil {
+		fmt.Printf("Failed loading %s database: %s\n", driver, err.Error())
+		os.Exit(1)
+	}
+	// Everything registered here is stopped in reverse order on shutdown, so the HTTP
+	// endpoint stops first and the database last
+	life := lifecycle.New()
+	life.Add("database", func(ctx context.Context) error {
+		return db.Close()
+	})
+	// shutdown stops everything added to life so far, returning whether all of it stopped cleanly
+	shutdown := func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout())
+		defer cancel()
+		if err := life.Shutdown(ctx); err != nil {
+			fmt.Printf("Failed shutting down cleanly: %s\n", err.Error())
+			return false
+		}
+		return true
+	}
+
+	if dir, interval, keep := cfg.Backups(); interval > 0 {
+		scheduler := backup.NewScheduler(db, dir, interval, keep)
+		scheduler.Start()
+		life.Add("backup scheduler", scheduler.Stop)
+	}
+
+	// Changes to plans are published on the hub, for live updates and webhooks
+	hub := events.NewHub()
+	hooks := hookman.New(db.Webhooks(), db.Plans(), hookman.NewHTTPClient(cfg.WebhookAllowPrivateNetworks))
+	hooks.Start(hub)
+	life.Add("webhook deliveries", hooks.Stop)
+	// Plans close at their response deadline, with the events that causes published on the hub
+	closer := planman.NewCloser(planman.New(db.Plans(), hub), db.Jobs())
+	closer.Start()
+	life.Add("plan closing", closer.Stop)
+	announcer := discordbot.NewAnnouncer(planman.New(db.Plans(), hub), discordbot.NewHTTPClient(), cfg.URL("/"))
+	announcer.Start(hub)
+	life.Add("Discord announcements", announcer.Stop)
+	mailer, err := newMailer(cfg)
 	if err != nil {
-		fmt.Printf("Failed loading database at [%s]: %s", DBPath, err.Error())
+		fmt.Printf("Failed setting up notification emails: %s\n", err.Error())
+		shutdown()
+		os.Exit(1)
 	}
-	endpoint := httpend.New(cfg, db)
-	// Start listening
-	if err := endpoint.Start(); err != nil {
-		fmt.Printf("Error while listening: %s\n", err.Error())
+	preferences := notifications.NewPreferences(db.Users(), cfg.URL(httpend.APIPrefix+"/"+notification.UnsubscribePath))
+	notifier := notifications.New(db.Plans(), preferences, mailer, announcer, cfg.URL("/"))
+	notifier.Start(hub)
+	life.Add("notifications", notifier.Stop)
+	beforeDeadline, beforeStart := cfg.Reminders()
+	reminders := notifications.NewReminders(db.Jobs(), notifier, beforeDeadline, beforeStart)
+	reminders.Start()
+	life.Add("reminders", reminders.Stop)
+
+	endpoint, err := httpend.New(cfg, db, hub, hooks, preferences)
+	if err != nil {
+		fmt.Printf("Failed creating the HTTP endpoint: %s\n", err.Error())
+		shutdown()
 		os.Exit(1)
 	}
+	life.Add("HTTP endpoint", endpoint.Shutdown)
+
+	// Start listening in the background, so we can wait for a stop signal here
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- endpoint.Start()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	exitCode := 0
+	select {
+	case sig := <-signals:
+		logrus.Infof("Received %s, shutting down", sig)
+	case err := <-listenErr:
+		if err != nil {
+			fmt.Printf("Error while listening: %s\n", err.Error())
+			exitCode = 1
+		}
+	}
+	// Stop listening for signals, so a second one kills the process outright
+	signal.Stop(signals)
+
+	if !shutdown() {
+		exitCode = 1
+	}
+	os.Exit(exitCode)
+}
+
+// newMailer returns the Mailer notification emails are sent with, nil if emails aren't set up
+func newMailer(cfg config.AppSettings) (notifications.Mailer, error) {
+	if cfg.MailFrom == "" {
+		return nil, nil
+	}
+	from, err := mail.ParseAddress(cfg.MailFrom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MailFrom [%s]: %w", cfg.MailFrom, err)
+	}
+	switch {
+	case cfg.MailDir != "":
+		return notifications.NewDirMailer(cfg.MailDir, *from), nil
+	case cfg.SMTPHost != "":
+		return notifications.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, *from), nil
+	}
+	return nil, errors.New("MailFrom is set, but neither SMTPHost nor MailDir is")
 }
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// startedKey is the gorm instance key holding the time a statement started
+const startedKey = "metrics:started"
+
+// GormPlugin is a gorm plugin recording the latency of every database operation
+type GormPlugin struct{}
+
+// Name returns the name of the plugin, as required by gorm.Plugin
+func (GormPlugin) Name() string {
+	return "groupplan:metrics"
+}
+
+// Initialize registers timing callbacks around every gorm operation, as required by gorm.Plugin
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", db.Callback().Create().Before("gorm:create").Register, db.Callback().Create().After("gorm:create").Register},
+		{"query", db.Callback().Query().Before("gorm:query").Register, db.Callback().Query().After("gorm:query").Register},
+		{"update", db.Callback().Update().Before("gorm:update").Register, db.Callback().Update().After("gorm:update").Register},
+		{"delete", db.Callback().Delete().Before("gorm:delete").Register, db.Callback().Delete().After("gorm:delete").Register},
+		{"row", db.Callback().Row().Before("gorm:row").Register, db.Callback().Row().After("gorm:row").Register},
+		{"raw", db.Callback().Raw().Before("gorm:raw").Register, db.Callback().Raw().After("gorm:raw").Register},
+	}
+	for _, callback := range callbacks {
+		operation := callback.operation
+		if err := callback.before("metrics:before_"+operation, startTimer); err != nil {
+			return err
+		}
+		if err := callback.after("metrics:after_"+operation, func(tx *gorm.DB) {
+			observe(tx, operation)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startTimer remembers when the statement started
+func startTimer(tx *gorm.DB) {
+	tx.InstanceSet(startedKey, time.Now())
+}
+
+// observe records how long the statement took
+func observe(tx *gorm.DB, operation string) {
+	value, ok := tx.InstanceGet(startedKey)
+	if !ok {
+		return
+	}
+	started, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+	table := tx.Statement.Table
+	if table == "" {
+		table = "unknown"
+	}
+	dbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(started).Seconds())
+}
@@ -0,0 +1,110 @@
+// Package metrics collects groupplan's Prometheus metrics: HTTP traffic, domain events and
+// database latency, all exposed through Handler
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "groupplan"
+
+// Login results, used as the result label of LoginAttempts
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// PlansCreated counts successfully created plans
+	PlansCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "plans_created_total",
+		Help:      "Plans created.",
+	})
+	// EntriesAdded counts successfully added availability entries
+	EntriesAdded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entries_added_total",
+		Help:      "Availability entries added to plans.",
+	})
+	// LoginAttempts counts completed logins by provider and result (LoginSuccess or LoginFailure)
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Completed login attempts, by authentication provider and result.",
+	}, []string{"provider", "result"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries, by operation and table.",
+		Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		PlansCreated,
+		EntriesAdded,
+		LoginAttempts,
+		dbQueryDuration,
+	)
+}
+
+// Middleware records the count and latency of every request handled by the router, labelled with
+// the route pattern rather than the raw path to keep the number of series bounded
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(started).Seconds())
+	}
+}
+
+// Handler returns the handler serving every metric in the Prometheus text format. If token is not
+// empty, requests must carry it as a bearer token.
+func Handler(token string) gin.HandlerFunc {
+	promHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return func(ctx *gin.Context) {
+		if token != "" {
+			given := ctx.GetHeader("Authorization")
+			if subtle.ConstantTimeCompare([]byte(given), []byte("Bearer "+token)) != 1 {
+				ctx.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
+		promHandler.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/wallnutkraken/groupplan/config"
+	"github.com/wallnutkraken/groupplan/groupdata"
+)
+
+// runMigrate is the `groupplan migrate status|up|down [steps]` command, for inspecting and
+// changing the database schema version without starting the server
+func runMigrate(cfg config.AppSettings, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: groupplan migrate status|up|down [steps]")
+	}
+	// Open without migrating, that's what we're here to control
+	db, err := groupdata.Open(cfg.Database())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		current, err := migrator.Current()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Database schema version %d, latest known version %d\n\n", current, migrator.Latest())
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		if current > migrator.Latest() {
+			fmt.Fprintf(writer, "%d\t(unknown, applied by a newer groupplan)\t\n", current)
+		}
+		return writer.Flush()
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %d: %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database schema is already up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps [%s]", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %d: %s\n", migration.Version, migration.Name)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown migrate command [%s], use status, up or down", args[0])
+}
@@ -0,0 +1,140 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSMTPPort is the mail submission port, used when no port is configured
+const defaultSMTPPort = 587
+
+// Email is a single plain text email to a single recipient
+type Email struct {
+	To      mail.Address
+	Subject string
+	Body    string
+	// Unsubscribe, if set, is the link that unsubscribes the recipient with a single click
+	Unsubscribe string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(email Email) error
+}
+
+// SMTPMailer sends emails through an SMTP server, using STARTTLS whenever the server offers it
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from mail.Address
+}
+
+// NewSMTPMailer creates a Mailer sending from the given address through the SMTP server on host.
+// A port of 0 means the submission port, 587. Without a username, no login is attempted.
+func NewSMTPMailer(host string, port int, username, password string, from mail.Address) *SMTPMailer {
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	mailer := &SMTPMailer{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+	}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+// Send sends the email
+func (m *SMTPMailer) Send(email Email) error {
+	message, err := compose(m.from, email, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, m.auth, m.from.Address, []string{email.To.Address}, message); err != nil {
+		return fmt.Errorf("failed sending email through [%s]: %w", m.addr, err)
+	}
+	return nil
+}
+
+// DirMailer writes emails to files in a directory instead of sending them, so they can be looked
+// at during development. Every email is its own .eml file, which most mail clients can open.
+type DirMailer struct {
+	dir  string
+	from mail.Address
+}
+
+// NewDirMailer creates a Mailer writing emails from the given address to files in dir
+func NewDirMailer(dir string, from mail.Address) *DirMailer {
+	return &DirMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+// Send writes the email to a new file, named after the time it was written
+func (m *DirMailer) Send(email Email) error {
+	now := time.Now()
+	message, err := compose(m.from, email, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return fmt.Errorf("failed creating mail directory [%s]: %w", m.dir, err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed generating file name: %w", err)
+	}
+	path := filepath.Join(m.dir, now.UTC().Format("20060102-150405.000000000")+"-"+hex.EncodeToString(suffix)+".eml")
+	if err := ioutil.WriteFile(path, message, 0644); err != nil {
+		return fmt.Errorf("failed writing email to [%s]: %w", path, err)
+	}
+	return nil
+}
+
+// compose builds the full message of an email, headers included
+func compose(from mail.Address, email Email, now time.Time) ([]byte, error) {
+	if email.To.Address == "" {
+		return nil, fmt.Errorf("email [%s] has no recipient", email.Subject)
+	}
+	message := &bytes.Buffer{}
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", email.To.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", email.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	if email.Unsubscribe != "" {
+		// One-click unsubscribing from the mail client, as described in RFC 8058
+		headers = append(headers, [2]string{"List-Unsubscribe", "<" + email.Unsubscribe + ">"}, [2]string{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"})
+	}
+	for _, header := range headers {
+		fmt.Fprintf(message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	body := quotedprintable.NewWriter(message)
+	if _, err := body.Write([]byte(strings.ReplaceAll(email.Body, "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("failed encoding email body: %w", err)
+	}
+	if err := body.Close(); err != nil {
+		return nil, fmt.Errorf("failed encoding email body: %w", err)
+	}
+	return message.Bytes(), nil
+}
@@ -0,0 +1,356 @@
+// Package notifications lets people know about the plans they take part in, as plan events happen:
+// participants when a plan they joined is finalized or changed, and owners when someone new adds
+// their availability to their plan. Reminders are sent ahead of a plan's response deadline and its
+// final time. Everyone chooses how they hear about each of those, by email, on Discord, in a daily
+// digest or not at all. Notifications are sent in the background, retrying failures.
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/discordbot"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/planman"
+)
+
+const (
+	// queueSize is how many notifications can wait to be sent before new ones are dropped
+	queueSize = 256
+	// digestInterval is how long notifications are collected for, before a digest of them is sent
+	digestInterval = 24 * time.Hour
+	// digestCheckInterval is how often due digests are looked for
+	digestCheckInterval = time.Hour
+)
+
+// PlanData is the part of the plan persistence layer the Notifier needs, to find out who to notify
+type PlanData interface {
+	GetPlan(identifier string) (plans.Plan, error)
+	GetPlanIdentifier(planID uint) (string, error)
+}
+
+// DiscordPoster posts messages to Discord webhooks
+type DiscordPoster interface {
+	Post(webhookURL string, message discordbot.Message) error
+}
+
+// Notification is a single notification to a single user, before it's sent where they want it
+type Notification struct {
+	User  users.User
+	Event string
+	// Email is the notification as it's emailed, its subject doubles as its summary elsewhere
+	Email Email
+}
+
+// outgoing is a notification on its way to the channel it's sent through
+type outgoing struct {
+	channel string
+	email   Email
+	// summary and webhookURL are what's posted to Discord, and where
+	summary    string
+	webhookURL string
+}
+
+// Notifier turns plan events into notifications, and sends them
+type Notifier struct {
+	plans       PlanData
+	preferences *Preferences
+	mailer      Mailer
+	discord     DiscordPoster
+	link        string
+
+	queue chan outgoing
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// New creates a new Notifier sending emails with the given Mailer and Discord messages with the
+// given poster, linking them to the given URL of the application. Without a Mailer or a poster,
+// notifications meant for that channel are dropped.
+func New(plans PlanData, preferences *Preferences, mailer Mailer, discord DiscordPoster, link string) *Notifier {
+	return &Notifier{
+		plans:       plans,
+		preferences: preferences,
+		mailer:      mailer,
+		discord:     discord,
+		link:        link,
+		queue:       make(chan outgoing, queueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start starts notifying about the events published on the hub in the background
+func (n *Notifier) Start(hub *events.Hub) {
+	followed := hub.Follow(n.stop, func(lastID uint64) {
+		logrus.WithField("last_event_id", lastID).Warn("Some plan events were missed, their notifications are lost")
+	})
+	running := sync.WaitGroup{}
+	running.Add(2)
+	go func() {
+		defer running.Done()
+		n.listen(followed)
+	}()
+	go func() {
+		defer running.Done()
+		n.send()
+	}()
+	go func() {
+		running.Wait()
+		close(n.done)
+	}()
+}
+
+// Stop stops notifying, waiting for the notification being sent to finish or the context to be done.
+// Notifications still waiting to be sent are dropped, digests are kept for after a restart.
+func (n *Notifier) Stop(ctx context.Context) error {
+	close(n.stop)
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notifications did not stop in time: %w", ctx.Err())
+	}
+}
+
+// listen queues up the notifications for every event followed, and the digests once they're due,
+// until the Notifier is stopped
+func (n *Notifier) listen(followed <-chan events.Event) {
+	digests := time.NewTicker(digestCheckInterval)
+	defer digests.Stop()
+	for {
+		select {
+		case <-digests.C:
+			n.sendDigests(time.Now())
+		case event, open := <-followed:
+			if !open {
+				return
+			}
+			n.notify(event)
+		}
+	}
+}
+
+// notify sends the notifications about an event where their users want them
+func (n *Notifier) notify(event events.Event) {
+	log := logrus.WithFields(logrus.Fields{"plan": event.Plan, "event": event.Type})
+	notifications, err := n.Notifications(event)
+	if err != nil {
+		log.WithError(err).Warn("Failed building notifications")
+		return
+	}
+	for _, notification := range notifications {
+		if err := n.dispatch(notification); err != nil {
+			log.WithError(err).WithField("user_id", notification.User.ID).Warn("Failed sending a notification")
+		}
+	}
+}
+
+// dispatch sends a notification through the channel the user wants it on, or saves it for their
+// digest
+func (n *Notifier) dispatch(notification Notification) error {
+	preference, err := n.preferences.preference(notification.User, notification.Event)
+	if err != nil {
+		return err
+	}
+	if preference.Channel == ChannelNone {
+		return nil
+	}
+	if preference.Digest {
+		return n.preferences.users.AddDigestItem(&users.DigestItem{
+			UserID:  notification.User.ID,
+			Channel: preference.Channel,
+			Event:   notification.Event,
+			Summary: notification.Email.Subject,
+		})
+	}
+	return n.enqueue(notification.User, preference.Channel, notification.Email, notification.Email.Subject, notification.Event)
+}
+
+// enqueue queues up a message to the user on the given channel, the email or its summary depending
+// on the channel. Emails get a link unsubscribing from the kind of notification they are.
+func (n *Notifier) enqueue(user users.User, channel string, email Email, summary, event string) error {
+	message := outgoing{channel: channel, email: email, summary: summary}
+	switch {
+	case channel == ChannelDiscord && n.discord != nil && user.NotificationWebhookURL != "":
+		message.webhookURL = user.NotificationWebhookURL
+	case channel == ChannelEmail && n.mailer != nil && user.Email != "":
+		unsubscribe, err := n.preferences.UnsubscribeURL(user, event)
+		if err != nil {
+			return err
+		}
+		message.email.Unsubscribe = unsubscribe
+		stop := "emails like this one"
+		if event == UnsubscribeAll {
+			stop = "notifications from groupplan"
+		}
+		message.email.Body += "\n--\nTo stop getting " + stop + ", unsubscribe at " + unsubscribe + "\n"
+	default:
+		// There's no way to reach the user on the channel
+		return nil
+	}
+	select {
+	case n.queue <- message:
+		return nil
+	default:
+		return fmt.Errorf("too many notifications waiting to be sent")
+	}
+}
+
+// sendDigests sends the digests that are due, the ones of users whose oldest notification waiting
+// for it is older than the digest interval
+func (n *Notifier) sendDigests(now time.Time) {
+	userIDs, err := n.preferences.users.DueDigests(now.Add(-digestInterval))
+	if err != nil {
+		logrus.WithError(err).Error("Failed finding due digests")
+		return
+	}
+	for _, userID := range userIDs {
+		if err := n.sendDigest(userID); err != nil {
+			logrus.WithError(err).WithField("user_id", userID).Warn("Failed sending a digest")
+		}
+	}
+}
+
+// sendDigest sends the digest of a user, one per channel the notifications in it were meant for
+func (n *Notifier) sendDigest(userID uint) error {
+	user, err := n.preferences.users.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	items, err := n.preferences.users.ListDigestItems(userID)
+	if err != nil {
+		return err
+	}
+	summaries := map[string][]string{}
+	for _, item := range items {
+		summaries[item.Channel] = append(summaries[item.Channel], item.Summary)
+	}
+	for channel, channelSummaries := range summaries {
+		email, err := emailTo(user, templateDigest, messageData{Link: n.link, Items: channelSummaries})
+		if err != nil {
+			return err
+		}
+		summary := email.Subject + "\n- " + strings.Join(channelSummaries, "\n- ")
+		if err := n.enqueue(user, channel, email, summary, UnsubscribeAll); err != nil {
+			return err
+		}
+	}
+	return n.preferences.users.DeleteDigestItems(items)
+}
+
+// Notifications builds the notifications about a plan event, from the plan as it is now. Most
+// events aren't notified about, and give no notifications.
+func (n *Notifier) Notifications(event events.Event) ([]Notification, error) {
+	switch event.Type {
+	case events.PlanFinalized, events.PlanUpdated, events.EntryAdded:
+	default:
+		return nil, nil
+	}
+	plan, err := n.plans.GetPlan(event.Plan)
+	if err != nil {
+		return nil, err
+	}
+	data := messageData{
+		Plan:  plan.Title,
+		Owner: plan.Owner.DisplayName,
+		Link:  n.link,
+	}
+	if plan.Finalized() {
+		data.Start = time.Unix(plan.FinalStartUnix, 0)
+		data.End = time.Unix(plan.FinalStartUnix+plan.FinalDurationSeconds, 0)
+	}
+
+	switch event.Type {
+	case events.PlanFinalized:
+		return participantNotifications(plan, PlanFinalized, templateFinalized, data)
+	case events.PlanUpdated:
+		return participantNotifications(plan, PlanUpdated, templateUpdated, data)
+	}
+	entry, isEntry := event.Data.(planman.PlanEntry)
+	if !isEntry {
+		return nil, fmt.Errorf("unexpected %s event data %T", event.Type, event.Data)
+	}
+	participant, isNew := newParticipant(plan, entry.EntryID)
+	if !isNew {
+		return nil, nil
+	}
+	data.Name = participant.DisplayName
+	data.Participants = plan.Participants()
+	data.Quorum = plan.Quorum
+	email, err := emailTo(plan.Owner, templateParticipant, data)
+	if err != nil {
+		return nil, err
+	}
+	return []Notification{{User: plan.Owner, Event: NewParticipant, Email: email}}, nil
+}
+
+// participantNotifications builds a notification from the template for everyone who added their
+// availability to the plan, apart from the owner, who made the change
+func participantNotifications(plan plans.Plan, event, name string, data messageData) ([]Notification, error) {
+	notifications := []Notification{}
+	notified := map[uint]bool{plan.OwnerID: true}
+	for _, entry := range plan.Entries {
+		if notified[entry.UserID] {
+			continue
+		}
+		notified[entry.UserID] = true
+		email, err := emailTo(entry.User, name, data)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, Notification{User: entry.User, Event: event, Email: email})
+	}
+	return notifications, nil
+}
+
+// newParticipant returns who made the entry, and whether it's the first entry they made on the plan.
+// The plan's owner is never a new participant.
+func newParticipant(plan plans.Plan, entryID uint) (users.User, bool) {
+	var made *plans.PlanEntry
+	for index := range plan.Entries {
+		if plan.Entries[index].ID == entryID {
+			made = &plan.Entries[index]
+		}
+	}
+	// The entry may have been removed again already
+	if made == nil || made.UserID == plan.OwnerID {
+		return users.User{}, false
+	}
+	for _, entry := range plan.Entries {
+		if entry.UserID == made.UserID && entry.ID < made.ID {
+			return users.User{}, false
+		}
+	}
+	return made.User, true
+}
+
+// emailTo builds an email from the template to the given user
+func emailTo(user users.User, name string, data messageData) (Email, error) {
+	data.Recipient = user.DisplayName
+	subject, body, err := render(name, data)
+	if err != nil {
+		return Email{}, err
+	}
+	return Email{
+		To:      mail.Address{Name: user.DisplayName, Address: user.Email},
+		Subject: subject,
+		Body:    body,
+	}, nil
+}
+
+// discordMessage is the Discord version of a notification, its summary along with a link
+func discordMessage(summary, link string) discordbot.Message {
+	return discordbot.Message{
+		Username:        "groupplan",
+		Content:         summary + "\n" + link,
+		AllowedMentions: discordbot.AllowedMentions{Parse: []string{}},
+	}
+}
@@ -0,0 +1,256 @@
+package notifications_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/notifications"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// fakeMailer collects the emails sent with it
+type fakeMailer chan notifications.Email
+
+func (f fakeMailer) Send(email notifications.Email) error {
+	f <- email
+	return nil
+}
+
+// next waits for the next email sent
+func (f fakeMailer) next(t *testing.T) notifications.Email {
+	select {
+	case email := <-f:
+		return email
+	case <-time.After(3 * time.Second):
+		t.Fatal("no email was sent")
+		return notifications.Email{}
+	}
+}
+
+func TestNotifier_EmailsOwnersAndParticipants(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	accounts := userman.New(db.Users(), nil)
+	alice, err := accounts.Authenticate("alice@example.com", "", "discord", "1", "Alice")
+	require.NoError(t, err)
+	bob, err := accounts.Authenticate("bob@example.com", "", "discord", "2", "Bob")
+	require.NoError(t, err)
+
+	hub := events.NewHub()
+	mailer := fakeMailer(make(chan notifications.Email, 10))
+	preferences := notifications.NewPreferences(db.Users(), "https://groupplan.example.com/api/v1/notifications/unsubscribe")
+	notifier := notifications.New(db.Plans(), preferences, mailer, nil, "https://groupplan.example.com/")
+	notifier.Start(hub)
+	defer notifier.Stop(context.Background())
+
+	planner := planman.New(db.Plans(), hub)
+	plan, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, planman.PlanOptions{Quorum: 3})
+	require.NoError(t, err)
+	start := plan.FromDate.Add(20 * time.Hour).Unix()
+	_, err = planner.AddEntry(plan.Identifier, alice, start, 7200)
+	require.NoError(t, err)
+	_, err = planner.AddEntry(plan.Identifier, bob, start, 7200)
+	require.NoError(t, err)
+	joined := mailer.next(t)
+	that.Equal(mail.Address{Name: "Alice", Address: "alice@example.com"}, joined.To)
+	that.Equal("Bob added their availability to Game night", joined.Subject)
+	that.Contains(joined.Body, "That makes 2 people, and it needs 3 available at once.")
+
+	// Only someone's first entry is news to the owner
+	_, err = planner.AddEntry(plan.Identifier, bob, start+10800, 1800)
+	require.NoError(t, err)
+	_, err = planner.FinalizePlan(plan.Identifier, alice, start, 3600)
+	require.NoError(t, err)
+	final := mailer.next(t)
+	that.Equal("bob@example.com", final.To.Address)
+	that.Equal("Game night is happening on "+time.Unix(start, 0).UTC().Format("Monday 2 January 2006 at 15:04 UTC"), final.Subject)
+	that.Contains(final.Body, "https://groupplan.example.com/")
+	that.Contains(final.Unsubscribe, "https://groupplan.example.com/api/v1/notifications/unsubscribe?event=plan_finalized&signature=")
+	that.Contains(final.Body, final.Unsubscribe)
+	that.Len(mailer, 0)
+}
+
+func TestPreferences_DigestAndUnsubscribe(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	accounts := userman.New(db.Users(), nil)
+	alice, err := accounts.Authenticate("alice@example.com", "", "discord", "1", "Alice")
+	require.NoError(t, err)
+	bob, err := accounts.Authenticate("bob@example.com", "", "discord", "2", "Bob")
+	require.NoError(t, err)
+	preferences := notifications.NewPreferences(db.Users(), "https://groupplan.example.com/unsubscribe")
+
+	_, err = preferences.Set(alice, notifications.SettingsChange{Events: map[string]notifications.Preference{
+		notifications.NewParticipant: {Channel: notifications.ChannelDiscord},
+	}})
+	that.Error(err, "Discord notifications need a webhook")
+	settings, err := preferences.Set(alice, notifications.SettingsChange{Events: map[string]notifications.Preference{
+		notifications.NewParticipant: {Channel: notifications.ChannelEmail, Digest: true},
+	}})
+	require.NoError(t, err)
+	that.Equal(notifications.Preference{Channel: notifications.ChannelEmail}, settings.Events[notifications.PlanFinalized])
+
+	hub := events.NewHub()
+	mailer := fakeMailer(make(chan notifications.Email, 10))
+	notifier := notifications.New(db.Plans(), preferences, mailer, nil, "https://groupplan.example.com/")
+	notifier.Start(hub)
+	defer notifier.Stop(context.Background())
+	planner := planman.New(db.Plans(), hub)
+	plan, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, planman.PlanOptions{})
+	require.NoError(t, err)
+	_, err = planner.AddEntry(plan.Identifier, bob, plan.FromDate.Add(20*time.Hour).Unix(), 7200)
+	require.NoError(t, err)
+	// Saved for the digest, rather than emailed
+	require.Eventually(t, func() bool {
+		items, err := db.Users().ListDigestItems(alice.ID)
+		return err == nil && len(items) == 1 && items[0].Summary == "Bob added their availability to Game night"
+	}, 3*time.Second, 10*time.Millisecond)
+	that.Len(mailer, 0)
+
+	link, err := preferences.UnsubscribeURL(bob, notifications.UnsubscribeAll)
+	require.NoError(t, err)
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	query := parsed.Query()
+	that.Equal(strconv.FormatUint(uint64(bob.ID), 10), query.Get("user"))
+	that.Error(preferences.Unsubscribe(bob.ID, notifications.PlanFinalized, query.Get("signature")), "signed for a different event")
+	that.Error(preferences.Unsubscribe(alice.ID, notifications.UnsubscribeAll, query.Get("signature")), "signed for a different user")
+	require.NoError(t, preferences.Unsubscribe(bob.ID, notifications.UnsubscribeAll, query.Get("signature")))
+	bob, err = db.Users().GetUser(bob.ID)
+	require.NoError(t, err)
+	settings, err = preferences.Get(bob)
+	require.NoError(t, err)
+	for _, event := range notifications.Events {
+		that.Equal(notifications.ChannelNone, settings.Events[event].Channel)
+	}
+}
+
+func TestPreferences_Set_KeepsWebhookWhenLeftOut(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	alice, err := userman.New(db.Users(), nil).Authenticate("alice@example.com", "", "discord", "1", "Alice")
+	require.NoError(t, err)
+	preferences := notifications.NewPreferences(db.Users(), "https://groupplan.example.com/unsubscribe")
+	webhook := "https://discord.com/api/webhooks/1/abc"
+	_, err = preferences.Set(alice, notifications.SettingsChange{DiscordWebhookURL: &webhook, Events: map[string]notifications.Preference{
+		notifications.NewParticipant: {Channel: notifications.ChannelDiscord},
+	}})
+	require.NoError(t, err)
+
+	alice, err = db.Users().GetUser(alice.ID)
+	require.NoError(t, err)
+	settings, err := preferences.Set(alice, notifications.SettingsChange{Events: map[string]notifications.Preference{
+		notifications.PlanFinalized: {Channel: notifications.ChannelDiscord},
+	}})
+	require.NoError(t, err)
+	that.Equal(webhook, settings.DiscordWebhookURL)
+	alice, err = db.Users().GetUser(alice.ID)
+	require.NoError(t, err)
+	that.Equal(webhook, alice.NotificationWebhookURL)
+
+	removed := ""
+	_, err = preferences.Set(alice, notifications.SettingsChange{DiscordWebhookURL: &removed})
+	that.Error(err, "notifications are still sent to the webhook")
+}
+
+func TestDirMailer_WritesEmailFiles(t *testing.T) {
+	that := assert.New(t)
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := notifications.NewDirMailer(dir, mail.Address{Name: "groupplan", Address: "noreply@example.com"})
+	require.NoError(t, mailer.Send(notifications.Email{
+		To:      mail.Address{Name: "Bob", Address: "bob@example.com"},
+		Subject: "Spiel night\r\nBcc: everyone@example.com",
+		Body:    "Hi Bob,\n\nSee you there.\n",
+	}))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	message, err := mail.ReadMessage(bytes.NewReader(content))
+	require.NoError(t, err)
+	that.Equal(`"groupplan" <noreply@example.com>`, message.Header.Get("From"))
+	that.Equal(`"Bob" <bob@example.com>`, message.Header.Get("To"))
+	that.Empty(message.Header.Get("Bcc"), "the subject must not be able to add headers")
+	body, err := ioutil.ReadAll(message.Body)
+	require.NoError(t, err)
+	that.Equal("Hi Bob,\r\n\r\nSee you there.\r\n", string(body))
+}
+
+func TestReminders_DeadlineAndFinalTime(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	accounts := userman.New(db.Users(), nil)
+	alice, err := accounts.Authenticate("alice@example.com", "", "discord", "1", "Alice")
+	require.NoError(t, err)
+	bob, err := accounts.Authenticate("bob@example.com", "", "discord", "2", "Bob")
+	require.NoError(t, err)
+	carol, err := accounts.Authenticate("carol@example.com", "", "discord", "3", "Carol")
+	require.NoError(t, err)
+
+	hub := events.NewHub()
+	mailer := fakeMailer(make(chan notifications.Email, 10))
+	preferences := notifications.NewPreferences(db.Users(), "https://groupplan.example.com/api/v1/notifications/unsubscribe")
+	notifier := notifications.New(db.Plans(), preferences, mailer, nil, "https://groupplan.example.com/")
+	notifier.Start(hub)
+	defer notifier.Stop(context.Background())
+	planner := planman.New(db.Plans(), hub)
+	deadline := time.Now().Add(2 * time.Hour)
+	plan, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, planman.PlanOptions{ResponseDeadline: &deadline})
+	require.NoError(t, err)
+	_, err = planner.JoinPlan(plan.Identifier, bob)
+	require.NoError(t, err)
+	_, err = planner.JoinPlan(plan.Identifier, carol)
+	require.NoError(t, err)
+	_, err = planner.AddEntry(plan.Identifier, carol, plan.FromDate.Add(20*time.Hour).Unix(), 7200)
+	require.NoError(t, err)
+	that.Equal("Carol added their availability to Game night", mailer.next(t).Subject)
+
+	// Only Bob opened the plan without adding his availability
+	reminders := notifications.NewReminders(db.Jobs(), notifier, 24*time.Hour, 72*time.Hour)
+	reminders.Start()
+	email := mailer.next(t)
+	that.Equal("bob@example.com", email.To.Address)
+	that.Contains(email.Subject, "Add your availability to Game night before")
+	require.NoError(t, reminders.Stop(context.Background()))
+	that.Len(mailer, 0)
+
+	_, err = planner.FinalizePlan(plan.Identifier, alice, plan.FromDate.Add(20*time.Hour).Unix(), 3600)
+	require.NoError(t, err)
+	reminders = notifications.NewReminders(db.Jobs(), notifier, 24*time.Hour, 72*time.Hour)
+	reminders.Start()
+	defer reminders.Stop(context.Background())
+	// Carol is told it's finalized, then both her and Alice are reminded it's coming up
+	sent := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		email := mailer.next(t)
+		sent[email.To.Address+": "+strings.SplitN(email.Subject, " on ", 2)[0]] = true
+	}
+	that.Equal(map[string]bool{
+		"carol@example.com: Game night is happening":           true,
+		"carol@example.com: Reminder: Game night is happening": true,
+		"alice@example.com: Reminder: Game night is happening": true,
+	}, sent)
+}
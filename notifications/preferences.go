@@ -0,0 +1,230 @@
+package notifications
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/planman"
+	"github.com/wallnutkraken/groupplan/secid"
+)
+
+// The kinds of notification, each of which users can choose how to hear about
+const (
+	PlanFinalized  = "plan_finalized"
+	PlanUpdated    = "plan_updated"
+	NewParticipant = "new_participant"
+	// Reminder is about a plan's response deadline or start coming up
+	Reminder = "reminder"
+)
+
+// Events are every kind of notification
+var Events = []string{PlanFinalized, PlanUpdated, NewParticipant, Reminder}
+
+// UnsubscribeAll is the event of unsubscribe links turning off every kind of notification at once
+const UnsubscribeAll = "all"
+
+// The channels notifications can be sent through
+const (
+	ChannelEmail = "email"
+	// ChannelDiscord posts to a Discord webhook of the user's. Webhooks can't send direct messages,
+	// so it's usually one on a channel only the user can see.
+	ChannelDiscord = "discord"
+	ChannelNone    = "none"
+)
+
+// UserData is the part of the user persistence layer notifications need
+type UserData interface {
+	GetUser(id uint) (users.User, error)
+	GetNotificationPreferences(userID uint) ([]users.NotificationPreference, error)
+	SetNotificationPreferences(user *users.User, webhookURL string, preferences []users.NotificationPreference) error
+	SetNotificationKey(user *users.User, key string) error
+	AddDigestItem(item *users.DigestItem) error
+	DueDigests(before time.Time) ([]uint, error)
+	ListDigestItems(userID uint) ([]users.DigestItem, error)
+	DeleteDigestItems(items []users.DigestItem) error
+}
+
+// Preference is how a user wants to hear about one kind of notification
+type Preference struct {
+	Channel string `json:"channel"`
+	// Digest collects the notifications into one message a day, instead of sending each right away
+	Digest bool `json:"digest"`
+}
+
+// Settings are a user's notification preferences, for every kind of notification
+type Settings struct {
+	// DiscordWebhookURL is where notifications sent through the discord channel are posted
+	DiscordWebhookURL string                `json:"discord_webhook_url"`
+	Events            map[string]Preference `json:"events"`
+}
+
+// SettingsChange is a change to a user's notification preferences. Settings left out are left as
+// they are, an empty DiscordWebhookURL removes the webhook.
+type SettingsChange struct {
+	DiscordWebhookURL *string               `json:"discord_webhook_url,omitempty"`
+	Events            map[string]Preference `json:"events"`
+}
+
+// Preferences manages the notification preferences of users
+type Preferences struct {
+	users          UserData
+	unsubscribeURL string
+}
+
+// NewPreferences creates a new Preferences, for unsubscribe links pointing at the given URL
+func NewPreferences(users UserData, unsubscribeURL string) *Preferences {
+	return &Preferences{
+		users:          users,
+		unsubscribeURL: unsubscribeURL,
+	}
+}
+
+// Get returns the notification settings of a user. Notifications are emailed right away, unless
+// the user chose otherwise.
+func (p *Preferences) Get(user users.User) (Settings, error) {
+	stored, err := p.users.GetNotificationPreferences(user.ID)
+	if err != nil {
+		return Settings{}, err
+	}
+	settings := Settings{
+		DiscordWebhookURL: user.NotificationWebhookURL,
+		Events:            map[string]Preference{},
+	}
+	for _, event := range Events {
+		settings.Events[event] = Preference{Channel: ChannelEmail}
+	}
+	for _, preference := range stored {
+		if _, known := settings.Events[preference.Event]; known {
+			settings.Events[preference.Event] = Preference{Channel: preference.Channel, Digest: preference.Digest}
+		}
+	}
+	return settings, nil
+}
+
+// Set changes the notification settings of a user. Kinds of notification missing from the change,
+// and the Discord webhook if it's missing, are left as they are.
+func (p *Preferences) Set(user users.User, change SettingsChange) (Settings, error) {
+	current, err := p.Get(user)
+	if err != nil {
+		return Settings{}, err
+	}
+	webhookURL := current.DiscordWebhookURL
+	if change.DiscordWebhookURL != nil {
+		webhookURL = *change.DiscordWebhookURL
+		if webhookURL != "" {
+			if err := planman.ValidateDiscordWebhook("discord_webhook_url", webhookURL); err != nil {
+				return Settings{}, err
+			}
+		}
+	}
+	changed := []users.NotificationPreference{}
+	for event, preference := range change.Events {
+		if _, known := current.Events[event]; !known {
+			return Settings{}, dataerror.ErrField("events", fmt.Sprintf("unknown kind of notification [%s]", event))
+		}
+		switch preference.Channel {
+		case ChannelEmail, ChannelNone:
+		case ChannelDiscord:
+			if webhookURL == "" {
+				return Settings{}, dataerror.ErrField("discord_webhook_url", "a Discord webhook is needed to get notifications on Discord")
+			}
+		default:
+			return Settings{}, dataerror.ErrField("events", fmt.Sprintf("unknown channel [%s], it must be email, discord or none", preference.Channel))
+		}
+		changed = append(changed, users.NotificationPreference{Event: event, Channel: preference.Channel, Digest: preference.Digest})
+		current.Events[event] = preference
+	}
+	// Removing the webhook can't leave notifications going nowhere
+	if webhookURL == "" {
+		for event, preference := range current.Events {
+			if preference.Channel == ChannelDiscord {
+				return Settings{}, dataerror.ErrField("discord_webhook_url", fmt.Sprintf("%s notifications are sent to the Discord webhook", event))
+			}
+		}
+	}
+	if err := p.users.SetNotificationPreferences(&user, webhookURL, changed); err != nil {
+		return Settings{}, err
+	}
+	current.DiscordWebhookURL = webhookURL
+	return current, nil
+}
+
+// UnsubscribeURL returns the link that turns off a kind of notification, or every kind with
+// UnsubscribeAll, for the user without them having to log in. The first link made for a user
+// creates the key they're signed with.
+func (p *Preferences) UnsubscribeURL(user users.User, event string) (string, error) {
+	if user.NotificationKey == "" {
+		key, err := secid.String(32)
+		if err != nil {
+			return "", fmt.Errorf("failed creating notification key: %w", err)
+		}
+		if err := p.users.SetNotificationKey(&user, key); err != nil {
+			return "", err
+		}
+		user.NotificationKey = key
+	}
+	query := url.Values{}
+	query.Set("user", strconv.FormatUint(uint64(user.ID), 10))
+	query.Set("event", event)
+	query.Set("signature", unsubscribeSignature(user, event))
+	return p.unsubscribeURL + "?" + query.Encode(), nil
+}
+
+// CheckUnsubscribe returns an error if an unsubscribe link is not valid, without unsubscribing
+func (p *Preferences) CheckUnsubscribe(userID uint, event, signature string) error {
+	_, err := p.unsubscribing(userID, event, signature)
+	return err
+}
+
+// Unsubscribe turns off a kind of notification, or every kind with UnsubscribeAll, for the user
+// an unsubscribe link was made for
+func (p *Preferences) Unsubscribe(userID uint, event, signature string) error {
+	user, err := p.unsubscribing(userID, event, signature)
+	if err != nil {
+		return err
+	}
+	events := []string{event}
+	if event == UnsubscribeAll {
+		events = Events
+	}
+	turnedOff := []users.NotificationPreference{}
+	for _, off := range events {
+		turnedOff = append(turnedOff, users.NotificationPreference{Event: off, Channel: ChannelNone})
+	}
+	return p.users.SetNotificationPreferences(&user, user.NotificationWebhookURL, turnedOff)
+}
+
+// unsubscribing returns the user an unsubscribe link was made for, if it's valid
+func (p *Preferences) unsubscribing(userID uint, event, signature string) (users.User, error) {
+	user, err := p.users.GetUser(userID)
+	if err != nil {
+		return users.User{}, err
+	}
+	if user.NotificationKey == "" || !hmac.Equal([]byte(signature), []byte(unsubscribeSignature(user, event))) {
+		return users.User{}, dataerror.ErrForbidden("this unsubscribe link is not valid")
+	}
+	return user, nil
+}
+
+// unsubscribeSignature signs the unsubscribe link of a user for a kind of notification
+func unsubscribeSignature(user users.User, event string) string {
+	mac := hmac.New(sha256.New, []byte(user.NotificationKey))
+	fmt.Fprintf(mac, "unsubscribe:%d:%s", user.ID, event)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// preference returns how the user wants to hear about a kind of notification
+func (p *Preferences) preference(user users.User, event string) (Preference, error) {
+	settings, err := p.Get(user)
+	if err != nil {
+		return Preference{}, err
+	}
+	return settings.Events[event], nil
+}
@@ -0,0 +1,89 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/backoff"
+)
+
+const (
+	// maxAttempts is how many times a notification is sent before giving up on it
+	maxAttempts = 5
+)
+
+// retryBackoff is the wait between attempts, starting at 30 seconds and doubling up to 30 minutes
+var retryBackoff = backoff.Exponential{First: 30 * time.Second, Max: 30 * time.Minute}
+
+// pending is a notification waiting to be sent, either for the first time or again after failing
+type pending struct {
+	message  outgoing
+	attempts uint
+	next     time.Time
+}
+
+// send sends the queued up notifications, retrying the ones that fail, until the Notifier is stopped
+func (n *Notifier) send() {
+	waiting := []pending{}
+	for {
+		waiting = n.sendDue(waiting)
+		var retry <-chan time.Time
+		if len(waiting) > 0 {
+			next := waiting[0].next
+			for _, message := range waiting[1:] {
+				if message.next.Before(next) {
+					next = message.next
+				}
+			}
+			retry = time.After(time.Until(next))
+		}
+		select {
+		case <-n.stop:
+			if len(waiting) > 0 {
+				logrus.WithField("notifications", len(waiting)).Warn("Dropped notifications that were waiting to be sent again")
+			}
+			return
+		case message := <-n.queue:
+			waiting = append(waiting, pending{message: message, next: time.Now()})
+		case <-retry:
+		}
+	}
+}
+
+// sendDue makes an attempt at sending every notification that's due, returning the ones to try again
+func (n *Notifier) sendDue(waiting []pending) []pending {
+	left := waiting[:0]
+	for _, message := range waiting {
+		select {
+		case <-n.stop:
+			return append(left, message)
+		default:
+		}
+		if time.Now().Before(message.next) {
+			left = append(left, message)
+			continue
+		}
+		message.attempts++
+		err := n.deliver(message.message)
+		switch {
+		case err == nil:
+		case message.attempts >= maxAttempts:
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"channel": message.message.channel,
+				"subject": message.message.email.Subject,
+			}).Warn("Notification failed for good")
+		default:
+			message.next = time.Now().Add(retryBackoff.Delay(message.attempts))
+			left = append(left, message)
+		}
+	}
+	return left
+}
+
+// deliver makes a single attempt at sending a notification through its channel
+func (n *Notifier) deliver(message outgoing) error {
+	if message.channel == ChannelDiscord {
+		return n.discord.Post(message.webhookURL, discordMessage(message.summary, n.link))
+	}
+	return n.mailer.Send(message.email)
+}
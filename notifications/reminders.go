@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+)
+
+// Reminders sends the reminders scheduled on plans when they're due: to the members who haven't
+// added their availability before the response deadline, and to everyone taking part before the
+// plan's final time. They go through the Notifier, where their users want them. It's started and
+// stopped through its jobs.Runner.
+type Reminders struct {
+	*jobs.Runner
+	notifier *Notifier
+}
+
+// NewReminders creates Reminders sending through the notifier, the given time before the response
+// deadline and before the start of finalized plans
+func NewReminders(jobData jobs.RunnerData, notifier *Notifier, beforeDeadline, beforeStart time.Duration) *Reminders {
+	r := &Reminders{notifier: notifier}
+	r.Runner = jobs.NewRunner(jobData, "reminders", map[string]time.Duration{
+		jobs.KindDeadlineReminder: beforeDeadline,
+		jobs.KindEventReminder:    beforeStart,
+	}, r.send)
+	return r
+}
+
+// send sends the reminders of a job. Failing to find out who to remind is tried again on the next
+// check, failing to notify one of them isn't, so nobody's reminded twice.
+func (r *Reminders) send(job jobs.Job, now time.Time) error {
+	notifications, err := r.Notifications(job, now)
+	if err != nil {
+		return err
+	}
+	for _, notification := range notifications {
+		if err := r.notifier.dispatch(notification); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"job_id": job.ID, "user_id": notification.User.ID}).Warn("Failed sending a reminder")
+		}
+	}
+	return nil
+}
+
+// Notifications builds the reminders of a job, from the plan as it is now. A reminder about a
+// time that has already passed, or that's no longer the plan's, gives no notifications.
+func (r *Reminders) Notifications(job jobs.Job, now time.Time) ([]Notification, error) {
+	identifier, err := r.notifier.plans.GetPlanIdentifier(job.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := r.notifier.plans.GetPlan(identifier)
+	if err != nil {
+		return nil, err
+	}
+	data := messageData{
+		Plan:  plan.Title,
+		Owner: plan.Owner.DisplayName,
+		Link:  r.notifier.link,
+	}
+	if plan.Finalized() {
+		data.Start = time.Unix(plan.FinalStartUnix, 0)
+		data.End = time.Unix(plan.FinalStartUnix+plan.FinalDurationSeconds, 0)
+	}
+
+	switch job.Kind {
+	case jobs.KindDeadlineReminder:
+		// There's no use asking for availability once a time has been settled on
+		if plan.ResponseDeadline == nil || !plan.ResponseDeadline.Equal(job.TargetTime) || !now.Before(job.TargetTime) || plan.Finalized() {
+			return nil, nil
+		}
+		data.Deadline = *plan.ResponseDeadline
+		return reminderNotifications(plan.MembersWithoutEntries(), templateDeadline, data)
+	case jobs.KindEventReminder:
+		if !plan.Finalized() || !data.Start.Equal(job.TargetTime) || !now.Before(job.TargetTime) {
+			return nil, nil
+		}
+		return reminderNotifications(takingPart(plan), templateReminder, data)
+	}
+	return nil, fmt.Errorf("unknown kind of reminder [%s]", job.Kind)
+}
+
+// reminderNotifications builds a reminder from the template for each of the given users
+func reminderNotifications(recipients []users.User, name string, data messageData) ([]Notification, error) {
+	notifications := []Notification{}
+	for _, user := range recipients {
+		email, err := emailTo(user, name, data)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, Notification{User: user, Event: Reminder, Email: email})
+	}
+	return notifications, nil
+}
+
+// takingPart returns the owner of the plan, and everyone who added their availability to it
+func takingPart(plan plans.Plan) []users.User {
+	found := []users.User{plan.Owner}
+	seen := map[uint]bool{plan.OwnerID: true}
+	for _, entry := range plan.Entries {
+		if !seen[entry.UserID] {
+			seen[entry.UserID] = true
+			found = append(found, entry.User)
+		}
+	}
+	return found
+}
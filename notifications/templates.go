@@ -0,0 +1,75 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The templates, one per kind of email, each defining a "subject" and a "body"
+const (
+	templateFinalized   = "finalized.tmpl"
+	templateUpdated     = "updated.tmpl"
+	templateParticipant = "participant.tmpl"
+	templateDigest      = "digest.tmpl"
+	templateDeadline    = "deadline.tmpl"
+	templateReminder    = "reminder.tmpl"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// templates are parsed separately, as they all define the same names
+var templates = func() map[string]*template.Template {
+	funcs := template.FuncMap{
+		"when": func(at time.Time) string {
+			return at.UTC().Format("Monday 2 January 2006 at 15:04 UTC")
+		},
+	}
+	parsed := map[string]*template.Template{}
+	for _, name := range []string{templateFinalized, templateUpdated, templateParticipant, templateDigest, templateDeadline, templateReminder} {
+		parsed[name] = template.Must(template.New(name).Funcs(funcs).ParseFS(templateFiles, "templates/"+name))
+	}
+	return parsed
+}()
+
+// messageData is what the templates are filled in with
+type messageData struct {
+	// Recipient is the display name of who the email is to
+	Recipient string
+	Plan      string
+	Owner     string
+	Link      string
+	// Start and End are the final time of the plan, zero if it's not finalized
+	Start time.Time
+	End   time.Time
+	// Deadline is the response deadline of the plan, zero if it has none
+	Deadline time.Time
+	// Name, Participants and Quorum are about the new participant of a plan
+	Name         string
+	Participants int
+	Quorum       uint
+	// Items are the summaries of the notifications in a digest
+	Items []string
+}
+
+// render fills in a template, returning the email's subject and body
+func render(name string, data messageData) (subject, body string, err error) {
+	tmpl, exists := templates[name]
+	if !exists {
+		return "", "", fmt.Errorf("no email template [%s]", name)
+	}
+	out := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(out, "subject", data); err != nil {
+		return "", "", fmt.Errorf("failed rendering subject of [%s]: %w", name, err)
+	}
+	subject = strings.TrimSpace(out.String())
+	out.Reset()
+	if err := tmpl.ExecuteTemplate(out, "body", data); err != nil {
+		return "", "", fmt.Errorf("failed rendering body of [%s]: %w", name, err)
+	}
+	return subject, strings.TrimLeft(out.String(), "\n"), nil
+}
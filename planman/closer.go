@@ -0,0 +1,35 @@
+package planman
+
+import (
+	"time"
+
+	"github.com/wallnutkraken/groupplan/groupdata/jobs"
+)
+
+// Closer closes plans once their response deadline passes, finalizing the ones set to be finalized
+// automatically. Plans are also closed by the first change to their availability after the
+// deadline, whichever comes first. It's started and stopped through its jobs.Runner.
+type Closer struct {
+	*jobs.Runner
+	planner Planner
+}
+
+// NewCloser creates a Closer closing plans with the given Planner, as scheduled in jobData
+func NewCloser(planner Planner, jobData jobs.RunnerData) *Closer {
+	c := &Closer{planner: planner}
+	c.Runner = jobs.NewRunner(jobData, "closing plans", map[string]time.Duration{jobs.KindClosePlan: 0}, c.close)
+	return c
+}
+
+// close closes the plan of a job
+func (c *Closer) close(job jobs.Job, now time.Time) error {
+	identifier, err := c.planner.data.GetPlanIdentifier(job.PlanID)
+	if err != nil {
+		return err
+	}
+	plan, err := c.planner.data.GetPlan(identifier)
+	if err != nil {
+		return err
+	}
+	return c.planner.closePlan(&plan, now)
+}
@@ -3,19 +3,31 @@ package planman
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/sirupsen/logrus"
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/events"
 	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
 
 	"github.com/wallnutkraken/groupplan/groupdata/plans"
 	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/metrics"
 	"github.com/wallnutkraken/groupplan/secid"
 	"github.com/wallnutkraken/groupplan/userman"
 )
 
 // Planner is responsible for plan operations with the data layer
 type Planner struct {
-	data PlanData
+	data   PlanData
+	events Publisher
+}
+
+// Publisher is where the Planner announces changes to plans, once they've been saved
+type Publisher interface {
+	Publish(plan string, eventType events.Type, data interface{}) events.Event
 }
 
 // PlanData is the interface for what methods the plan persistency layer should provide PlanMan
@@ -27,39 +39,86 @@ type PlanData interface {
 	GetPlansByUser(user users.User) ([]plans.Plan, error)
 	DeleteEntry(entryID uint) error
 	GetEntry(entryID uint) (entry plans.PlanEntry, err error)
+	GetPlanIdentifier(planID uint) (string, error)
 	GetEntriesOnPlanByUser(planID string, user users.User) ([]plans.PlanEntry, error)
+	ListPlans(offset, limit int) ([]plans.Plan, int64, error)
+	GetStats() (plans.PlanStats, error)
+	SetDiscordWebhook(plan *plans.Plan, webhookURL string) error
+	MarkQuorumReached(plan *plans.Plan, at time.Time) (bool, error)
+	FinalizePlan(plan *plans.Plan, startUnix, durationSecs int64, at time.Time) error
+	SetResponseDeadline(plan *plans.Plan, deadline *time.Time, autoFinalize bool) error
+	MarkClosed(plan *plans.Plan, at time.Time) (bool, error)
+	AddMember(plan *plans.Plan, user users.User) error
+	SetRequirements(plan *plans.Plan, quorum uint, requiredMemberIDs []uint) error
+}
+
+// discordWebhookHosts are the hosts Discord webhook URLs can point at
+var discordWebhookHosts = []string{"discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com"}
+
+// PlanOptions are the optional settings of a new plan
+type PlanOptions struct {
+	// Quorum is how many people need to be available at once, 0 if it doesn't matter. Only times
+	// when at least this many are count as its best ones, and it's announced once there is one.
+	Quorum uint
+	// DiscordWebhookURL, if set, is where announcements about the plan are posted
+	DiscordWebhookURL string
+	// ResponseDeadline, if set, is when participants should have added their availability by.
+	// Those who haven't are reminded before it, and the plan closes once it passes.
+	ResponseDeadline *time.Time
+	// AutoFinalize finalizes the plan on its best time when it closes, it needs a ResponseDeadline
+	AutoFinalize bool
 }
 
-// New creates a new instance of the PlanMan Planner
-func New(db PlanData) Planner {
+// New creates a new instance of the PlanMan Planner, publishing changes to the given publisher
+func New(db PlanData, publisher Publisher) Planner {
 	return Planner{
-		data: db,
+		data:   db,
+		events: publisher,
 	}
 }
 
 // NewPlan creates a new plan, owned by the given User
 // The caller should call errors.Is on the error returned from this function to check if it's
 // a dataerror.ValidationErrors error
-func (p Planner) NewPlan(title string, fromDate time.Time, durationDays uint, owner users.User) (GroupPlan, error) {
+func (p Planner) NewPlan(title string, fromDate time.Time, durationDays, minAvailabilitySecs uint, owner users.User, options PlanOptions) (GroupPlan, error) {
+	if options.DiscordWebhookURL != "" {
+		if err := ValidateDiscordWebhook("discord_webhook_url", options.DiscordWebhookURL); err != nil {
+			return GroupPlan{}, err
+		}
+	}
 	identifier, err := secid.String(16)
 	if err != nil {
 		return GroupPlan{}, fmt.Errorf("failed creating secure identifier: %w", err)
 	}
 	plan := plans.Plan{
-		Owner:        owner,
-		OwnerID:      owner.ID,
-		Identifier:   identifier,
-		Title:        title,
-		FromDate:     fromDate,
-		DurationDays: durationDays,
+		Owner:                      owner,
+		OwnerID:                    owner.ID,
+		Identifier:                 identifier,
+		Title:                      title,
+		FromDate:                   fromDate,
+		DurationDays:               durationDays,
+		MinimumAvailabilitySeconds: minAvailabilitySecs,
+		Quorum:                     options.Quorum,
+		DiscordWebhookURL:          options.DiscordWebhookURL,
+		ResponseDeadline:           options.ResponseDeadline,
+		AutoFinalize:               options.AutoFinalize,
+	}
+	if options.AutoFinalize && options.ResponseDeadline == nil {
+		return GroupPlan{}, dataerror.ErrField("auto_finalize", "only plans with a response deadline can be finalized automatically")
+	}
+	if options.ResponseDeadline != nil {
+		if err := validateResponseDeadline("response_deadline_unix", *options.ResponseDeadline, plan); err != nil {
+			return GroupPlan{}, err
+		}
 	}
 	if err := p.data.CreatePlan(&plan); err != nil {
 		return GroupPlan{}, fmt.Errorf("failed creating the plan in the database: %w", err)
 	}
+	metrics.PlansCreated.Inc()
 
 	// Take the newly-saved plan object and turn it into the local GroupPlan one
-	groupPlan := GroupPlan{}
-	groupPlan.FillFromDataType(plan)
+	groupPlan := groupPlanFromData(plan)
+	p.events.Publish(plan.Identifier, events.PlanCreated, groupPlan)
 
 	// And return it with no error
 	return groupPlan, nil
@@ -75,9 +134,7 @@ func (p Planner) GetPlans(user users.User) ([]GroupPlan, error) {
 	// Change the data types into GroupPlans
 	groupPlans := make([]GroupPlan, len(plans))
 	for index, plan := range plans {
-		current := GroupPlan{}
-		current.FillFromDataType(plan)
-		groupPlans[index] = current
+		groupPlans[index] = groupPlanFromData(plan)
 	}
 
 	return groupPlans, nil
@@ -93,9 +150,7 @@ func (p Planner) GetEntriesOnPlanByUser(planIdentifier string, user users.User)
 	// Convert the entries into PlanEntry
 	converted := make([]PlanEntry, len(entries))
 	for index, entry := range entries {
-		conv := PlanEntry{}
-		conv.FillFromDataType(entry)
-		converted[index] = conv
+		converted[index] = planEntryFromData(entry)
 	}
 	return converted, nil
 }
@@ -107,23 +162,243 @@ func (p Planner) AddEntry(planIdentifier string, user users.User, startAtUnix, d
 	if err != nil {
 		return PlanEntry{}, fmt.Errorf("no plan: %w", err)
 	}
+	if err := p.checkOpen(&plan); err != nil {
+		return PlanEntry{}, err
+	}
 	// Check that the duration is longer than the plan's minimum availability
 	if plan.MinimumAvailabilitySeconds > uint(duration) {
-		return PlanEntry{}, dataerror.ErrBasic(fmt.Sprintf("Entry duration cannot be shorter than the plan's (%d)", plan.MinimumAvailabilitySeconds))
+		return PlanEntry{}, dataerror.ErrField("duration_seconds", fmt.Sprintf("Entry duration cannot be shorter than the plan's (%d)", plan.MinimumAvailabilitySeconds))
 	}
 
 	createdEntry, err := p.data.AddEntry(&plan, user, startAtUnix, duration)
 	if err != nil {
 		return PlanEntry{}, fmt.Errorf("failed saving entry: %w", err)
 	}
+	metrics.EntriesAdded.Inc()
 
 	// Now just convert createdEntry to PlanEntry
-	finalEntry := PlanEntry{}
-	finalEntry.FillFromDataType(createdEntry)
+	finalEntry := planEntryFromData(createdEntry)
+	p.events.Publish(plan.Identifier, events.EntryAdded, finalEntry)
+	p.checkQuorum(&plan)
 
 	return finalEntry, nil
 }
 
+// checkOpen returns an error if the plan's response deadline has passed, closing the plan if that
+// hasn't happened yet
+func (p Planner) checkOpen(plan *plans.Plan) error {
+	now := time.Now()
+	if !plan.Closed(now) {
+		return nil
+	}
+	if err := p.closePlan(plan, now); err != nil {
+		logrus.WithError(err).WithField("plan", plan.Identifier).Error("Failed closing a plan past its response deadline")
+	}
+	return dataerror.ErrConflict("the response deadline of this plan has passed, availability can no longer be changed")
+}
+
+// closePlan closes a plan past its response deadline, announcing it and finalizing it on its best
+// time if it's set to. A plan is only closed once, closing it again does nothing.
+func (p Planner) closePlan(plan *plans.Plan, now time.Time) error {
+	// The deadline may have been moved or removed since the closing was scheduled
+	if plan.ResponseDeadline == nil || now.Before(*plan.ResponseDeadline) {
+		return nil
+	}
+	closed, err := p.data.MarkClosed(plan, now)
+	if err != nil || !closed {
+		return err
+	}
+	p.events.Publish(plan.Identifier, events.PlanClosed, PlanClosedEvent{ClosedAt: now})
+	if !plan.AutoFinalize || plan.Finalized() {
+		return nil
+	}
+	best := bestSlots(*plan, 1)
+	if len(best) == 0 {
+		logrus.WithField("plan", plan.Identifier).Info("Plan closed without any availability, so it wasn't finalized")
+		return nil
+	}
+	_, err = p.finalize(plan, best[0].StartAtUnix, best[0].DurationSeconds)
+	return err
+}
+
+// checkQuorum announces the plan reaching its quorum, the first time there's a slot where enough
+// people, the required members among them, are available at once for long enough. The change that
+// got it there is already saved, so failing here is only logged.
+func (p Planner) checkQuorum(plan *plans.Plan) {
+	if plan.Quorum == 0 || plan.QuorumReachedAt != nil {
+		return
+	}
+	best := bestSlots(*plan, 1)
+	if len(best) == 0 {
+		return
+	}
+	reached, err := p.data.MarkQuorumReached(plan, time.Now())
+	if err != nil {
+		logrus.WithError(err).WithField("plan", plan.Identifier).Error("Failed recording that a plan reached its quorum")
+		return
+	}
+	if reached {
+		p.events.Publish(plan.Identifier, events.QuorumReached, QuorumReachedEvent{
+			Quorum:       plan.Quorum,
+			Participants: uint(plan.Participants()),
+			Available:    uint(len(best[0].Users)),
+		})
+	}
+}
+
+// FinalizePlan settles a plan owned by the user on the given time. A finalized plan can be
+// finalized again, to move it to a different time.
+func (p Planner) FinalizePlan(identifier string, user users.User, startAtUnix, duration int64) (FinalTime, error) {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return FinalTime{}, fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	if plan.OwnerID != user.ID {
+		return FinalTime{}, dataerror.ErrForbidden("only the owner of a plan can finalize it")
+	}
+	if duration <= 0 {
+		return FinalTime{}, dataerror.ErrField("duration_seconds", "the duration must be positive")
+	}
+	if time.Unix(startAtUnix, 0).Before(plan.FromDateZeroHour()) {
+		return FinalTime{}, dataerror.ErrField("start_time_unix", "the final time cannot be before the plan start date")
+	}
+	if time.Unix(startAtUnix+duration, 0).After(plan.EndDate()) {
+		return FinalTime{}, dataerror.ErrField("duration_seconds", "the final time cannot end after the plan ends")
+	}
+	return p.finalize(&plan, startAtUnix, duration)
+}
+
+// finalize settles a plan on a time that has been checked already, and announces it
+func (p Planner) finalize(plan *plans.Plan, startAtUnix, duration int64) (FinalTime, error) {
+	now := time.Now()
+	if err := p.data.FinalizePlan(plan, startAtUnix, duration, now); err != nil {
+		return FinalTime{}, err
+	}
+	final := FinalTime{
+		StartAtUnix:     startAtUnix,
+		DurationSeconds: duration,
+		FinalizedAt:     now,
+	}
+	p.events.Publish(plan.Identifier, events.PlanFinalized, final)
+	return final, nil
+}
+
+// SetDiscordWebhook sets the Discord webhook announcements about a plan owned by the user are
+// posted to. An empty URL stops the announcements.
+func (p Planner) SetDiscordWebhook(identifier string, user users.User, webhookURL string) error {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	if plan.OwnerID != user.ID {
+		return dataerror.ErrForbidden("only the owner of a plan can change its announcements")
+	}
+	if webhookURL != "" {
+		if err := ValidateDiscordWebhook("discord_webhook_url", webhookURL); err != nil {
+			return err
+		}
+	}
+	return p.data.SetDiscordWebhook(&plan, webhookURL)
+}
+
+// SetResponseDeadline sets when participants of a plan owned by the user should have added their
+// availability by, nil removing the deadline. Members who haven't are reminded before it, and the
+// plan closes once it passes, finalizing it on its best time if autoFinalize is set. Moving the
+// deadline of a closed plan opens it up again.
+func (p Planner) SetResponseDeadline(identifier string, user users.User, deadline *time.Time, autoFinalize bool) error {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	if plan.OwnerID != user.ID {
+		return dataerror.ErrForbidden("only the owner of a plan can change its response deadline")
+	}
+	if deadline != nil {
+		if err := validateResponseDeadline("deadline_unix", *deadline, plan); err != nil {
+			return err
+		}
+	} else if autoFinalize {
+		return dataerror.ErrField("auto_finalize", "only plans with a response deadline can be finalized automatically")
+	}
+	if err := p.data.SetResponseDeadline(&plan, deadline, autoFinalize); err != nil {
+		return err
+	}
+	plan.ResponseDeadline = deadline
+	plan.AutoFinalize = autoFinalize
+	plan.ClosedAt = nil
+	updated := groupPlanFromData(plan)
+	p.events.Publish(plan.Identifier, events.PlanUpdated, updated)
+	return nil
+}
+
+// SetRequirements sets how many people a plan owned by the user needs available at once, 0 if it
+// doesn't care, and which of its members it can't happen without. Only times that meet both count
+// as the plan's best ones. Every member not in requiredMemberIDs stops being required.
+func (p Planner) SetRequirements(identifier string, user users.User, quorum uint, requiredMemberIDs []uint) error {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	if plan.OwnerID != user.ID {
+		return dataerror.ErrForbidden("only the owner of a plan can change who it needs")
+	}
+	members := map[uint]bool{}
+	for _, member := range plan.Members {
+		members[member.ID] = true
+	}
+	for _, memberID := range requiredMemberIDs {
+		if !members[memberID] {
+			return dataerror.ErrField("required_member_ids", fmt.Sprintf("[%d] is not a member of this plan", memberID))
+		}
+	}
+	if err := p.data.SetRequirements(&plan, quorum, requiredMemberIDs); err != nil {
+		return err
+	}
+	if plan, err = p.data.GetPlan(identifier); err != nil {
+		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	updated := groupPlanFromData(plan)
+	p.events.Publish(plan.Identifier, events.PlanUpdated, updated)
+	// A lower quorum may already be reached
+	p.checkQuorum(&plan)
+	return nil
+}
+
+// validateResponseDeadline checks that a response deadline of the plan is in the future, and not
+// after the plan ends, blaming the given field if not
+func validateResponseDeadline(field string, deadline time.Time, plan plans.Plan) error {
+	if !deadline.After(time.Now()) {
+		return dataerror.ErrField(field, "the response deadline must be in the future")
+	}
+	if deadline.After(plan.EndDate()) {
+		return dataerror.ErrField(field, "the response deadline cannot be after the plan ends")
+	}
+	return nil
+}
+
+// DiscordWebhook returns the Discord webhook URL announcements about a plan are posted to, empty if
+// there isn't one. It's a secret of the plan's owner, so it's not part of GroupPlan.
+func (p Planner) DiscordWebhook(identifier string) (string, error) {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return "", fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	return plan.DiscordWebhookURL, nil
+}
+
+// ValidateDiscordWebhook checks that a URL is a Discord webhook URL, blaming the given field if not
+func ValidateDiscordWebhook(field, webhookURL string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err == nil && parsed.Scheme == "https" && strings.HasPrefix(parsed.Path, "/api/webhooks/") {
+		for _, host := range discordWebhookHosts {
+			if parsed.Host == host {
+				return nil
+			}
+		}
+	}
+	return dataerror.ErrField(field, "the URL must be a Discord webhook URL, starting with https://discord.com/api/webhooks/")
+}
+
 // DeletePlan deletes a plan with the given identifier if the owner of the plan is the given user
 func (p Planner) DeletePlan(identifier string, user users.User) error {
 	// Get the plan to check the owner
@@ -132,11 +407,15 @@ func (p Planner) DeletePlan(identifier string, user users.User) error {
 		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
 	}
 	if plan.OwnerID != user.ID {
-		return dataerror.ErrUnauthorized("you are not the owner of this plan")
+		return dataerror.ErrForbidden("you are not the owner of this plan")
 	}
 
 	// This user is the owner of the plan, delete it
-	return p.data.DeletePlan(plan)
+	if err := p.data.DeletePlan(plan); err != nil {
+		return err
+	}
+	p.events.Publish(plan.Identifier, events.PlanDeleted, PlanDeletedEvent{Identifier: plan.Identifier})
+	return nil
 }
 
 // DeleteEntry deletes an availability entry inside a plan with the given entry ID, if the user
@@ -148,11 +427,26 @@ func (p Planner) DeleteEntry(entryID uint, user users.User) error {
 		return fmt.Errorf("could not get entry: %w", err)
 	}
 	if entry.UserID != user.ID {
-		return dataerror.ErrUnauthorized("you are not the owner of this entry")
+		return dataerror.ErrForbidden("you are not the owner of this entry")
+	}
+	identifier, err := p.data.GetPlanIdentifier(entry.PlanID)
+	if err != nil {
+		return fmt.Errorf("failed getting the plan of the entry: %w", err)
+	}
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	if err := p.checkOpen(&plan); err != nil {
+		return err
 	}
 
 	// User is the owner, delete it
-	return p.data.DeleteEntry(entry.ID)
+	if err := p.data.DeleteEntry(entry.ID); err != nil {
+		return err
+	}
+	p.events.Publish(identifier, events.EntryRemoved, EntryRemovedEvent{EntryID: entry.ID})
+	return nil
 }
 
 // GetPlan gets a plan from the data layer with the given identifier
@@ -162,33 +456,100 @@ func (p Planner) GetPlan(identifier string) (GroupPlan, error) {
 		return GroupPlan{}, fmt.Errorf("could not get plan with identifier [%s]: %w", identifier, err)
 	}
 	// Convert plan to GroupPlan
-	groupPlan := GroupPlan{}
-	groupPlan.FillFromDataType(plan)
+	groupPlan := groupPlanFromData(plan)
 
 	return groupPlan, nil
 }
 
-// GroupPlan represents a single plan
-type GroupPlan struct {
-	Owner               userman.User `json:"owner"`
-	Identifier          string       `json:"identifier"`
-	Title               string       `json:"title"`
-	FromDate            time.Time    `json:"from_date"`
-	DurationDays        uint         `json:"duration_days"`
-	MinAvailabilitySecs uint         `json:"min_availability_seconds"`
-	Entries             []PlanEntry  `json:"entries"`
+// JoinPlan makes the user a member of the plan, someone expected to add their availability to it,
+// who its owner can make required. Adding availability makes them one too, joining again changes
+// nothing.
+func (p Planner) JoinPlan(identifier string, user users.User) (GroupPlan, error) {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return GroupPlan{}, fmt.Errorf("could not get plan with identifier [%s]: %w", identifier, err)
+	}
+	if !plan.IsMember(user.ID) {
+		if err := p.data.AddMember(&plan, user); err != nil {
+			return GroupPlan{}, err
+		}
+		if plan, err = p.data.GetPlan(identifier); err != nil {
+			return GroupPlan{}, fmt.Errorf("could not get plan with identifier [%s]: %w", identifier, err)
+		}
+	}
+	return groupPlanFromData(plan), nil
+}
+
+// ListAllPlans returns a page of every plan, regardless of owner, along with the total number of plans.
+// Only meant for admins.
+func (p Planner) ListAllPlans(page, perPage int) ([]AdminPlan, int64, error) {
+	found, total, err := p.data.ListPlans((page-1)*perPage, perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	converted := make([]AdminPlan, len(found))
+	for index, plan := range found {
+		converted[index].FillFromDataType(plan)
+	}
+	return converted, total, nil
+}
+
+// ForceDeletePlan deletes a plan with the given identifier, regardless of who owns it. Only meant for admins.
+func (p Planner) ForceDeletePlan(identifier string) error {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	if err := p.data.DeletePlan(plan); err != nil {
+		return err
+	}
+	p.events.Publish(plan.Identifier, events.PlanDeleted, PlanDeletedEvent{Identifier: plan.Identifier})
+	return nil
+}
+
+// GetStats returns aggregate numbers about plans and entries
+func (p Planner) GetStats() (plans.PlanStats, error) {
+	return p.data.GetStats()
 }
 
+// GroupPlan represents a single plan
+type GroupPlan = apitypes.GroupPlan
+
+// FinalTime is the time a plan was settled on, it's also the payload of the events.PlanFinalized event
+type FinalTime = apitypes.FinalTime
+
 // PlanEntry contains the specifics of a single plan entry
-type PlanEntry struct {
-	EntryID         uint         `json:"entry_id"`
-	User            userman.User `json:"user"`
-	StartAtUnix     int64        `json:"start_at_unix"`
-	DurationSeconds int64        `json:"duration_seconds"`
+type PlanEntry = apitypes.PlanEntry
+
+// Member is someone who joined a plan
+type Member = apitypes.Member
+
+// EntryRemovedEvent is the payload of the events.EntryRemoved event
+type EntryRemovedEvent struct {
+	EntryID uint `json:"entry_id"`
+}
+
+// QuorumReachedEvent is the payload of the events.QuorumReached event
+type QuorumReachedEvent struct {
+	Quorum       uint `json:"quorum"`
+	Participants uint `json:"participants"`
+	// Available is how many people are available at once at the plan's best time
+	Available uint `json:"available"`
+}
+
+// PlanClosedEvent is the payload of the events.PlanClosed event
+type PlanClosedEvent struct {
+	ClosedAt time.Time `json:"closed_at"`
 }
 
-// FillFromDataType fills the GroupPlan object from the provided database type
-func (g *GroupPlan) FillFromDataType(plan plans.Plan) {
+// PlanDeletedEvent is the payload of the events.PlanDeleted event
+type PlanDeletedEvent struct {
+	Identifier string `json:"identifier"`
+}
+
+// groupPlanFromData converts the database type of a plan into a GroupPlan
+func groupPlanFromData(plan plans.Plan) GroupPlan {
+	g := GroupPlan{}
 	g.Owner = userman.User{
 		DisplayName: plan.Owner.DisplayName,
 		AvatarURL:   plan.Owner.ProfilePictureURL,
@@ -199,20 +560,73 @@ func (g *GroupPlan) FillFromDataType(plan plans.Plan) {
 	g.DurationDays = plan.DurationDays
 	g.Entries = make([]PlanEntry, len(plan.Entries))
 	g.MinAvailabilitySecs = plan.MinimumAvailabilitySeconds
+	g.Participants = plan.Participants()
+	g.Quorum = plan.Quorum
+	g.QuorumReached = plan.QuorumReachedAt != nil
+	g.QualifyingSlot = len(bestSlots(plan, 1)) != 0
+	g.Final = nil
+	if plan.Finalized() {
+		g.Final = &FinalTime{
+			StartAtUnix:     plan.FinalStartUnix,
+			DurationSeconds: plan.FinalDurationSeconds,
+			FinalizedAt:     *plan.FinalizedAt,
+		}
+	}
+	g.DiscordAnnouncements = plan.DiscordWebhookURL != ""
+	g.ResponseDeadline = plan.ResponseDeadline
+	g.Closed = plan.Closed(time.Now())
+	g.AutoFinalize = plan.AutoFinalize
+	responded := map[uint]bool{}
 	for index, entry := range plan.Entries {
-		fill := PlanEntry{}
-		fill.FillFromDataType(entry)
-		g.Entries[index] = fill
+		g.Entries[index] = planEntryFromData(entry)
+		responded[entry.UserID] = true
+	}
+	g.Members = make([]Member, len(plan.Members))
+	for index, member := range plan.Members {
+		g.Members[index] = Member{
+			MemberID: member.ID,
+			User: userman.User{
+				DisplayName: member.User.DisplayName,
+				AvatarURL:   member.User.ProfilePictureURL,
+			},
+			Required:  member.Required,
+			Responded: responded[member.UserID],
+		}
 	}
+	return g
 }
 
-// FillFromDataType fills the PlanEntry object from the provided database type
-func (p *PlanEntry) FillFromDataType(entry plans.PlanEntry) {
-	p.EntryID = entry.ID
-	p.User = userman.User{
-		DisplayName: entry.User.DisplayName,
-		AvatarURL:   entry.User.ProfilePictureURL,
+// planEntryFromData converts the database type of a plan entry into a PlanEntry
+func planEntryFromData(entry plans.PlanEntry) PlanEntry {
+	return PlanEntry{
+		EntryID: entry.ID,
+		User: userman.User{
+			DisplayName: entry.User.DisplayName,
+			AvatarURL:   entry.User.ProfilePictureURL,
+		},
+		StartAtUnix:     entry.StartTimeUnix,
+		DurationSeconds: entry.DurationSeconds,
 	}
-	p.StartAtUnix = entry.StartTimeUnix
-	p.DurationSeconds = entry.DurationSeconds
+}
+
+// AdminPlan is the overview of a plan shown to admins
+type AdminPlan struct {
+	Identifier   string    `json:"identifier"`
+	Title        string    `json:"title"`
+	OwnerID      uint      `json:"owner_id"`
+	OwnerEmail   string    `json:"owner_email"`
+	FromDate     time.Time `json:"from_date"`
+	DurationDays uint      `json:"duration_days"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FillFromDataType fills the AdminPlan object from the provided database type
+func (a *AdminPlan) FillFromDataType(plan plans.Plan) {
+	a.Identifier = plan.Identifier
+	a.Title = plan.Title
+	a.OwnerID = plan.OwnerID
+	a.OwnerEmail = plan.Owner.Email
+	a.FromDate = plan.FromDate
+	a.DurationDays = plan.DurationDays
+	a.CreatedAt = plan.CreatedAt
 }
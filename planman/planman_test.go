@@ -0,0 +1,141 @@
+package planman
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/events"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+)
+
+func TestClosePlan_StopsChangesAndAutoFinalizes(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	alice, err := db.Users().GetOrCreateUser("alice@example.com", "", "Alice")
+	require.NoError(t, err)
+	bob, err := db.Users().GetOrCreateUser("bob@example.com", "", "Bob")
+	require.NoError(t, err)
+	hub := events.NewHub()
+	planner := New(db.Plans(), hub)
+
+	deadline := time.Now().Add(time.Hour)
+	created, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, PlanOptions{ResponseDeadline: &deadline, AutoFinalize: true})
+	require.NoError(t, err)
+	start := created.FromDate.Add(20 * time.Hour).Unix()
+	_, err = planner.AddEntry(created.Identifier, alice, start, 7200)
+	require.NoError(t, err)
+	entry, err := planner.AddEntry(created.Identifier, bob, start+3600, 7200)
+	require.NoError(t, err)
+
+	sub, _, _ := hub.Subscribe(created.Identifier, 0)
+	defer sub.Close()
+	plan, err := db.Plans().GetPlan(created.Identifier)
+	require.NoError(t, err)
+	require.NoError(t, planner.closePlan(&plan, deadline.Add(time.Minute)))
+	require.NoError(t, planner.closePlan(&plan, deadline.Add(2*time.Minute)), "closing again does nothing")
+	that.Equal(events.PlanClosed, (<-sub.Events()).Type)
+	that.Equal(events.PlanFinalized, (<-sub.Events()).Type)
+
+	closed, err := planner.GetPlan(created.Identifier)
+	require.NoError(t, err)
+	that.True(closed.Closed)
+	if that.NotNil(closed.Final) {
+		// Where both are available
+		that.Equal(start+3600, closed.Final.StartAtUnix)
+		that.EqualValues(3600, closed.Final.DurationSeconds)
+	}
+	_, err = planner.AddEntry(created.Identifier, bob, start+18000, 3600)
+	userError, ok := dataerror.As(err)
+	that.True(ok && userError.Code == dataerror.CodeConflict, "no entries can be added to a closed plan")
+	that.Error(planner.DeleteEntry(entry.EntryID, bob), "no entries can be deleted from a closed plan")
+
+	// Moving the deadline opens the plan up again
+	later := time.Now().Add(2 * time.Hour)
+	require.NoError(t, planner.SetResponseDeadline(created.Identifier, alice, &later, false))
+	that.NoError(planner.DeleteEntry(entry.EntryID, bob))
+}
+
+func TestCheckQuorum_NeedsPeopleAvailableAtOnce(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	alice, err := db.Users().GetOrCreateUser("alice@example.com", "", "Alice")
+	require.NoError(t, err)
+	bob, err := db.Users().GetOrCreateUser("bob@example.com", "", "Bob")
+	require.NoError(t, err)
+	hub := events.NewHub()
+	planner := New(db.Plans(), hub)
+	created, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, PlanOptions{Quorum: 2})
+	require.NoError(t, err)
+	sub, _, _ := hub.Subscribe(created.Identifier, 0)
+	defer sub.Close()
+
+	// Two participants, but never at the same time
+	start := created.FromDate.Add(20 * time.Hour).Unix()
+	_, err = planner.AddEntry(created.Identifier, alice, start, 3600)
+	require.NoError(t, err)
+	_, err = planner.AddEntry(created.Identifier, bob, start+7200, 3600)
+	require.NoError(t, err)
+	plan, err := planner.GetPlan(created.Identifier)
+	require.NoError(t, err)
+	that.Equal(2, plan.Participants)
+	that.False(plan.QuorumReached)
+
+	_, err = planner.AddEntry(created.Identifier, bob, start+1800, 3600)
+	require.NoError(t, err)
+	received := []events.Type{}
+	for len(sub.Events()) > 0 {
+		event := <-sub.Events()
+		received = append(received, event.Type)
+		if event.Type == events.QuorumReached {
+			that.Equal(QuorumReachedEvent{Quorum: 2, Participants: 2, Available: 2}, event.Data)
+		}
+	}
+	that.Equal([]events.Type{events.EntryAdded, events.EntryAdded, events.EntryAdded, events.QuorumReached}, received)
+	plan, err = planner.GetPlan(created.Identifier)
+	require.NoError(t, err)
+	that.True(plan.QuorumReached)
+}
+
+func TestMembers_OnlyJoinOnPurpose(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	alice, err := db.Users().GetOrCreateUser("alice@example.com", "", "Alice")
+	require.NoError(t, err)
+	bob, err := db.Users().GetOrCreateUser("bob@example.com", "", "Bob")
+	require.NoError(t, err)
+	carol, err := db.Users().GetOrCreateUser("carol@example.com", "", "Carol")
+	require.NoError(t, err)
+	planner := New(db.Plans(), events.NewHub())
+	created, err := planner.NewPlan("Game night", time.Now().Add(24*time.Hour), 2, 300, alice, PlanOptions{})
+	require.NoError(t, err)
+	memberNames := func() []string {
+		plan, err := planner.GetPlan(created.Identifier)
+		require.NoError(t, err)
+		names := []string{}
+		for _, member := range plan.Members {
+			names = append(names, member.User.DisplayName)
+		}
+		return names
+	}
+	// Looking at a plan, as a link preview would, doesn't make anyone a member
+	that.Equal([]string{"Alice"}, memberNames())
+
+	_, err = planner.AddEntry(created.Identifier, bob, created.FromDate.Add(20*time.Hour).Unix(), 3600)
+	require.NoError(t, err)
+	joined, err := planner.JoinPlan(created.Identifier, carol)
+	require.NoError(t, err)
+	that.Len(joined.Members, 3)
+	_, err = planner.JoinPlan(created.Identifier, carol)
+	require.NoError(t, err)
+	that.Equal([]string{"Alice", "Bob", "Carol"}, memberNames())
+}
@@ -0,0 +1,160 @@
+package planman
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+// Slot is a stretch of time during which the same set of users are all available
+type Slot = apitypes.Slot
+
+// BestSlots returns up to limit slots on the plan with the given identifier where the most users
+// are available at once. Slots shorter than the plan's minimum availability, with fewer users than
+// its quorum, or missing any of its required members are left out.
+// Slots with more users come first, then longer ones, then earlier ones.
+func (p Planner) BestSlots(identifier string, limit int) ([]Slot, error) {
+	plan, err := p.data.GetPlan(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("could not get plan [%s]: %w", identifier, err)
+	}
+	return bestSlots(plan, limit), nil
+}
+
+// bestSlots splits the plan's timeline at every entry boundary, merges neighbouring pieces with
+// the same users, stretches each set of users over the neighbouring pieces they're all still
+// available in and ranks the result. The plan's requirements and minimum availability apply to
+// those stretches, so someone joining partway through doesn't cut short the time the others have.
+func bestSlots(plan plans.Plan, limit int) []Slot {
+	boundarySet := map[int64]bool{}
+	for _, entry := range plan.Entries {
+		boundarySet[entry.StartTimeUnix] = true
+		boundarySet[entry.StartTimeUnix+entry.DurationSeconds] = true
+	}
+	boundaries := make([]int64, 0, len(boundarySet))
+	for boundary := range boundarySet {
+		boundaries = append(boundaries, boundary)
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i] < boundaries[j]
+	})
+
+	type piece struct {
+		start, end int64
+		userIDs    []uint
+	}
+	pieces := []piece{}
+	for index := 0; index+1 < len(boundaries); index++ {
+		start, end := boundaries[index], boundaries[index+1]
+		userIDs := availableUsers(plan.Entries, start, end)
+		if len(userIDs) == 0 {
+			continue
+		}
+		// Extend the previous piece if it's directly before this one and has the same users
+		if last := len(pieces) - 1; last >= 0 && pieces[last].end == start && sameUsers(pieces[last].userIDs, userIDs) {
+			pieces[last].end = end
+			continue
+		}
+		pieces = append(pieces, piece{start: start, end: end, userIDs: userIDs})
+	}
+
+	usersByID := map[uint]userman.User{}
+	for _, entry := range plan.Entries {
+		usersByID[entry.UserID] = userman.User{
+			DisplayName: entry.User.DisplayName,
+			AvatarURL:   entry.User.ProfilePictureURL,
+		}
+	}
+	required := plan.RequiredUserIDs()
+	slots := []Slot{}
+	seen := map[string]bool{}
+	for index, current := range pieces {
+		if len(current.userIDs) < int(plan.Quorum) || !includesUsers(current.userIDs, required) {
+			continue
+		}
+		// Stretch the piece over its neighbours for as long as all of its users are still there
+		first, last := index, index
+		for first > 0 && pieces[first-1].end == pieces[first].start && includesUsers(pieces[first-1].userIDs, current.userIDs) {
+			first--
+		}
+		for last+1 < len(pieces) && pieces[last+1].start == pieces[last].end && includesUsers(pieces[last+1].userIDs, current.userIDs) {
+			last++
+		}
+		start, end := pieces[first].start, pieces[last].end
+		if end-start < int64(plan.MinimumAvailabilitySeconds) {
+			continue
+		}
+		// The same users can be stretched to the same time from several pieces
+		key := fmt.Sprint(start, current.userIDs)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		slot := Slot{
+			StartAtUnix:     start,
+			DurationSeconds: end - start,
+			Users:           make([]userman.User, len(current.userIDs)),
+		}
+		for index, userID := range current.userIDs {
+			slot.Users[index] = usersByID[userID]
+		}
+		slots = append(slots, slot)
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		if len(slots[i].Users) != len(slots[j].Users) {
+			return len(slots[i].Users) > len(slots[j].Users)
+		}
+		if slots[i].DurationSeconds != slots[j].DurationSeconds {
+			return slots[i].DurationSeconds > slots[j].DurationSeconds
+		}
+		return slots[i].StartAtUnix < slots[j].StartAtUnix
+	})
+	if limit > 0 && len(slots) > limit {
+		slots = slots[:limit]
+	}
+	return slots
+}
+
+// availableUsers returns the sorted IDs of the users with an entry covering all of [start, end)
+func availableUsers(entries []plans.PlanEntry, start, end int64) []uint {
+	seen := map[uint]bool{}
+	userIDs := []uint{}
+	for _, entry := range entries {
+		if entry.StartTimeUnix <= start && entry.StartTimeUnix+entry.DurationSeconds >= end && !seen[entry.UserID] {
+			seen[entry.UserID] = true
+			userIDs = append(userIDs, entry.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return userIDs[i] < userIDs[j]
+	})
+	return userIDs
+}
+
+// includesUsers returns whether every one of the wanted user IDs is in the sorted list of user IDs
+func includesUsers(userIDs, wanted []uint) bool {
+	for _, userID := range wanted {
+		index := sort.Search(len(userIDs), func(i int) bool { return userIDs[i] >= userID })
+		if index == len(userIDs) || userIDs[index] != userID {
+			return false
+		}
+	}
+	return true
+}
+
+// sameUsers returns whether two sorted lists of user IDs are the same
+func sameUsers(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
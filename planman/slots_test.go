@@ -0,0 +1,113 @@
+package planman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wallnutkraken/groupplan/groupdata/plans"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+func entry(userID uint, start, duration int64) plans.PlanEntry {
+	return plans.PlanEntry{
+		UserID:          userID,
+		User:            users.User{DisplayName: string(rune('A' - 1 + userID))},
+		StartTimeUnix:   start,
+		DurationSeconds: duration,
+	}
+}
+
+func TestBestSlots_MostUsersFirst(t *testing.T) {
+	that := assert.New(t)
+	plan := plans.Plan{
+		MinimumAvailabilitySeconds: 600,
+		Entries: []plans.PlanEntry{
+			entry(1, 0, 7200),
+			entry(2, 3600, 7200),
+			entry(3, 3600, 1800),
+			// Too short to make a slot with two users
+			entry(3, 9000, 300),
+		},
+	}
+
+	slots := bestSlots(plan, 0)
+	if that.Len(slots, 4) {
+		that.EqualValues(3600, slots[0].StartAtUnix)
+		that.EqualValues(1800, slots[0].DurationSeconds)
+		that.Len(slots[0].Users, 3)
+		// Two of them stay on after the third leaves
+		that.EqualValues(3600, slots[1].StartAtUnix)
+		that.EqualValues(3600, slots[1].DurationSeconds)
+		that.Len(slots[1].Users, 2)
+		// Single-user slots as long as each other are ranked by when they start
+		that.EqualValues(0, slots[2].StartAtUnix)
+		that.EqualValues(7200, slots[2].DurationSeconds)
+		that.EqualValues(3600, slots[3].StartAtUnix)
+	}
+	that.Len(bestSlots(plan, 1), 1)
+}
+
+func TestBestSlots_MergesNeighbours(t *testing.T) {
+	that := assert.New(t)
+	plan := plans.Plan{
+		MinimumAvailabilitySeconds: 60,
+		Entries: []plans.PlanEntry{
+			entry(1, 0, 3600),
+			entry(1, 3600, 3600),
+		},
+	}
+	slots := bestSlots(plan, 0)
+	if that.Len(slots, 1) {
+		that.EqualValues(7200, slots[0].DurationSeconds)
+	}
+}
+
+func TestBestSlots_OnlyWithRequiredUsersAndQuorum(t *testing.T) {
+	that := assert.New(t)
+	plan := plans.Plan{
+		MinimumAvailabilitySeconds: 600,
+		Quorum:                     3,
+		Members:                    []plans.PlanMember{{UserID: 1, Required: true}, {UserID: 2}, {UserID: 3}, {UserID: 4}},
+		Entries: []plans.PlanEntry{
+			entry(1, 0, 3600),
+			entry(2, 0, 7200),
+			entry(3, 1800, 5400),
+			entry(4, 3600, 3600),
+		},
+	}
+
+	// Three are free later on, but not the required one
+	slots := bestSlots(plan, 0)
+	if that.Len(slots, 1) {
+		that.EqualValues(1800, slots[0].StartAtUnix)
+		that.EqualValues(1800, slots[0].DurationSeconds)
+		that.Len(slots[0].Users, 3)
+	}
+
+	plan.Quorum = 4
+	that.Empty(bestSlots(plan, 0))
+	that.False(groupPlanFromData(plan).QualifyingSlot)
+}
+
+func TestBestSlots_SomeoneJoiningPartwayDoesNotSplitTheSlot(t *testing.T) {
+	that := assert.New(t)
+	plan := plans.Plan{
+		MinimumAvailabilitySeconds: 600,
+		Quorum:                     2,
+		Members:                    []plans.PlanMember{{UserID: 1, Required: true}, {UserID: 2}, {UserID: 3}},
+		Entries: []plans.PlanEntry{
+			entry(1, 0, 600),
+			entry(2, 0, 600),
+			entry(3, 300, 600),
+		},
+	}
+
+	slots := bestSlots(plan, 0)
+	if that.Len(slots, 1) {
+		that.EqualValues(0, slots[0].StartAtUnix)
+		that.EqualValues(600, slots[0].DurationSeconds)
+		that.Equal([]userman.User{{DisplayName: "A"}, {DisplayName: "B"}}, slots[0].Users)
+	}
+	that.True(groupPlanFromData(plan).QualifyingSlot)
+}
@@ -0,0 +1,98 @@
+package userman
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/groupdata/users"
+	"github.com/wallnutkraken/groupplan/secid"
+)
+
+// APITokenPrefix starts every API token, telling them apart from session tokens
+const APITokenPrefix = apitypes.APITokenPrefix
+
+// maxTokenNameLength is the longest name an API token can have
+const maxTokenNameLength = 100
+
+// APIToken describes an API token, without the token itself
+type APIToken = apitypes.APIToken
+
+// apiTokenFromData converts the database type of an API token into an APIToken
+func apiTokenFromData(token users.APIToken) APIToken {
+	return APIToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// hashToken returns the hash an API token is stored as
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a new API token for the user. The token itself is only returned here,
+// it can't be retrieved later.
+func (m *Manager) CreateAPIToken(user users.User, name string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", APIToken{}, dataerror.ErrField("name", "API token name cannot be empty")
+	}
+	if len(name) > maxTokenNameLength {
+		return "", APIToken{}, dataerror.ErrField("name", fmt.Sprintf("API token name cannot be longer than %d characters", maxTokenNameLength))
+	}
+	random, err := secid.String(32)
+	if err != nil {
+		return "", APIToken{}, fmt.Errorf("failed creating secure token: %w", err)
+	}
+	token := APITokenPrefix + random
+	record := users.APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hashToken(token),
+	}
+	if err := m.users.CreateAPIToken(&record); err != nil {
+		return "", APIToken{}, err
+	}
+	return token, apiTokenFromData(record), nil
+}
+
+// ListAPITokens returns the user's API tokens
+func (m *Manager) ListAPITokens(user users.User) ([]APIToken, error) {
+	tokens, err := m.users.ListAPITokens(user)
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]APIToken, len(tokens))
+	for index, token := range tokens {
+		converted[index] = apiTokenFromData(token)
+	}
+	return converted, nil
+}
+
+// RevokeAPIToken deletes one of the user's API tokens
+func (m *Manager) RevokeAPIToken(user users.User, tokenID uint) error {
+	return m.users.DeleteAPIToken(user, tokenID)
+}
+
+// AuthenticateAPIToken returns the user an API token belongs to. Disabled users are rejected
+// with ErrDisabled.
+func (m *Manager) AuthenticateAPIToken(token string) (users.User, error) {
+	record, err := m.users.GetAPITokenByHash(hashToken(token))
+	if err != nil {
+		return users.User{}, err
+	}
+	if record.User.Disabled {
+		return record.User, ErrDisabled
+	}
+	if err := m.users.TouchAPIToken(&record); err != nil {
+		return record.User, err
+	}
+	return record.User, nil
+}
@@ -2,14 +2,23 @@
 package userman
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/wallnutkraken/groupplan/apitypes"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
 	"github.com/wallnutkraken/groupplan/groupdata/users"
 )
 
+// ErrDisabled is returned when a disabled user tries to log in or use their session
+var ErrDisabled = errors.New("this account has been disabled")
+
 // Manager is responsible for user operations with the data layer
 type Manager struct {
-	users UserHandler
+	users       UserHandler
+	adminEmails map[string]bool
 }
 
 // UserHandler is the interface for what methods the user persistency layer should provide UserMan
@@ -18,12 +27,28 @@ type UserHandler interface {
 	GetProvider(name string) (users.AuthenticationProvider, error)
 	GetOrCreateUser(email, avatarURL, displayName string) (users.User, error)
 	UserAuthorizedWith(user users.User, provider users.AuthenticationProvider, identifier string) (users.UserAuthPoint, error)
+	ListUsers(offset, limit int) ([]users.User, int64, error)
+	GetUser(id uint) (users.User, error)
+	GetUserByAuthPoint(provider, identifier string) (users.User, error)
+	SetDisabled(user *users.User, disabled bool) error
+	GetStats() (users.UserStats, error)
+	CreateAPIToken(token *users.APIToken) error
+	GetAPITokenByHash(hash string) (users.APIToken, error)
+	ListAPITokens(user users.User) ([]users.APIToken, error)
+	DeleteAPIToken(user users.User, tokenID uint) error
+	TouchAPIToken(token *users.APIToken) error
 }
 
-// New creates a new instance of the user manager
-func New(userData UserHandler) *Manager {
+// New creates a new instance of the user manager. Users with any of the given email addresses are
+// admins, in addition to the ones with the admin flag set in the database.
+func New(userData UserHandler, adminEmails []string) *Manager {
+	admins := map[string]bool{}
+	for _, email := range adminEmails {
+		admins[strings.ToLower(strings.TrimSpace(email))] = true
+	}
 	return &Manager{
-		users: userData,
+		users:       userData,
+		adminEmails: admins,
 	}
 }
 
@@ -41,6 +66,9 @@ func (m *Manager) Authenticate(email, avatarURL, provider, identifier, displayNa
 	if err != nil {
 		return user, fmt.Errorf("failed creating/getting user from db: %w", err)
 	}
+	if user.Disabled {
+		return user, ErrDisabled
+	}
 	// Add the authorization point
 	authPoint, err := m.users.UserAuthorizedWith(user, prov, identifier)
 	if err != nil {
@@ -54,13 +82,96 @@ func (m *Manager) Authenticate(email, avatarURL, provider, identifier, displayNa
 	return user, nil
 }
 
-// GetAuthenticatedUser returns an existing user based on their email address
+// GetAuthenticatedUser returns an existing user based on their email address. Disabled users are
+// rejected with ErrDisabled.
 func (m *Manager) GetAuthenticatedUser(email string) (users.User, error) {
-	return m.users.GetOrCreateUser(email, "", "")
+	user, err := m.users.GetOrCreateUser(email, "", "")
+	if err != nil {
+		return user, err
+	}
+	if user.Disabled {
+		return user, ErrDisabled
+	}
+	return user, nil
+}
+
+// GetUserByProviderIdentity returns the user who logged in with the given provider under the given
+// identifier, such as their Discord user ID. Disabled users are rejected with ErrDisabled.
+func (m *Manager) GetUserByProviderIdentity(provider, identifier string) (users.User, error) {
+	user, err := m.users.GetUserByAuthPoint(provider, identifier)
+	if err != nil {
+		return user, err
+	}
+	if user.Disabled {
+		return user, ErrDisabled
+	}
+	return user, nil
+}
+
+// IsAdmin returns whether the user has the admin capability, either through the database or the config
+func (m *Manager) IsAdmin(user users.User) bool {
+	return user.IsAdmin || m.adminEmails[strings.ToLower(user.Email)]
+}
+
+// ListUsers returns a page of users, along with the total number of users
+func (m *Manager) ListUsers(page, perPage int) ([]AdminUser, int64, error) {
+	found, total, err := m.users.ListUsers((page-1)*perPage, perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	converted := make([]AdminUser, len(found))
+	for index, user := range found {
+		converted[index].FillFromDataType(user, m.IsAdmin(user))
+	}
+	return converted, total, nil
+}
+
+// SetDisabled disables or re-enables the user with the given ID. Admins can't be disabled, so that
+// an admin can't lock everyone (including themselves) out.
+func (m *Manager) SetDisabled(userID uint, disabled bool) (AdminUser, error) {
+	user, err := m.users.GetUser(userID)
+	if err != nil {
+		return AdminUser{}, err
+	}
+	if disabled && m.IsAdmin(user) {
+		return AdminUser{}, dataerror.ErrConflict("admins cannot be disabled, revoke their admin rights first")
+	}
+	if err := m.users.SetDisabled(&user, disabled); err != nil {
+		return AdminUser{}, err
+	}
+	user.Disabled = disabled
+
+	converted := AdminUser{}
+	converted.FillFromDataType(user, m.IsAdmin(user))
+	return converted, nil
+}
+
+// GetStats returns aggregate numbers about users
+func (m *Manager) GetStats() (users.UserStats, error) {
+	return m.users.GetStats()
 }
 
 // User represents a single user
-type User struct {
-	DisplayName string `json:"display_name"`
-	AvatarURL   string `json:"avatar_url"`
+type User = apitypes.User
+
+// AdminUser is the detailed view of a user, only shown to admins
+type AdminUser struct {
+	ID          uint      `json:"id"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsAdmin     bool      `json:"is_admin"`
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FillFromDataType fills the AdminUser object from the provided database type
+func (a *AdminUser) FillFromDataType(user users.User, isAdmin bool) {
+	a.ID = user.ID
+	a.Email = user.Email
+	a.DisplayName = user.DisplayName
+	a.AvatarURL = user.ProfilePictureURL
+	a.IsAdmin = isAdmin
+	a.Disabled = user.Disabled
+	a.CreatedAt = user.CreatedAt
 }
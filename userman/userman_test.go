@@ -0,0 +1,56 @@
+package userman_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wallnutkraken/groupplan/groupdata"
+	"github.com/wallnutkraken/groupplan/groupdata/dataerror"
+	"github.com/wallnutkraken/groupplan/userman"
+)
+
+func TestSetDisabled_AdminsRefused_OthersLockedOut(t *testing.T) {
+	that := assert.New(t)
+	db, err := groupdata.New(groupdata.DriverSQLite, filepath.Join(t.TempDir(), "groupplan.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+	accounts := userman.New(db.Users(), []string{" Config-Admin@example.com "})
+	configAdmin, err := db.Users().GetOrCreateUser("config-admin@example.com", "", "Config admin")
+	require.NoError(t, err)
+	flagAdmin, err := db.Users().GetOrCreateUser("flag-admin@example.com", "", "Flag admin")
+	require.NoError(t, err)
+	require.NoError(t, db.Users().SetAdmin(&flagAdmin, true))
+	user, err := db.Users().GetOrCreateUser("user@example.com", "", "User")
+	require.NoError(t, err)
+	provider, err := db.Users().GetProvider("discord")
+	require.NoError(t, err)
+	_, err = db.Users().UserAuthorizedWith(user, provider, "user-discord-id")
+	require.NoError(t, err)
+
+	that.True(accounts.IsAdmin(configAdmin), "admin emails from the config are case insensitive")
+	that.True(accounts.IsAdmin(flagAdmin))
+	that.False(accounts.IsAdmin(user))
+	for _, admin := range []uint{configAdmin.ID, flagAdmin.ID} {
+		_, err = accounts.SetDisabled(admin, true)
+		userError, ok := dataerror.As(err)
+		that.True(ok && userError.Code == dataerror.CodeConflict, "admins can't be disabled")
+	}
+
+	disabled, err := accounts.SetDisabled(user.ID, true)
+	require.NoError(t, err)
+	that.True(disabled.Disabled)
+	_, err = accounts.GetAuthenticatedUser(user.Email)
+	that.True(errors.Is(err, userman.ErrDisabled), "disabled users are rejected")
+	_, err = accounts.GetUserByProviderIdentity("discord", "user-discord-id")
+	that.True(errors.Is(err, userman.ErrDisabled), "disabled users are rejected")
+	_, err = accounts.Authenticate(user.Email, "", "discord", "user-discord-id", user.DisplayName)
+	that.True(errors.Is(err, userman.ErrDisabled), "disabled users are rejected")
+
+	_, err = accounts.SetDisabled(user.ID, false)
+	require.NoError(t, err)
+	_, err = accounts.GetAuthenticatedUser(user.Email)
+	that.NoError(err, "re-enabled users can log in again")
+}